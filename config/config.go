@@ -18,16 +18,20 @@ import (
 	"github.com/libp2p/go-libp2p-core/transport"
 	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
 
+	"github.com/libp2p/go-eventbus"
+
 	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
 	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
 	routed "github.com/libp2p/go-libp2p/p2p/host/routed"
+	inat "github.com/libp2p/go-libp2p/p2p/net/nat"
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
 	circuitv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 
 	logging "github.com/ipfs/go-log/v2"
 	ma "github.com/multiformats/go-multiaddr"
@@ -52,6 +56,12 @@ type AutoNATConfig struct {
 	ThrottleGlobalLimit int
 	ThrottlePeerLimit   int
 	ThrottleInterval    time.Duration
+
+	AddrReachability            bool
+	AdvertiseReachableAddrsOnly bool
+
+	// Options are passed to AutoNAT after the options derived from the fields above.
+	Options []autonat.Option
 }
 
 // Config describes a set of settings for a libp2p node
@@ -65,6 +75,11 @@ type Config struct {
 	// Set it via the UserAgent option function.
 	UserAgent string
 
+	// IdentifyOpts are options for the identify service.
+	//
+	// Set them via the IdentifyOptions option function.
+	IdentifyOpts []identify.Option
+
 	PeerKey crypto.PrivKey
 
 	Transports         []TptC
@@ -77,12 +92,14 @@ type Config struct {
 
 	RelayCustom bool
 	Relay       bool // should the relay transport be used
+	RelayOpts   []circuitv2.Option
 
 	EnableRelayService bool // should we run a circuitv2 relay (if publicly reachable)
 	RelayServiceOpts   []relayv2.Option
 
 	ListenAddrs     []ma.Multiaddr
 	AddrsFactory    bhost.AddrsFactory
+	AnnouncePolicy  *bhost.AnnouncePolicy
 	ConnectionGater connmgr.ConnectionGater
 
 	ConnManager     connmgr.ConnManager
@@ -92,6 +109,11 @@ type Config struct {
 	Peerstore  peerstore.Peerstore
 	Reporter   metrics.Reporter
 
+	// NATPortMap enables the default NAT manager, configured with NATPortMapOpts.
+	// It can't be combined with NATManager.
+	NATPortMap     bool
+	NATPortMapOpts []inat.Option
+
 	MultiaddrResolver *madns.Resolver
 
 	DisablePing bool
@@ -200,7 +222,7 @@ func (cfg *Config) addTransports(h host.Host) error {
 	}
 
 	if cfg.Relay {
-		if err := circuitv2.AddTransport(h, upgrader); err != nil {
+		if err := circuitv2.AddTransport(h, upgrader, cfg.RelayOpts...); err != nil {
 			h.Close()
 			return err
 		}
@@ -218,17 +240,30 @@ func (cfg *Config) NewNode() (host.Host, error) {
 		return nil, err
 	}
 
+	bus := eventbus.NewBus()
+	natManager := cfg.NATManager
+	if cfg.NATPortMap {
+		// Emit changes of the external addresses on the host's event bus.
+		natOpts := append([]inat.Option{inat.WithEventBus(bus)}, cfg.NATPortMapOpts...)
+		natManager = bhost.NewNATManagerWithOptions(natOpts...)
+	}
+
 	h, err := bhost.NewHost(swrm, &bhost.HostOpts{
+		EventBus:            bus,
 		ConnManager:         cfg.ConnManager,
 		AddrsFactory:        cfg.AddrsFactory,
-		NATManager:          cfg.NATManager,
+		AnnouncePolicy:      cfg.AnnouncePolicy,
+		NATManager:          natManager,
 		EnablePing:          !cfg.DisablePing,
 		UserAgent:           cfg.UserAgent,
+		IdentifyOpts:        cfg.IdentifyOpts,
 		MultiaddrResolver:   cfg.MultiaddrResolver,
 		EnableHolePunching:  cfg.EnableHolePunching,
 		HolePunchingOptions: cfg.HolePunchingOptions,
 		EnableRelayService:  cfg.EnableRelayService,
 		RelayServiceOpts:    cfg.RelayServiceOpts,
+
+		AdvertiseReachableAddrsOnly: cfg.AutoNATConfig.AdvertiseReachableAddrsOnly,
 	})
 	if err != nil {
 		swrm.Close()
@@ -286,7 +321,9 @@ func (cfg *Config) NewNode() (host.Host, error) {
 
 	autonatOpts := []autonat.Option{
 		autonat.UsingAddresses(func() []ma.Multiaddr {
-			return addrF(h.AllAddrs())
+			// Apply the AnnouncePolicy, so that we don't ask peers to dial addresses we don't announce,
+			// and test the addresses we announce instead of our listen addresses.
+			return addrF(h.AnnouncedAddrs())
 		}),
 	}
 	if cfg.AutoNATConfig.ThrottleInterval != 0 {
@@ -335,9 +372,13 @@ func (cfg *Config) NewNode() (host.Host, error) {
 		// closed (as long as we close the underlying network).
 		autonatOpts = append(autonatOpts, autonat.EnableService(dialerHost.Network()))
 	}
+	if cfg.AutoNATConfig.AddrReachability {
+		autonatOpts = append(autonatOpts, autonat.WithAddrReachability())
+	}
 	if cfg.AutoNATConfig.ForceReachability != nil {
 		autonatOpts = append(autonatOpts, autonat.WithReachability(*cfg.AutoNATConfig.ForceReachability))
 	}
+	autonatOpts = append(autonatOpts, cfg.AutoNATConfig.Options...)
 
 	autonat, err := autonat.New(h, autonatOpts...)
 	if err != nil {
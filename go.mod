@@ -57,6 +57,7 @@ require (
 	github.com/libp2p/go-libp2p/examples v0.0.0-20220605195932-d7ba37217c6f
 	github.com/libp2p/go-tcp-transport v0.5.0
 	github.com/linakesi/lnksutils v0.0.0-20211111115441-4b6a6fffd283
+	golang.org/x/net v0.0.0-20220524220425-1d687d428aca
 )
 
 require (
@@ -117,7 +118,7 @@ require (
 	go.uber.org/multierr v1.8.0 // indirect
 	go.uber.org/zap v1.21.0 // indirect
 	golang.org/x/mod v0.6.0-dev.0.20220106191415-9b9b3d81d5e3 // indirect
-	golang.org/x/net v0.0.0-20220524220425-1d687d428aca // indirect
+	golang.org/x/text v0.3.7 // indirect
 	golang.org/x/tools v0.1.10 // indirect
 	golang.org/x/xerrors v0.0.0-20220517211312-f3a8303e98df // indirect
 	google.golang.org/grpc v1.33.2 // indirect
@@ -3,18 +3,28 @@ package libp2p
 import (
 	"context"
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/libp2p/go-libp2p/p2p/host/autonat"
+	autonatpb "github.com/libp2p/go-libp2p/p2p/host/autonat/pb"
+	inat "github.com/libp2p/go-libp2p/p2p/net/nat"
+	natt "github.com/libp2p/go-libp2p/p2p/net/nat/testing"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 
 	"github.com/libp2p/go-libp2p-core/connmgr"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/transport"
 
+	"github.com/libp2p/go-msgio/protoio"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/stretchr/testify/require"
 )
 
@@ -164,3 +174,125 @@ func TestChainOptions(t *testing.T) {
 		}
 	}
 }
+
+func TestAnnounceOptions(t *testing.T) {
+	h, err := New(
+		ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		AppendAnnounceAddrs(ma.StringCast("/ip4/1.2.3.4/tcp/1234"), ma.StringCast("/ip4/10.1.2.3/tcp/1234")),
+		NoAnnounceSubnets("10.0.0.0/8"),
+		NoAnnouncePrivateAddrsWhenPublic(),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1234")}, h.Addrs())
+
+	var cfg Config
+	require.NoError(t, cfg.Apply(NoAnnounceSubnets("/ip4/192.168.0.0/ipcidr/16")))
+	require.Len(t, cfg.AnnouncePolicy.NoAnnounceSubnets, 1)
+	require.Equal(t, "192.168.0.0/16", cfg.AnnouncePolicy.NoAnnounceSubnets[0].String())
+	require.Error(t, cfg.Apply(NoAnnounceSubnets("foobar")))
+
+	require.NoError(t, cfg.Apply(AppendAnnounceAddrsFunc(func([]ma.Multiaddr) []ma.Multiaddr { return nil })))
+	require.Len(t, cfg.AnnouncePolicy.AppendAnnounceFuncs, 1)
+}
+
+func TestAutoNATUsesAnnouncedAddrs(t *testing.T) {
+	static := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	h, err := New(
+		ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		AnnounceAddrs(static, ma.StringCast("/ip4/10.1.2.3/tcp/1234")),
+		NoAnnounceAddrs(ma.StringCast("/ip4/10.1.2.3/tcp/1234")),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+
+	server, err := New(ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer server.Close()
+	dialed := make(chan []ma.Multiaddr, 1)
+	server.SetStreamHandler(autonat.AutoNATProto, func(s network.Stream) {
+		defer s.Close()
+		var req autonatpb.Message
+		if err := protoio.NewDelimitedReader(s, network.MessageSizeMax).ReadMsg(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		var addrs []ma.Multiaddr
+		for _, b := range req.GetDial().GetPeer().GetAddrs() {
+			a, err := ma.NewMultiaddrBytes(b)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			addrs = append(addrs, a)
+		}
+		select {
+		case dialed <- addrs:
+		default:
+		}
+		protoio.NewDelimitedWriter(s).WriteMsg(&autonatpb.Message{
+			Type:         autonatpb.Message_DIAL_RESPONSE.Enum(),
+			DialResponse: &autonatpb.Message_DialResponse{Status: autonatpb.Message_E_DIAL_ERROR.Enum()},
+		})
+	})
+
+	// AutoNAT doesn't ask peers that only have private addresses
+	h.Peerstore().AddAddr(server.ID(), ma.StringCast("/ip4/5.6.7.8/tcp/1234"), time.Hour)
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}))
+	select {
+	case addrs := <-dialed:
+		// the static address is tested, the listen and the NoAnnounce addresses are not
+		require.Equal(t, []ma.Multiaddr{static}, addrs)
+	case <-time.After(5 * time.Second):
+		t.Fatal("AutoNAT didn't send a dial request")
+	}
+}
+
+func TestNATPortMapEmitsExternalAddrChanged(t *testing.T) {
+	gw := natt.NewFakeGateway(inat.ProtocolNATPMP, net.IPv4(1, 2, 3, 4))
+	h, err := New(
+		ListenAddrStrings("/ip4/0.0.0.0/tcp/0"),
+		NATPortMap(inat.WithGateway(gw), inat.WithMappingDuration(30*time.Millisecond)),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+	sub, err := h.EventBus().Subscribe(new(inat.EvtExternalAddrChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	var port int
+	for _, a := range h.Network().ListenAddresses() {
+		if na, err := manet.ToNetAddr(a); err == nil {
+			port = na.(*net.TCPAddr).Port
+		}
+	}
+	require.NotZero(t, port)
+
+	// the gateway assigns a different port when the mapping is renewed
+	gw.SetPortOffset(1)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-sub.Out():
+			evt := e.(inat.EvtExternalAddrChanged)
+			if evt.Current != nil && evt.Current.(*net.TCPAddr).Port == port+1 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("expected an EvtExternalAddrChanged event")
+		}
+	}
+}
+
+func TestAutoNATServiceOptions(t *testing.T) {
+	h, err := New(
+		EnableNATService(),
+		AutoNATServiceOptions(autonat.WithSubnetThrottling(5), autonat.WithDialBudget(time.Minute, 5)),
+	)
+	require.NoError(t, err)
+	h.Close()
+
+	// the options are passed to AutoNAT
+	_, err = New(AutoNATServiceOptions(autonat.WithDialBudget(-1, 0)))
+	require.Error(t, err)
+}
@@ -83,6 +83,9 @@ func SetDefaultServiceLimits(limiter *rcmgr.BasicLimiter) {
 	setProtocolLimits(limiter, autonat.AutoNATProto,
 		limiter.DefaultProtocolLimits.WithMemoryLimit(1, 4<<20, 64<<20),
 		peerLimit(2, 2, 2))
+	setProtocolLimits(limiter, autonat.AutoNATDialBackProto,
+		limiter.DefaultProtocolLimits.WithMemoryLimit(1, 4<<20, 64<<20),
+		peerLimit(2, 2, 2))
 
 	// holepunch
 	setServiceLimits(limiter, holepunch.ServiceName,
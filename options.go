@@ -6,6 +6,8 @@ package libp2p
 import (
 	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/connmgr"
@@ -17,13 +19,18 @@ import (
 	"github.com/libp2p/go-libp2p-core/pnet"
 
 	"github.com/libp2p/go-libp2p/config"
+	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	inat "github.com/libp2p/go-libp2p/p2p/net/nat"
+	circuitv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
+	mamask "github.com/whyrusleeping/multiaddr-filter"
 )
 
 // ListenAddrStrings configures libp2p to listen on the given (unparsed)
@@ -210,15 +217,98 @@ func AddrsFactory(factory config.AddrsFactory) Option {
 	}
 }
 
+func announcePolicy(cfg *Config) *bhost.AnnouncePolicy {
+	if cfg.AnnouncePolicy == nil {
+		cfg.AnnouncePolicy = &bhost.AnnouncePolicy{}
+	}
+	return cfg.AnnouncePolicy
+}
+
+// AnnounceAddrs configures libp2p to announce the given addresses instead of
+// the addresses it is listening on and the addresses observed by other peers.
+// The no-announce filters still apply to these addresses.
+func AnnounceAddrs(addrs ...ma.Multiaddr) Option {
+	return func(cfg *Config) error {
+		p := announcePolicy(cfg)
+		p.Announce = append(p.Announce, addrs...)
+		return nil
+	}
+}
+
+// AppendAnnounceAddrs configures libp2p to announce the given addresses in
+// addition to the addresses it would announce otherwise.
+func AppendAnnounceAddrs(addrs ...ma.Multiaddr) Option {
+	return func(cfg *Config) error {
+		p := announcePolicy(cfg)
+		p.AppendAnnounce = append(p.AppendAnnounce, addrs...)
+		return nil
+	}
+}
+
+// AppendAnnounceAddrsFunc configures libp2p to announce the addresses returned by f in
+// addition to the addresses it would announce otherwise. f is called with the host's
+// addresses whenever the announced addresses are computed, so the addresses it
+// returns can change over time. The no-announce filters still apply to them.
+func AppendAnnounceAddrsFunc(f func(addrs []ma.Multiaddr) []ma.Multiaddr) Option {
+	return func(cfg *Config) error {
+		p := announcePolicy(cfg)
+		p.AppendAnnounceFuncs = append(p.AppendAnnounceFuncs, f)
+		return nil
+	}
+}
+
+// NoAnnounceAddrs configures libp2p to never announce the given addresses.
+func NoAnnounceAddrs(addrs ...ma.Multiaddr) Option {
+	return func(cfg *Config) error {
+		p := announcePolicy(cfg)
+		p.NoAnnounce = append(p.NoAnnounce, addrs...)
+		return nil
+	}
+}
+
+// NoAnnounceSubnets configures libp2p to never announce addresses in the given
+// subnets. Subnets can be given in CIDR notation (10.0.0.0/8) or as multiaddr
+// masks (/ip4/10.0.0.0/ipcidr/8).
+func NoAnnounceSubnets(subnets ...string) Option {
+	return func(cfg *Config) error {
+		p := announcePolicy(cfg)
+		for _, s := range subnets {
+			var subnet *net.IPNet
+			var err error
+			if strings.HasPrefix(s, "/") {
+				subnet, err = mamask.NewMask(s)
+			} else {
+				_, subnet, err = net.ParseCIDR(s)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid subnet %s: %w", s, err)
+			}
+			p.NoAnnounceSubnets = append(p.NoAnnounceSubnets, subnet)
+		}
+		return nil
+	}
+}
+
+// NoAnnouncePrivateAddrsWhenPublic configures libp2p to not announce private
+// and loopback addresses as long as it has at least one public address to announce.
+func NoAnnouncePrivateAddrsWhenPublic() Option {
+	return func(cfg *Config) error {
+		announcePolicy(cfg).NoPrivateWhenPublic = true
+		return nil
+	}
+}
+
 // EnableRelay configures libp2p to enable the relay transport.
 // This option only configures libp2p to accept inbound connections from relays
 // and make outbound connections_through_ relays when requested by the remote peer.
 // This option supports both circuit v1 and v2 connections.
+// Options (e.g. circuitv2.WithMultiHop) are passed on to the circuit v2 client.
 // (default: enabled)
-func EnableRelay() Option {
+func EnableRelay(opts ...circuitv2.Option) Option {
 	return func(cfg *Config) error {
 		cfg.RelayCustom = true
 		cfg.Relay = true
+		cfg.RelayOpts = opts
 		return nil
 	}
 }
@@ -326,6 +416,28 @@ func AutoNATServiceRateLimit(global, perPeer int, interval time.Duration) Option
 	}
 }
 
+// AutoNATServiceOptions passes additional options to the AutoNAT subsystem, e.g.
+// autonat.WithSubnetThrottling or autonat.WithDialBudget to configure the service
+// enabled by EnableNATService. They take precedence over the options set by
+// AutoNATServiceRateLimit.
+func AutoNATServiceOptions(opts ...autonat.Option) Option {
+	return func(cfg *Config) error {
+		cfg.AutoNATConfig.Options = append(cfg.AutoNATConfig.Options, opts...)
+		return nil
+	}
+}
+
+// AutoNATAddrReachability configures AutoNAT to test the reachability of each of the
+// host's public addresses individually. If advertiseReachableOnly is set, the host
+// only advertises the addresses that were confirmed to be reachable, and relay addresses.
+func AutoNATAddrReachability(advertiseReachableOnly bool) Option {
+	return func(cfg *Config) error {
+		cfg.AutoNATConfig.AddrReachability = true
+		cfg.AutoNATConfig.AdvertiseReachableAddrsOnly = advertiseReachableOnly
+		return nil
+	}
+}
+
 // ConnectionGater configures libp2p to use the given ConnectionGater
 // to actively reject inbound/outbound connections based on the lifecycle stage
 // of the connection.
@@ -353,16 +465,24 @@ func ResourceManager(rcmgr network.ResourceManager) Option {
 }
 
 // NATPortMap configures libp2p to use the default NATManager. The default
-// NATManager will attempt to open a port in your network's firewall using UPnP.
-func NATPortMap() Option {
-	return NATManager(bhost.NewNATManager)
+// NATManager will attempt to open a port in your network's firewall using UPnP
+// or NAT-PMP. Options can be passed to configure port mappings, e.g. their lifetime.
+func NATPortMap(opts ...inat.Option) Option {
+	return func(cfg *Config) error {
+		if cfg.NATManager != nil || cfg.NATPortMap {
+			return fmt.Errorf("cannot specify multiple NATManagers")
+		}
+		cfg.NATPortMap = true
+		cfg.NATPortMapOpts = opts
+		return nil
+	}
 }
 
 // NATManager will configure libp2p to use the requested NATManager. This
 // function should be passed a NATManager *constructor* that takes a libp2p Network.
 func NATManager(nm config.NATManagerC) Option {
 	return func(cfg *Config) error {
-		if cfg.NATManager != nil {
+		if cfg.NATManager != nil || cfg.NATPortMap {
 			return fmt.Errorf("cannot specify multiple NATManagers")
 		}
 		cfg.NATManager = nm
@@ -421,6 +541,15 @@ func UserAgent(userAgent string) Option {
 	}
 }
 
+// IdentifyOptions configures the identify service, e.g. the activation
+// threshold of observed addresses and the peers trusted to observe them.
+func IdentifyOptions(opts ...identify.Option) Option {
+	return func(cfg *Config) error {
+		cfg.IdentifyOpts = append(cfg.IdentifyOpts, opts...)
+		return nil
+	}
+}
+
 // MultiaddrResolver sets the libp2p dns resolver
 func MultiaddrResolver(rslv *madns.Resolver) Option {
 	return func(cfg *Config) error {
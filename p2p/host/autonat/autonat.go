@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"math/rand"
+	"net"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -47,8 +49,20 @@ type AmbientAutoNAT struct {
 
 	service *autoNATService
 
-	emitReachabilityChanged event.Emitter
-	subscriber              event.Subscription
+	// reachability per IP address family
+	familyMx     sync.Mutex
+	familyStatus map[AddrFamily]*reachabilityState
+
+	// per-address reachability, only used if addresses are tested individually
+	verifier         *dialBackVerifier
+	addrObservations chan addrResult
+	addrMx           sync.Mutex
+	addrStatus       map[string]*addrState
+
+	emitReachabilityChanged       event.Emitter
+	emitFamilyReachabilityChanged event.Emitter
+	emitAddrReachabilityChanged   event.Emitter
+	subscriber                    event.Subscription
 }
 
 // StaticAutoNAT is a simple AutoNAT implementation when a single NAT status is desired.
@@ -61,6 +75,51 @@ type StaticAutoNAT struct {
 type autoNATResult struct {
 	network.Reachability
 	address ma.Multiaddr
+	// family is the IP address family of the probe, 0 if unknown
+	family AddrFamily
+}
+
+type addrResult struct {
+	network.Reachability
+	addr ma.Multiaddr
+	// refused is set if the AutoNAT service refused to dial addr,
+	// in which case the probe doesn't count.
+	refused bool
+	// prevProbe is the time addr was probed before this probe
+	prevProbe time.Time
+}
+
+// reachabilityState tracks the reachability of an address family or of a single address.
+type reachabilityState struct {
+	reachability network.Reachability
+	// confidence works like the confidence of the overall reachability:
+	// a single contradicting probe result doesn't flip the reachability.
+	confidence int
+}
+
+// update records a probe result, and returns true if the reachability changed.
+func (s *reachabilityState) update(r network.Reachability) bool {
+	switch {
+	case r == network.ReachabilityUnknown:
+		return false
+	case s.reachability == r:
+		if s.confidence < 3 {
+			s.confidence++
+		}
+		return false
+	case s.confidence > 0:
+		s.confidence--
+		return false
+	default:
+		s.reachability = r
+		return true
+	}
+}
+
+type addrState struct {
+	reachabilityState
+	addr      ma.Multiaddr
+	lastProbe time.Time
 }
 
 // New creates a new NAT autodiscovery system attached to a host
@@ -74,7 +133,12 @@ func New(h host.Host, options ...Option) (AutoNAT, error) {
 		return nil, err
 	}
 	if conf.addressFunc == nil {
-		conf.addressFunc = h.Addrs
+		// Hosts that only advertise reachable addresses would never test the others.
+		if uh, ok := h.(interface{ UnfilteredAddrs() []ma.Multiaddr }); ok {
+			conf.addressFunc = uh.UnfilteredAddrs
+		} else {
+			conf.addressFunc = h.Addrs
+		}
 	}
 
 	for _, o := range options {
@@ -83,6 +147,10 @@ func New(h host.Host, options ...Option) (AutoNAT, error) {
 		}
 	}
 	emitReachabilityChanged, _ := h.EventBus().Emitter(new(event.EvtLocalReachabilityChanged), eventbus.Stateful)
+	emitFamilyReachabilityChanged, err := h.EventBus().Emitter(new(EvtFamilyReachabilityChanged))
+	if err != nil {
+		return nil, err
+	}
 
 	var service *autoNATService
 	if (!conf.forceReachability || conf.reachability == network.ReachabilityPublic) && conf.dialer != nil {
@@ -95,6 +163,10 @@ func New(h host.Host, options ...Option) (AutoNAT, error) {
 
 	if conf.forceReachability {
 		emitReachabilityChanged.Emit(event.EvtLocalReachabilityChanged{Reachability: conf.reachability})
+		for _, f := range []AddrFamily{AddrFamilyIPv4, AddrFamilyIPv6} {
+			emitFamilyReachabilityChanged.Emit(EvtFamilyReachabilityChanged{Family: f, Reachability: conf.reachability})
+		}
+		emitFamilyReachabilityChanged.Close()
 
 		return &StaticAutoNAT{
 			host:         h,
@@ -112,12 +184,25 @@ func New(h host.Host, options ...Option) (AutoNAT, error) {
 		config:            conf,
 		inboundConn:       make(chan network.Conn, 5),
 		observations:      make(chan autoNATResult, 1),
+		addrObservations:  make(chan addrResult, 1),
 
-		emitReachabilityChanged: emitReachabilityChanged,
-		service:                 service,
-		recentProbes:            make(map[peer.ID]time.Time),
+		emitReachabilityChanged:       emitReachabilityChanged,
+		emitFamilyReachabilityChanged: emitFamilyReachabilityChanged,
+		service:                       service,
+		recentProbes:                  make(map[peer.ID]time.Time),
+		familyStatus:                  make(map[AddrFamily]*reachabilityState),
+	}
+	as.status.Store(autoNATResult{Reachability: network.ReachabilityUnknown})
+
+	if conf.addrReachability {
+		as.emitAddrReachabilityChanged, err = h.EventBus().Emitter(new(EvtAddrReachabilityChanged))
+		if err != nil {
+			return nil, err
+		}
+		as.verifier = newDialBackVerifier()
+		as.addrStatus = make(map[string]*addrState)
+		h.SetStreamHandler(AutoNATDialBackProto, as.verifier.handleStream)
 	}
-	as.status.Store(autoNATResult{network.ReachabilityUnknown, nil})
 
 	subscriber, err := as.host.EventBus().Subscribe([]interface{}{new(event.EvtLocalAddressesUpdated), new(event.EvtPeerIdentificationCompleted)})
 	if err != nil {
@@ -152,6 +237,33 @@ func (as *AmbientAutoNAT) PublicAddr() (ma.Multiaddr, error) {
 	return s.address, nil
 }
 
+var _ ReachabilityTracker = (*AmbientAutoNAT)(nil)
+
+// FamilyStatus returns the AutoNAT observed reachability status for an IP address family.
+func (as *AmbientAutoNAT) FamilyStatus(f AddrFamily) network.Reachability {
+	as.familyMx.Lock()
+	defer as.familyMx.Unlock()
+	if st, ok := as.familyStatus[f]; ok {
+		return st.reachability
+	}
+	return network.ReachabilityUnknown
+}
+
+// AddrStatus returns the reachability of the host's public addresses, keyed by their string
+// representation. It returns nil if addresses are not tested individually.
+func (as *AmbientAutoNAT) AddrStatus() map[string]network.Reachability {
+	if as.verifier == nil {
+		return nil
+	}
+	as.addrMx.Lock()
+	defer as.addrMx.Unlock()
+	status := make(map[string]network.Reachability, len(as.addrStatus))
+	for k, st := range as.addrStatus {
+		status[k] = st.reachability
+	}
+	return status
+}
+
 func ipInList(candidate ma.Multiaddr, list []ma.Multiaddr) bool {
 	candidateIP, _ := manet.ToIP(candidate)
 	for _, i := range list {
@@ -172,6 +284,10 @@ func (as *AmbientAutoNAT) background() {
 	subChan := as.subscriber.Out()
 	defer as.subscriber.Close()
 	defer as.emitReachabilityChanged.Close()
+	defer as.emitFamilyReachabilityChanged.Close()
+	if as.emitAddrReachabilityChanged != nil {
+		defer as.emitAddrReachabilityChanged.Close()
+	}
 
 	timer := time.NewTimer(delay)
 	defer timer.Stop()
@@ -202,7 +318,7 @@ func (as *AmbientAutoNAT) background() {
 			case event.EvtPeerIdentificationCompleted:
 				if s, err := as.host.Peerstore().SupportsProtocols(e.Peer, AutoNATProto); err == nil && len(s) > 0 {
 					currentStatus := as.status.Load().(autoNATResult)
-					if currentStatus.Reachability == network.ReachabilityUnknown {
+					if currentStatus.Reachability == network.ReachabilityUnknown || as.hasUnknownAddrs() {
 						as.tryProbe(e.Peer)
 					}
 				}
@@ -216,6 +332,8 @@ func (as *AmbientAutoNAT) background() {
 				return
 			}
 			as.recordObservation(result)
+		case result := <-as.addrObservations:
+			as.recordAddrObservation(result)
 		case <-timer.C:
 			peer := as.getPeerToProbe()
 			as.tryProbe(peer)
@@ -264,7 +382,7 @@ func (as *AmbientAutoNAT) scheduleProbe() time.Duration {
 		untilNext := as.config.refreshInterval
 		if currentStatus.Reachability == network.ReachabilityUnknown {
 			untilNext = as.config.retryInterval
-		} else if as.confidence < 3 {
+		} else if as.confidence < 3 || as.hasUnknownAddrs() {
 			untilNext = as.config.retryInterval
 		} else if currentStatus.Reachability == network.ReachabilityPublic && as.lastInbound.After(as.lastProbe) {
 			untilNext *= 2
@@ -282,6 +400,10 @@ func (as *AmbientAutoNAT) scheduleProbe() time.Duration {
 
 // Update the current status based on an observed result.
 func (as *AmbientAutoNAT) recordObservation(observation autoNATResult) {
+	if observation.family != 0 {
+		as.recordFamilyObservation(observation.family, observation.Reachability)
+	}
+
 	currentStatus := as.status.Load().(autoNATResult)
 	if observation.Reachability == network.ReachabilityPublic {
 		log.Debugf("NAT status is public")
@@ -334,7 +456,7 @@ func (as *AmbientAutoNAT) recordObservation(observation autoNATResult) {
 		as.confidence--
 	} else {
 		log.Debugf("NAT status is unknown")
-		as.status.Store(autoNATResult{network.ReachabilityUnknown, nil})
+		as.status.Store(autoNATResult{Reachability: network.ReachabilityUnknown})
 		if currentStatus.Reachability != network.ReachabilityUnknown {
 			if as.service != nil {
 				as.service.Enable()
@@ -344,6 +466,23 @@ func (as *AmbientAutoNAT) recordObservation(observation autoNATResult) {
 	}
 }
 
+// Update the reachability of an address family based on an observed result.
+func (as *AmbientAutoNAT) recordFamilyObservation(f AddrFamily, r network.Reachability) {
+	as.familyMx.Lock()
+	st, ok := as.familyStatus[f]
+	if !ok {
+		st = &reachabilityState{reachability: network.ReachabilityUnknown}
+		as.familyStatus[f] = st
+	}
+	changed := st.update(r)
+	as.familyMx.Unlock()
+
+	if changed {
+		log.Debugf("%s reachability is %s", f, r)
+		as.emitFamilyReachabilityChanged.Emit(EvtFamilyReachabilityChanged{Family: f, Reachability: r})
+	}
+}
+
 func (as *AmbientAutoNAT) tryProbe(p peer.ID) bool {
 	as.lastProbeTry = time.Now()
 	if p.Validate() != nil {
@@ -368,19 +507,30 @@ func (as *AmbientAutoNAT) tryProbe(p peer.ID) bool {
 	return false
 }
 
+// probe asks the peer for a dial back to determine our overall reachability.
+// If addresses are tested individually, it afterwards asks the peer to dial back
+// one of the addresses it is able to test.
 func (as *AmbientAutoNAT) probe(pi *peer.AddrInfo) {
-	cli := NewAutoNATClient(as.host, as.config.addressFunc)
+	cli := &client{h: as.host, addrFunc: as.config.addressFunc, verifier: as.verifier}
 	ctx, cancel := context.WithTimeout(as.ctx, as.config.requestTimeout)
 	defer cancel()
 
-	a, err := cli.DialBack(ctx, pi.ID)
+	a, via, err := cli.dialBack(ctx, pi.ID, newDialMessage(peer.AddrInfo{ID: as.host.ID(), Addrs: as.config.addressFunc()}))
 
 	var result autoNATResult
+	// The AutoNAT service dials the IP address it observed on our connection,
+	// so the result applies to the address family of that connection.
+	if via != nil {
+		result.family, _ = AddrFamilyOf(via)
+	}
 	switch {
 	case err == nil:
 		log.Debugf("Dialback through %s successful; public address is %s", pi.ID.Pretty(), a.String())
 		result.Reachability = network.ReachabilityPublic
 		result.address = a
+		if f, ok := AddrFamilyOf(a); ok {
+			result.family = f
+		}
 	case IsDialError(err):
 		log.Debugf("Dialback through %s failed", pi.ID.Pretty())
 		result.Reachability = network.ReachabilityPrivate
@@ -393,6 +543,157 @@ func (as *AmbientAutoNAT) probe(pi *peer.AddrInfo) {
 	case <-as.ctx.Done():
 		return
 	}
+
+	// The AutoNAT service only dials back addresses with the IP address it observed
+	// on our connection, so only addresses of the same family can be tested through
+	// this peer. If the dial back succeeded, we even know the exact IP address.
+	if via == nil {
+		return
+	}
+	var ip net.IP
+	if err == nil {
+		ip, _ = manet.ToIP(a)
+	}
+	if addr, prev := as.addrToProbe(result.family, ip); addr != nil {
+		as.probeAddr(cli, pi.ID, addr, prev)
+	}
+}
+
+func (as *AmbientAutoNAT) probeAddr(cli *client, p peer.ID, addr ma.Multiaddr, prevProbe time.Time) {
+	ctx, cancel := context.WithTimeout(as.ctx, as.config.requestTimeout)
+	defer cancel()
+
+	err := cli.dialBackAddr(ctx, p, addr)
+
+	result := addrResult{addr: addr, prevProbe: prevProbe}
+	switch {
+	case err == nil:
+		log.Debugf("Dialback of %s through %s successful", addr, p.Pretty())
+		result.Reachability = network.ReachabilityPublic
+	case IsDialError(err):
+		log.Debugf("Dialback of %s through %s failed", addr, p.Pretty())
+		result.Reachability = network.ReachabilityPrivate
+	case IsDialRefused(err):
+		log.Debugf("Dialback of %s through %s refused: %s", addr, p.Pretty(), err)
+		result.Reachability = network.ReachabilityUnknown
+		result.refused = true
+	default:
+		log.Debugf("Dialback of %s through %s inconclusive: %s", addr, p.Pretty(), err)
+		result.Reachability = network.ReachabilityUnknown
+	}
+
+	select {
+	case as.addrObservations <- result:
+	case <-as.ctx.Done():
+	}
+}
+
+// addrToProbe returns the address of the given family that was tested least recently,
+// along with the time it was tested before. If ip is not nil, only addresses with
+// that IP address are considered. It returns nil if addresses are not tested individually.
+func (as *AmbientAutoNAT) addrToProbe(family AddrFamily, ip net.IP) (ma.Multiaddr, time.Time) {
+	if as.verifier == nil {
+		return nil, time.Time{}
+	}
+	// Don't hold the lock while calling the address function, it might call AddrStatus.
+	addrs := as.config.addressFunc()
+
+	as.addrMx.Lock()
+	defer as.addrMx.Unlock()
+	as.updateAddrs(addrs)
+
+	var oldest *addrState
+	for _, st := range as.addrStatus {
+		if f, ok := AddrFamilyOf(st.addr); !ok || f != family {
+			continue
+		}
+		if ip != nil {
+			if addrIP, err := manet.ToIP(st.addr); err != nil || !addrIP.Equal(ip) {
+				continue
+			}
+		}
+		if oldest == nil || st.lastProbe.Before(oldest.lastProbe) {
+			oldest = st
+		}
+	}
+	if oldest == nil {
+		return nil, time.Time{}
+	}
+	prev := oldest.lastProbe
+	oldest.lastProbe = time.Now()
+	return oldest.addr, prev
+}
+
+// updateAddrs starts tracking new addresses, and stops tracking the ones we don't have any more.
+// It must be called with addrMx held.
+func (as *AmbientAutoNAT) updateAddrs(addrs []ma.Multiaddr) {
+	current := make(map[string]struct{}, len(addrs))
+	for _, a := range addrs {
+		if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+			continue
+		}
+		if !as.config.dialPolicy.allowSelfDials && !manet.IsPublicAddr(a) {
+			continue
+		}
+		k := a.String()
+		current[k] = struct{}{}
+		if _, ok := as.addrStatus[k]; !ok {
+			as.addrStatus[k] = &addrState{
+				reachabilityState: reachabilityState{reachability: network.ReachabilityUnknown},
+				addr:              a,
+			}
+		}
+	}
+	for k := range as.addrStatus {
+		if _, ok := current[k]; !ok {
+			delete(as.addrStatus, k)
+		}
+	}
+}
+
+// hasUnknownAddrs returns true if the reachability of at least one address hasn't been determined yet.
+func (as *AmbientAutoNAT) hasUnknownAddrs() bool {
+	if as.verifier == nil {
+		return false
+	}
+	as.addrMx.Lock()
+	defer as.addrMx.Unlock()
+	for _, st := range as.addrStatus {
+		if st.reachability == network.ReachabilityUnknown {
+			return true
+		}
+	}
+	return false
+}
+
+// Update the reachability of an address based on an observed result.
+func (as *AmbientAutoNAT) recordAddrObservation(observation addrResult) {
+	if observation.Reachability == network.ReachabilityUnknown && !observation.refused {
+		return
+	}
+
+	as.addrMx.Lock()
+	st, ok := as.addrStatus[observation.addr.String()]
+	if !ok {
+		// we don't have this address any more
+		as.addrMx.Unlock()
+		return
+	}
+	if observation.refused {
+		// The service didn't test the address, so this probe doesn't count.
+		st.lastProbe = observation.prevProbe
+		as.addrMx.Unlock()
+		return
+	}
+	changed := st.update(observation.Reachability)
+	as.addrMx.Unlock()
+
+	if changed {
+		as.emitAddrReachabilityChanged.Emit(EvtAddrReachabilityChanged{
+			Addr:         observation.addr,
+			Reachability: observation.Reachability,
+		})
+	}
 }
 
 func (as *AmbientAutoNAT) getPeerToProbe() peer.ID {
@@ -433,6 +734,9 @@ func (as *AmbientAutoNAT) getPeerToProbe() peer.ID {
 
 func (as *AmbientAutoNAT) Close() error {
 	as.ctxCancel()
+	if as.verifier != nil {
+		as.host.RemoveStreamHandler(AutoNATDialBackProto)
+	}
 	if as.service != nil {
 		as.service.Disable()
 	}
@@ -460,6 +764,18 @@ func (s *StaticAutoNAT) PublicAddr() (ma.Multiaddr, error) {
 	return nil, errors.New("no available address")
 }
 
+var _ ReachabilityTracker = (*StaticAutoNAT)(nil)
+
+// FamilyStatus returns the AutoNAT observed reachability status, which is the same for all address families.
+func (s *StaticAutoNAT) FamilyStatus(AddrFamily) network.Reachability {
+	return s.reachability
+}
+
+// AddrStatus returns nil, as addresses are not tested individually.
+func (s *StaticAutoNAT) AddrStatus() map[string]network.Reachability {
+	return nil
+}
+
 func (s *StaticAutoNAT) Close() error {
 	if s.service != nil {
 		s.service.Disable()
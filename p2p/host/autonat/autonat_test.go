@@ -145,6 +145,32 @@ func TestAutoNATPublic(t *testing.T) {
 	expectEvent(t, s, network.ReachabilityPublic, 3*time.Second)
 }
 
+func TestAutoNATFamilyReachability(t *testing.T) {
+	hs := makeAutoNATServicePrivate(t)
+	defer hs.Close()
+	hc, an := makeAutoNAT(t, hs)
+	defer hc.Close()
+	defer an.Close()
+
+	s, err := hc.EventBus().Subscribe(new(EvtFamilyReachabilityChanged))
+	require.NoError(t, err)
+	defer s.Close()
+
+	connect(t, hs, hc)
+	select {
+	case e := <-s.Out():
+		evt := e.(EvtFamilyReachabilityChanged)
+		// the test hosts are connected via IPv4
+		require.Equal(t, AddrFamilyIPv4, evt.Family)
+		require.Equal(t, network.ReachabilityPrivate, evt.Reachability)
+	case <-time.After(3 * time.Second):
+		t.Fatal("failed to get the family reachability event from the bus")
+	}
+	rt := an.(ReachabilityTracker)
+	require.Equal(t, network.ReachabilityPrivate, rt.FamilyStatus(AddrFamilyIPv4))
+	require.Equal(t, network.ReachabilityUnknown, rt.FamilyStatus(AddrFamilyIPv6))
+}
+
 func TestAutoNATPublictoPrivate(t *testing.T) {
 	hs := makeAutoNATServicePublic(t)
 	defer hs.Close()
@@ -210,7 +236,7 @@ func TestAutoNATObservationRecording(t *testing.T) {
 	}
 
 	// pubic observation without address should be ignored.
-	an.recordObservation(autoNATResult{network.ReachabilityPublic, nil})
+	an.recordObservation(autoNATResult{Reachability: network.ReachabilityPublic})
 	if an.Status() != network.ReachabilityUnknown {
 		t.Fatalf("unexpected transition")
 	}
@@ -223,7 +249,7 @@ func TestAutoNATObservationRecording(t *testing.T) {
 	}
 
 	addr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/udp/1234")
-	an.recordObservation(autoNATResult{network.ReachabilityPublic, addr})
+	an.recordObservation(autoNATResult{Reachability: network.ReachabilityPublic, address: addr})
 	if an.Status() != network.ReachabilityPublic {
 		t.Fatalf("failed to transition to public.")
 	}
@@ -231,7 +257,7 @@ func TestAutoNATObservationRecording(t *testing.T) {
 	expectEvent(t, s, network.ReachabilityPublic, 3*time.Second)
 
 	// a single recording should have confidence still at 0, and transition to private quickly.
-	an.recordObservation(autoNATResult{network.ReachabilityPrivate, nil})
+	an.recordObservation(autoNATResult{Reachability: network.ReachabilityPrivate})
 	if an.Status() != network.ReachabilityPrivate {
 		t.Fatalf("failed to transition to private.")
 	}
@@ -239,21 +265,111 @@ func TestAutoNATObservationRecording(t *testing.T) {
 	expectEvent(t, s, network.ReachabilityPrivate, 3*time.Second)
 
 	// stronger public confidence should be harder to undo.
-	an.recordObservation(autoNATResult{network.ReachabilityPublic, addr})
-	an.recordObservation(autoNATResult{network.ReachabilityPublic, addr})
+	an.recordObservation(autoNATResult{Reachability: network.ReachabilityPublic, address: addr})
+	an.recordObservation(autoNATResult{Reachability: network.ReachabilityPublic, address: addr})
 	if an.Status() != network.ReachabilityPublic {
 		t.Fatalf("failed to transition to public.")
 	}
 
 	expectEvent(t, s, network.ReachabilityPublic, 3*time.Second)
 
-	an.recordObservation(autoNATResult{network.ReachabilityPrivate, nil})
+	an.recordObservation(autoNATResult{Reachability: network.ReachabilityPrivate})
 	if an.Status() != network.ReachabilityPublic {
 		t.Fatalf("too-extreme private transition.")
 	}
 
 }
 
+func TestAutoNATAddrReachability(t *testing.T) {
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+	c.throttlePeerMax = 100
+	_ = makeAutoNATService(t, c)
+
+	hc := bhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer hc.Close()
+	identifyAsServer(c.host, hc)
+	sub, err := hc.EventBus().Subscribe(new(EvtAddrReachabilityChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	a, err := New(hc, WithSchedule(100*time.Millisecond, time.Second), WithoutStartupDelay(), WithAddrReachability())
+	require.NoError(t, err)
+	defer a.Close()
+	an := a.(*AmbientAutoNAT)
+	an.config.dialPolicy.allowSelfDials = true
+	an.config.throttlePeerPeriod = 100 * time.Millisecond
+	connect(t, c.host, hc)
+
+	// every address is tested individually, and reported as reachable
+	reachable := make(map[string]struct{})
+	for len(reachable) < len(hc.Addrs()) {
+		select {
+		case e := <-sub.Out():
+			evt := e.(EvtAddrReachabilityChanged)
+			require.Equal(t, network.ReachabilityPublic, evt.Reachability)
+			reachable[evt.Addr.String()] = struct{}{}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("only got reachability events for %d of %d addresses", len(reachable), len(hc.Addrs()))
+		}
+	}
+
+	status := a.(ReachabilityTracker).AddrStatus()
+	require.Len(t, status, len(hc.Addrs()))
+	for _, addr := range hc.Addrs() {
+		require.Equal(t, network.ReachabilityPublic, status[addr.String()])
+	}
+
+	// addresses are not tested individually by default
+	_, an2 := makeAutoNAT(t, c.host)
+	defer an2.Close()
+	require.Nil(t, an2.(ReachabilityTracker).AddrStatus())
+}
+
+func TestAutoNATAddrReachabilityOtherFamily(t *testing.T) {
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+	c.throttlePeerMax = 100
+	_ = makeAutoNATService(t, c)
+
+	hc := bhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer hc.Close()
+	identifyAsServer(c.host, hc)
+	sub, err := hc.EventBus().Subscribe(new(EvtAddrReachabilityChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	// The service only sees our IPv4 address, so it can't test the IPv6 address.
+	ip6 := ma.StringCast("/ip6/::1/tcp/1234")
+	addrs := func() []ma.Multiaddr { return append(hc.Addrs(), ip6) }
+	a, err := New(hc, WithSchedule(100*time.Millisecond, time.Second), WithoutStartupDelay(), WithAddrReachability(), UsingAddresses(addrs))
+	require.NoError(t, err)
+	defer a.Close()
+	an := a.(*AmbientAutoNAT)
+	an.config.dialPolicy.allowSelfDials = true
+	an.config.throttlePeerPeriod = 100 * time.Millisecond
+	connect(t, c.host, hc)
+
+	reachable := make(map[string]struct{})
+	for len(reachable) < len(hc.Addrs()) {
+		select {
+		case e := <-sub.Out():
+			evt := e.(EvtAddrReachabilityChanged)
+			require.NotEqual(t, ip6.String(), evt.Addr.String())
+			reachable[evt.Addr.String()] = struct{}{}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("only got reachability events for %d of %d addresses", len(reachable), len(hc.Addrs()))
+		}
+	}
+
+	require.Equal(t, network.ReachabilityUnknown, a.(ReachabilityTracker).AddrStatus()[ip6.String()])
+	an.addrMx.Lock()
+	defer an.addrMx.Unlock()
+	require.True(t, an.addrStatus[ip6.String()].lastProbe.IsZero(), "IPv6 address probed over an IPv4 connection")
+}
+
 func TestStaticNat(t *testing.T) {
 	_, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -2,6 +2,7 @@ package autonat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -27,6 +28,8 @@ func NewAutoNATClient(h host.Host, addrFunc AddrFunc) Client {
 type client struct {
 	h        host.Host
 	addrFunc AddrFunc
+	// verifier is needed for address probes, see dialBackAddr
+	verifier *dialBackVerifier
 }
 
 // DialBack asks peer p to dial us back on all addresses returned by the addrFunc.
@@ -36,21 +39,60 @@ type client struct {
 // actually performed a dial attempt. Servers that run a version < v0.20.0 also
 // return Message_E_DIAL_ERROR if the dial was skipped due to the dialPolicy.
 func (c *client) DialBack(ctx context.Context, p peer.ID) (ma.Multiaddr, error) {
+	a, _, err := c.dialBack(ctx, p, newDialMessage(peer.AddrInfo{ID: c.h.ID(), Addrs: c.addrFunc()}))
+	return a, err
+}
+
+// dialBackAddr asks peer p to dial us back on addr only. The peer has to send the
+// nonce of the request on the dial-back connection, which proves that the dial back
+// reached us. It returns nil if addr was verified to be reachable.
+func (c *client) dialBackAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr) error {
+	if c.verifier == nil {
+		return errors.New("address probes not supported by this client")
+	}
+	nonce, received, done, err := c.verifier.expect()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	req := newDialMessage(peer.AddrInfo{ID: c.h.ID(), Addrs: []ma.Multiaddr{addr}})
+	req.Dial.Nonce = &nonce
+	a, _, err := c.dialBack(ctx, p, req)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-received:
+	default:
+		// AutoNAT services that don't support address probes dial back without sending the nonce.
+		return errDialBackUnverified
+	}
+	if !a.Equal(addr) {
+		return fmt.Errorf("peer dialed %s instead of %s", a, addr)
+	}
+	return nil
+}
+
+// dialBack sends a dial request to peer p. Besides the dialed address, it returns the
+// address of p on the connection that the request was sent on.
+func (c *client) dialBack(ctx context.Context, p peer.ID, req *pb.Message) (addr, via ma.Multiaddr, err error) {
 	s, err := c.h.NewStream(ctx, p, AutoNATProto)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	via = s.Conn().RemoteMultiaddr()
 
 	if err := s.Scope().SetService(ServiceName); err != nil {
 		log.Debugf("error attaching stream to autonat service: %s", err)
 		s.Reset()
-		return nil, err
+		return nil, via, err
 	}
 
 	if err := s.Scope().ReserveMemory(maxMsgSize, network.ReservationPriorityAlways); err != nil {
 		log.Debugf("error reserving memory for autonat stream: %s", err)
 		s.Reset()
-		return nil, err
+		return nil, via, err
 	}
 	defer s.Scope().ReleaseMemory(maxMsgSize)
 
@@ -62,32 +104,33 @@ func (c *client) DialBack(ctx context.Context, p peer.ID) (ma.Multiaddr, error)
 	r := protoio.NewDelimitedReader(s, maxMsgSize)
 	w := protoio.NewDelimitedWriter(s)
 
-	req := newDialMessage(peer.AddrInfo{ID: c.h.ID(), Addrs: c.addrFunc()})
 	if err := w.WriteMsg(req); err != nil {
 		s.Reset()
-		return nil, err
+		return nil, via, err
 	}
 
 	var res pb.Message
 	if err := r.ReadMsg(&res); err != nil {
 		s.Reset()
-		return nil, err
+		return nil, via, err
 	}
 	if res.GetType() != pb.Message_DIAL_RESPONSE {
 		s.Reset()
-		return nil, fmt.Errorf("unexpected response: %s", res.GetType().String())
+		return nil, via, fmt.Errorf("unexpected response: %s", res.GetType().String())
 	}
 
 	status := res.GetDialResponse().GetStatus()
 	switch status {
 	case pb.Message_OK:
-		addr := res.GetDialResponse().GetAddr()
-		return ma.NewMultiaddrBytes(addr)
+		a, err := ma.NewMultiaddrBytes(res.GetDialResponse().GetAddr())
+		return a, via, err
 	default:
-		return nil, Error{Status: status, Text: res.GetDialResponse().GetStatusText()}
+		return nil, via, Error{Status: status, Text: res.GetDialResponse().GetStatusText()}
 	}
 }
 
+var errDialBackUnverified = errors.New("dial back not verified")
+
 // Error wraps errors signalled by AutoNAT services
 type Error struct {
 	Status pb.Message_ResponseStatus
@@ -0,0 +1,135 @@
+package autonat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p/p2p/host/autonat/pb"
+
+	"github.com/libp2p/go-libp2p-core/network"
+
+	"github.com/libp2p/go-msgio/protoio"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// dialBackVerifier keeps track of the nonces of our outstanding address probes.
+// AutoNAT services send the nonce on the connection they dial back, which proves
+// that the dial back actually reached us, on the address we asked them to dial.
+type dialBackVerifier struct {
+	mx      sync.Mutex
+	pending map[uint64]chan struct{}
+}
+
+func newDialBackVerifier() *dialBackVerifier {
+	return &dialBackVerifier{pending: make(map[uint64]chan struct{})}
+}
+
+// expect registers a new random nonce. The returned channel is closed as soon as the
+// nonce is received on a dial-back connection. done must be called once the probe completed.
+func (v *dialBackVerifier) expect() (nonce uint64, received <-chan struct{}, done func(), err error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, nil, nil, err
+	}
+	nonce = binary.BigEndian.Uint64(b[:])
+	ch := make(chan struct{})
+
+	v.mx.Lock()
+	v.pending[nonce] = ch
+	v.mx.Unlock()
+
+	return nonce, ch, func() {
+		v.mx.Lock()
+		delete(v.pending, nonce)
+		v.mx.Unlock()
+	}, nil
+}
+
+func (v *dialBackVerifier) received(nonce uint64) bool {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	ch, ok := v.pending[nonce]
+	if !ok {
+		return false
+	}
+	close(ch)
+	delete(v.pending, nonce)
+	return true
+}
+
+func (v *dialBackVerifier) handleStream(s network.Stream) {
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("error attaching stream to autonat service: %s", err)
+		s.Reset()
+		return
+	}
+
+	if err := s.Scope().ReserveMemory(maxMsgSize, network.ReservationPriorityAlways); err != nil {
+		log.Debugf("error reserving memory for autonat stream: %s", err)
+		s.Reset()
+		return
+	}
+	defer s.Scope().ReleaseMemory(maxMsgSize)
+
+	s.SetDeadline(time.Now().Add(streamTimeout))
+
+	var msg pb.Message
+	if err := protoio.NewDelimitedReader(s, maxMsgSize).ReadMsg(&msg); err != nil {
+		log.Debugf("error reading dial back message from %s: %s", s.Conn().RemotePeer(), err)
+		s.Reset()
+		return
+	}
+	if msg.GetType() != pb.Message_DIAL_BACK {
+		log.Debugf("unexpected message from %s: %s", s.Conn().RemotePeer(), msg.GetType())
+		s.Reset()
+		return
+	}
+	if !v.received(msg.GetDialBack().GetNonce()) {
+		log.Debugf("received unknown dial back nonce from %s", s.Conn().RemotePeer())
+		s.Reset()
+		return
+	}
+	// Closing the stream signals the AutoNAT service that we processed the nonce.
+	s.Close()
+}
+
+// sendDialBack sends the nonce of an address probe on the dial-back connection c,
+// and waits until the peer processed it.
+func sendDialBack(ctx context.Context, c network.Conn, nonce uint64) error {
+	s, err := c.NewStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err := msmux.SelectProtoOrFail(AutoNATDialBackProto, s); err != nil {
+		s.Reset()
+		return err
+	}
+	if err := protoio.NewDelimitedWriter(s).WriteMsg(newDialBackMessage(nonce)); err != nil {
+		s.Reset()
+		return err
+	}
+	if err := s.CloseWrite(); err != nil {
+		s.Reset()
+		return err
+	}
+	// The peer closes the stream once it processed the nonce, and resets it if it didn't expect it.
+	if _, err := s.Read(make([]byte, 1)); err != io.EOF {
+		s.Reset()
+		if err == nil {
+			err = errors.New("unexpected data on dial back stream")
+		}
+		return err
+	}
+	return nil
+}
@@ -20,6 +20,72 @@ type AutoNAT interface {
 	io.Closer
 }
 
+// ReachabilityTracker is implemented by AutoNAT services that track the reachability
+// per IP address family and per address, like the ones returned by New.
+// It's optional: use a type assertion to check if an AutoNAT implements it.
+type ReachabilityTracker interface {
+	// FamilyStatus returns the current NAT status for an IP address family
+	FamilyStatus(f AddrFamily) network.Reachability
+	// AddrStatus returns the reachability of the host's addresses that were tested
+	// individually, keyed by their string representation. It returns nil if
+	// addresses are not tested individually, see WithAddrReachability.
+	AddrStatus() map[string]network.Reachability
+}
+
+// AddrFamily is an IP address family, identified by the code of its multiaddr protocol.
+type AddrFamily int
+
+const (
+	AddrFamilyIPv4 AddrFamily = ma.P_IP4
+	AddrFamilyIPv6 AddrFamily = ma.P_IP6
+)
+
+func (f AddrFamily) String() string {
+	switch f {
+	case AddrFamilyIPv4:
+		return "IPv4"
+	case AddrFamilyIPv6:
+		return "IPv6"
+	default:
+		return "unknown"
+	}
+}
+
+// AddrFamilyOf returns the IP address family of a. It returns false for relay
+// addresses, and for addresses that don't start with an IP address.
+func AddrFamilyOf(a ma.Multiaddr) (AddrFamily, bool) {
+	if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+		return 0, false
+	}
+	first, _ := ma.SplitFirst(a)
+	if first == nil {
+		return 0, false
+	}
+	switch first.Protocol().Code {
+	case ma.P_IP4:
+		return AddrFamilyIPv4, true
+	case ma.P_IP6:
+		return AddrFamilyIPv6, true
+	default:
+		return 0, false
+	}
+}
+
+// EvtFamilyReachabilityChanged is emitted alongside event.EvtLocalReachabilityChanged
+// when the reachability of the host over one IP address family changes.
+type EvtFamilyReachabilityChanged struct {
+	Family       AddrFamily
+	Reachability network.Reachability
+}
+
+// EvtAddrReachabilityChanged is emitted when the reachability of one of the host's
+// addresses changes. It is only emitted if addresses are tested individually, see
+// WithAddrReachability.
+type EvtAddrReachabilityChanged struct {
+	Addr         ma.Multiaddr
+	Reachability network.Reachability
+}
+
 // Client is a stateless client interface to AutoNAT peers
 type Client interface {
 	// DialBack requests from a peer providing AutoNAT services to test dial back
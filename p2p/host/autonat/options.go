@@ -17,6 +17,7 @@ type config struct {
 	dialer            network.Network
 	forceReachability bool
 	reachability      network.Reachability
+	addrReachability  bool
 
 	// client
 	bootDelay          time.Duration
@@ -30,8 +31,12 @@ type config struct {
 	maxPeerAddresses    int
 	throttleGlobalMax   int
 	throttlePeerMax     int
+	throttleSubnetMax   int
 	throttleResetPeriod time.Duration
 	throttleResetJitter time.Duration
+	dialBudget          time.Duration
+	maxConcurrentDials  int
+	allowIPMismatch     bool
 }
 
 var defaults = func(c *config) error {
@@ -142,3 +147,54 @@ func WithPeerThrottling(amount int) Option {
 		return nil
 	}
 }
+
+// WithAddrReachability enables testing the reachability of each of the host's
+// public addresses individually, in addition to the host's overall reachability.
+// Every probe additionally asks the AutoNAT service to dial back a single address,
+// the one that was tested least recently, and to prove that the dial back reached
+// us by sending a nonce on the dial-back connection.
+// The results are available via ReachabilityTracker.AddrStatus and EvtAddrReachabilityChanged.
+func WithAddrReachability() Option {
+	return func(c *config) error {
+		c.addrReachability = true
+		return nil
+	}
+}
+
+// WithSubnetThrottling specifies a limit for the maximum number of IP checks
+// this node will provide to all peers in the same subnet (/24 for IPv4, /48 for
+// IPv6) in each `interval`, see WithThrottling. By default, and with a value of 0,
+// there is no limit.
+func WithSubnetThrottling(amount int) Option {
+	return func(c *config) error {
+		c.throttleSubnetMax = amount
+		return nil
+	}
+}
+
+// WithDialBudget limits the resources this node spends on dialing back peers when
+// acting as a server: at most maxConcurrent dial backs run at the same time, and
+// dial backs take at most budget in total in each interval, see WithThrottling.
+// Note that failed dial backs always take the full dial timeout.
+// A value of 0 disables the respective limit.
+func WithDialBudget(budget time.Duration, maxConcurrent int) Option {
+	return func(c *config) error {
+		if budget < 0 || maxConcurrent < 0 {
+			return errors.New("dial budget can't be negative")
+		}
+		c.dialBudget = budget
+		c.maxConcurrentDials = maxConcurrent
+		return nil
+	}
+}
+
+// WithAllowIPMismatch allows this node, when acting as a server, to dial back
+// public addresses whose IP differs from the IP address observed on the connection
+// to the requesting peer. By default, all addresses are dialed on the observed IP
+// address instead. This always applies to addresses with private IPs.
+func WithAllowIPMismatch() Option {
+	return func(c *config) error {
+		c.allowIPMismatch = true
+		return nil
+	}
+}
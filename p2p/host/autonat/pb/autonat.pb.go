@@ -27,16 +27,19 @@ type Message_MessageType int32
 const (
 	Message_DIAL          Message_MessageType = 0
 	Message_DIAL_RESPONSE Message_MessageType = 1
+	Message_DIAL_BACK     Message_MessageType = 2
 )
 
 var Message_MessageType_name = map[int32]string{
 	0: "DIAL",
 	1: "DIAL_RESPONSE",
+	2: "DIAL_BACK",
 }
 
 var Message_MessageType_value = map[string]int32{
 	"DIAL":          0,
 	"DIAL_RESPONSE": 1,
+	"DIAL_BACK":     2,
 }
 
 func (x Message_MessageType) Enum() *Message_MessageType {
@@ -115,6 +118,7 @@ type Message struct {
 	Type                 *Message_MessageType  `protobuf:"varint,1,opt,name=type,enum=autonat.pb.Message_MessageType" json:"type,omitempty"`
 	Dial                 *Message_Dial         `protobuf:"bytes,2,opt,name=dial" json:"dial,omitempty"`
 	DialResponse         *Message_DialResponse `protobuf:"bytes,3,opt,name=dialResponse" json:"dialResponse,omitempty"`
+	DialBack             *Message_DialBack     `protobuf:"bytes,4,opt,name=dialBack" json:"dialBack,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
 	XXX_unrecognized     []byte                `json:"-"`
 	XXX_sizecache        int32                 `json:"-"`
@@ -174,6 +178,13 @@ func (m *Message) GetDialResponse() *Message_DialResponse {
 	return nil
 }
 
+func (m *Message) GetDialBack() *Message_DialBack {
+	if m != nil {
+		return m.DialBack
+	}
+	return nil
+}
+
 type Message_PeerInfo struct {
 	Id                   []byte   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
 	Addrs                [][]byte `protobuf:"bytes,2,rep,name=addrs" json:"addrs,omitempty"`
@@ -231,6 +242,7 @@ func (m *Message_PeerInfo) GetAddrs() [][]byte {
 
 type Message_Dial struct {
 	Peer                 *Message_PeerInfo `protobuf:"bytes,1,opt,name=peer" json:"peer,omitempty"`
+	Nonce                *uint64           `protobuf:"varint,2,opt,name=nonce" json:"nonce,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
 	XXX_unrecognized     []byte            `json:"-"`
 	XXX_sizecache        int32             `json:"-"`
@@ -276,6 +288,13 @@ func (m *Message_Dial) GetPeer() *Message_PeerInfo {
 	return nil
 }
 
+func (m *Message_Dial) GetNonce() uint64 {
+	if m != nil && m.Nonce != nil {
+		return *m.Nonce
+	}
+	return 0
+}
+
 type Message_DialResponse struct {
 	Status               *Message_ResponseStatus `protobuf:"varint,1,opt,name=status,enum=autonat.pb.Message_ResponseStatus" json:"status,omitempty"`
 	StatusText           *string                 `protobuf:"bytes,2,opt,name=statusText" json:"statusText,omitempty"`
@@ -339,6 +358,53 @@ func (m *Message_DialResponse) GetAddr() []byte {
 	return nil
 }
 
+type Message_DialBack struct {
+	Nonce                *uint64  `protobuf:"varint,1,opt,name=nonce" json:"nonce,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Message_DialBack) Reset()         { *m = Message_DialBack{} }
+func (m *Message_DialBack) String() string { return proto.CompactTextString(m) }
+func (*Message_DialBack) ProtoMessage()    {}
+func (*Message_DialBack) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a04e278ef61ac07a, []int{0, 3}
+}
+func (m *Message_DialBack) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Message_DialBack) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Message_DialBack.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *Message_DialBack) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message_DialBack.Merge(m, src)
+}
+func (m *Message_DialBack) XXX_Size() int {
+	return m.Size()
+}
+func (m *Message_DialBack) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message_DialBack.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message_DialBack proto.InternalMessageInfo
+
+func (m *Message_DialBack) GetNonce() uint64 {
+	if m != nil && m.Nonce != nil {
+		return *m.Nonce
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterEnum("autonat.pb.Message_MessageType", Message_MessageType_name, Message_MessageType_value)
 	proto.RegisterEnum("autonat.pb.Message_ResponseStatus", Message_ResponseStatus_name, Message_ResponseStatus_value)
@@ -346,36 +412,40 @@ func init() {
 	proto.RegisterType((*Message_PeerInfo)(nil), "autonat.pb.Message.PeerInfo")
 	proto.RegisterType((*Message_Dial)(nil), "autonat.pb.Message.Dial")
 	proto.RegisterType((*Message_DialResponse)(nil), "autonat.pb.Message.DialResponse")
+	proto.RegisterType((*Message_DialBack)(nil), "autonat.pb.Message.DialBack")
 }
 
 func init() { proto.RegisterFile("autonat.proto", fileDescriptor_a04e278ef61ac07a) }
 
 var fileDescriptor_a04e278ef61ac07a = []byte{
-	// 372 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x90, 0xcf, 0x8a, 0xda, 0x50,
-	0x14, 0xc6, 0xbd, 0x31, 0xb5, 0xf6, 0x18, 0xc3, 0xed, 0xa1, 0x85, 0x20, 0x25, 0x0d, 0x59, 0x49,
-	0x29, 0x22, 0x76, 0x53, 0xba, 0x53, 0x72, 0x0b, 0xd2, 0x56, 0xed, 0x49, 0x5c, 0x87, 0x94, 0xdc,
-	0x0e, 0x01, 0x31, 0x21, 0x89, 0x30, 0x6e, 0xe6, 0x89, 0x66, 0x3b, 0xef, 0xe0, 0x72, 0x1e, 0x61,
-	0xf0, 0x49, 0x86, 0x5c, 0xa3, 0xa3, 0xe0, 0xac, 0xce, 0x1f, 0x7e, 0xdf, 0x39, 0x1f, 0x1f, 0x74,
-	0xa3, 0x4d, 0x99, 0xae, 0xa3, 0x72, 0x90, 0xe5, 0x69, 0x99, 0x22, 0x9c, 0xc6, 0x7f, 0xee, 0x83,
-	0x0e, 0x6f, 0xff, 0xc8, 0xa2, 0x88, 0x6e, 0x24, 0x7e, 0x03, 0xbd, 0xdc, 0x66, 0xd2, 0x62, 0x0e,
-	0xeb, 0x9b, 0xa3, 0xcf, 0x83, 0x17, 0x6c, 0x50, 0x23, 0xc7, 0x1a, 0x6c, 0x33, 0x49, 0x0a, 0xc6,
-	0xaf, 0xa0, 0xc7, 0x49, 0xb4, 0xb2, 0x34, 0x87, 0xf5, 0x3b, 0x23, 0xeb, 0x9a, 0xc8, 0x4b, 0xa2,
-	0x15, 0x29, 0x0a, 0x3d, 0x30, 0xaa, 0x4a, 0xb2, 0xc8, 0xd2, 0x75, 0x21, 0xad, 0xa6, 0x52, 0x39,
-	0xaf, 0xaa, 0x6a, 0x8e, 0x2e, 0x54, 0xbd, 0x21, 0xb4, 0x17, 0x52, 0xe6, 0xd3, 0xf5, 0xff, 0x14,
-	0x4d, 0xd0, 0x92, 0x58, 0x59, 0x36, 0x48, 0x4b, 0x62, 0xfc, 0x00, 0x6f, 0xa2, 0x38, 0xce, 0x0b,
-	0x4b, 0x73, 0x9a, 0x7d, 0x83, 0x0e, 0x43, 0xef, 0x3b, 0xe8, 0xd5, 0x3d, 0x1c, 0x82, 0x9e, 0x49,
-	0x99, 0x2b, 0xbe, 0x33, 0xfa, 0x74, 0xed, 0xef, 0xf1, 0x32, 0x29, 0xb2, 0x77, 0x07, 0xc6, 0xb9,
-	0x13, 0xfc, 0x01, 0xad, 0xa2, 0x8c, 0xca, 0x4d, 0x51, 0xc7, 0xe4, 0x5e, 0xbb, 0x71, 0xa4, 0x7d,
-	0x45, 0x52, 0xad, 0x40, 0x1b, 0xe0, 0xd0, 0x05, 0xf2, 0xb6, 0x54, 0x89, 0xbd, 0xa3, 0xb3, 0x0d,
-	0x22, 0xe8, 0x95, 0x5d, 0x95, 0x8a, 0x41, 0xaa, 0x77, 0xbf, 0x40, 0xe7, 0x2c, 0x74, 0x6c, 0x83,
-	0xee, 0x4d, 0xc7, 0xbf, 0x79, 0x03, 0xdf, 0x43, 0xb7, 0xea, 0x42, 0x12, 0xfe, 0x62, 0x3e, 0xf3,
-	0x05, 0x67, 0x6e, 0x02, 0xe6, 0xe5, 0x67, 0x6c, 0x81, 0x36, 0xff, 0xc5, 0x1b, 0xc8, 0xc1, 0x10,
-	0xa1, 0xc2, 0x05, 0xd1, 0x9c, 0x78, 0x8c, 0x08, 0x66, 0xbd, 0x21, 0xf1, 0x73, 0xe9, 0x0b, 0x8f,
-	0x4b, 0x44, 0xe8, 0x8a, 0x70, 0x32, 0xf6, 0x42, 0x12, 0x7f, 0x97, 0xc2, 0x0f, 0xf8, 0x8e, 0xe1,
-	0x47, 0xe0, 0x22, 0x9c, 0xce, 0x02, 0x41, 0xb3, 0x93, 0xfa, 0x5e, 0x9b, 0x18, 0xbb, 0xbd, 0xcd,
-	0x1e, 0xf7, 0x36, 0x7b, 0xda, 0xdb, 0xec, 0x39, 0x00, 0x00, 0xff, 0xff, 0x8e, 0xe2, 0x93, 0x4e,
-	0x61, 0x02, 0x00, 0x00,
+	// 422 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x91, 0xcf, 0x6e, 0xd3, 0x40,
+	0x10, 0xc6, 0xbb, 0xee, 0xb6, 0xa4, 0x53, 0x27, 0x5a, 0x46, 0x20, 0x59, 0x11, 0x0a, 0x56, 0x4e,
+	0x39, 0xa0, 0xa8, 0x2a, 0x17, 0xe0, 0x16, 0xe3, 0x45, 0x8a, 0x0a, 0x4e, 0x19, 0xbb, 0x67, 0x6b,
+	0xa9, 0x17, 0x64, 0x51, 0xd9, 0x96, 0xed, 0x4a, 0xf4, 0xc2, 0x13, 0x71, 0xe6, 0x19, 0x7a, 0xe4,
+	0x11, 0x50, 0x9e, 0xa4, 0xf2, 0xc6, 0x4e, 0x5d, 0x29, 0x39, 0xed, 0xcc, 0xe8, 0xf7, 0x7d, 0xf3,
+	0x67, 0x61, 0xa8, 0x6e, 0xeb, 0x3c, 0x53, 0xf5, 0xbc, 0x28, 0xf3, 0x3a, 0x47, 0xd8, 0xa6, 0xdf,
+	0xa6, 0x7f, 0x8f, 0xe0, 0xd9, 0x17, 0x5d, 0x55, 0xea, 0x87, 0xc6, 0xb7, 0xc0, 0xeb, 0xbb, 0x42,
+	0x3b, 0xcc, 0x65, 0xb3, 0xd1, 0xf9, 0xeb, 0xf9, 0x23, 0x36, 0x6f, 0x91, 0xee, 0x8d, 0xee, 0x0a,
+	0x4d, 0x06, 0xc6, 0x37, 0xc0, 0x93, 0x54, 0xdd, 0x38, 0x96, 0xcb, 0x66, 0xa7, 0xe7, 0xce, 0x2e,
+	0x91, 0x9f, 0xaa, 0x1b, 0x32, 0x14, 0xfa, 0x60, 0x37, 0x2f, 0xe9, 0xaa, 0xc8, 0xb3, 0x4a, 0x3b,
+	0x87, 0x46, 0xe5, 0xee, 0x55, 0xb5, 0x1c, 0x3d, 0x51, 0xe1, 0x3b, 0x18, 0x34, 0xb9, 0xa7, 0xae,
+	0x7f, 0x3a, 0xdc, 0x38, 0xbc, 0xda, 0xe7, 0xd0, 0x30, 0xb4, 0xa5, 0xc7, 0x67, 0x30, 0xb8, 0xd4,
+	0xba, 0x5c, 0x66, 0xdf, 0x73, 0x1c, 0x81, 0x95, 0x26, 0x66, 0x59, 0x9b, 0xac, 0x34, 0xc1, 0x17,
+	0x70, 0xa4, 0x92, 0xa4, 0xac, 0x1c, 0xcb, 0x3d, 0x9c, 0xd9, 0xb4, 0x49, 0xc6, 0x01, 0xf0, 0xc6,
+	0x07, 0xcf, 0x80, 0x17, 0x5a, 0x97, 0x86, 0xdf, 0xd3, 0xaf, 0x73, 0x26, 0x43, 0x36, 0x7e, 0x59,
+	0x9e, 0x5d, 0x6b, 0x73, 0x1a, 0x4e, 0x9b, 0x64, 0xfc, 0x1b, 0xec, 0xfe, 0x66, 0xf8, 0x01, 0x8e,
+	0xab, 0x5a, 0xd5, 0xb7, 0x55, 0x7b, 0xf6, 0xe9, 0x2e, 0xe7, 0x8e, 0x0e, 0x0d, 0x49, 0xad, 0x02,
+	0x27, 0x00, 0x9b, 0x28, 0xd2, 0xbf, 0x6a, 0xd3, 0xe6, 0x84, 0x7a, 0x15, 0x44, 0xe0, 0xcd, 0x12,
+	0xe6, 0xca, 0x36, 0x99, 0x78, 0xec, 0xc2, 0xa0, 0xbb, 0xcb, 0xe3, 0x84, 0xac, 0x37, 0xe1, 0xf4,
+	0x3d, 0x9c, 0xf6, 0xbe, 0x19, 0x07, 0xc0, 0xfd, 0xe5, 0xe2, 0xb3, 0x38, 0xc0, 0xe7, 0x30, 0x6c,
+	0xa2, 0x98, 0x64, 0x78, 0xb9, 0x0a, 0x42, 0x29, 0x18, 0x0e, 0xe1, 0xc4, 0x94, 0xbc, 0xc5, 0xc7,
+	0x0b, 0x61, 0x4d, 0x53, 0x18, 0x3d, 0x1d, 0x15, 0x8f, 0xc1, 0x5a, 0x5d, 0x88, 0x03, 0x14, 0x60,
+	0xcb, 0xd8, 0xa0, 0x92, 0x68, 0x45, 0x22, 0x41, 0x84, 0x51, 0x5b, 0x21, 0xf9, 0xe9, 0x2a, 0x94,
+	0xbe, 0xd0, 0x88, 0x30, 0x94, 0xb1, 0xb7, 0xf0, 0x63, 0x92, 0x5f, 0xaf, 0x64, 0x18, 0x89, 0x7b,
+	0x86, 0x2f, 0x41, 0xc8, 0x78, 0x19, 0x44, 0x92, 0x82, 0xad, 0xfa, 0x8f, 0xe5, 0xd9, 0xf7, 0xeb,
+	0x09, 0xfb, 0xb7, 0x9e, 0xb0, 0xff, 0xeb, 0x09, 0x7b, 0x08, 0x00, 0x00, 0xff, 0xff, 0x40, 0xf8,
+	0x1b, 0x29, 0xe2, 0x02, 0x00, 0x00,
 }
 
 func (m *Message) Marshal() (dAtA []byte, err error) {
@@ -402,6 +472,18 @@ func (m *Message) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i -= len(m.XXX_unrecognized)
 		copy(dAtA[i:], m.XXX_unrecognized)
 	}
+	if m.DialBack != nil {
+		{
+			size, err := m.DialBack.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintAutonat(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x22
+	}
 	if m.DialResponse != nil {
 		{
 			size, err := m.DialResponse.MarshalToSizedBuffer(dAtA[:i])
@@ -501,6 +583,11 @@ func (m *Message_Dial) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i -= len(m.XXX_unrecognized)
 		copy(dAtA[i:], m.XXX_unrecognized)
 	}
+	if m.Nonce != nil {
+		i = encodeVarintAutonat(dAtA, i, uint64(*m.Nonce))
+		i--
+		dAtA[i] = 0x10
+	}
 	if m.Peer != nil {
 		{
 			size, err := m.Peer.MarshalToSizedBuffer(dAtA[:i])
@@ -562,6 +649,38 @@ func (m *Message_DialResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *Message_DialBack) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Message_DialBack) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Message_DialBack) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.Nonce != nil {
+		i = encodeVarintAutonat(dAtA, i, uint64(*m.Nonce))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintAutonat(dAtA []byte, offset int, v uint64) int {
 	offset -= sovAutonat(v)
 	base := offset
@@ -590,6 +709,10 @@ func (m *Message) Size() (n int) {
 		l = m.DialResponse.Size()
 		n += 1 + l + sovAutonat(uint64(l))
 	}
+	if m.DialBack != nil {
+		l = m.DialBack.Size()
+		n += 1 + l + sovAutonat(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -628,6 +751,9 @@ func (m *Message_Dial) Size() (n int) {
 		l = m.Peer.Size()
 		n += 1 + l + sovAutonat(uint64(l))
 	}
+	if m.Nonce != nil {
+		n += 1 + sovAutonat(uint64(*m.Nonce))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -657,6 +783,21 @@ func (m *Message_DialResponse) Size() (n int) {
 	return n
 }
 
+func (m *Message_DialBack) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Nonce != nil {
+		n += 1 + sovAutonat(uint64(*m.Nonce))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
 func sovAutonat(x uint64) (n int) {
 	return (math_bits.Len64(x|1) + 6) / 7
 }
@@ -784,16 +925,49 @@ func (m *Message) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DialBack", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowAutonat
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthAutonat
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthAutonat
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.DialBack == nil {
+				m.DialBack = &Message_DialBack{}
+			}
+			if err := m.DialBack.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipAutonat(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthAutonat
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthAutonat
 			}
 			if (iNdEx + skippy) > l {
@@ -910,10 +1084,7 @@ func (m *Message_PeerInfo) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthAutonat
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthAutonat
 			}
 			if (iNdEx + skippy) > l {
@@ -994,16 +1165,33 @@ func (m *Message_Dial) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nonce", wireType)
+			}
+			var v uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowAutonat
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Nonce = &v
 		default:
 			iNdEx = preIndex
 			skippy, err := skipAutonat(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthAutonat
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthAutonat
 			}
 			if (iNdEx + skippy) > l {
@@ -1141,10 +1329,78 @@ func (m *Message_DialResponse) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthAutonat
 			}
-			if (iNdEx + skippy) < 0 {
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Message_DialBack) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowAutonat
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DialBack: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DialBack: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nonce", wireType)
+			}
+			var v uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowAutonat
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Nonce = &v
+		default:
+			iNdEx = preIndex
+			skippy, err := skipAutonat(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthAutonat
 			}
 			if (iNdEx + skippy) > l {
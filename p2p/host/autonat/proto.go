@@ -11,6 +11,10 @@ import (
 // AutoNATProto identifies the autonat service protocol
 const AutoNATProto = "/libp2p/autonat/1.0.0"
 
+// AutoNATDialBackProto identifies the protocol that AutoNAT services use to send the
+// nonce of an address probe on the dial-back connection
+const AutoNATDialBackProto = "/libp2p/autonat/dialback/1.0.0"
+
 func newDialMessage(pi peer.AddrInfo) *pb.Message {
 	msg := new(pb.Message)
 	msg.Type = pb.Message_DIAL.Enum()
@@ -25,6 +29,14 @@ func newDialMessage(pi peer.AddrInfo) *pb.Message {
 	return msg
 }
 
+func newDialBackMessage(nonce uint64) *pb.Message {
+	msg := new(pb.Message)
+	msg.Type = pb.Message_DIAL_BACK.Enum()
+	msg.DialBack = new(pb.Message_DialBack)
+	msg.DialBack.Nonce = &nonce
+	return msg
+}
+
 func newDialResponseOK(addr ma.Multiaddr) *pb.Message_DialResponse {
 	dr := new(pb.Message_DialResponse)
 	dr.Status = pb.Message_OK.Enum()
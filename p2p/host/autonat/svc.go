@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"math/rand"
+	"net"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 
 	"github.com/libp2p/go-msgio/protoio"
 	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 )
 
 var streamTimeout = 60 * time.Second
@@ -36,7 +38,11 @@ type autoNATService struct {
 	// rate limiter
 	mx         sync.Mutex
 	reqs       map[peer.ID]int
+	subnetReqs map[string]int
 	globalReqs int
+	// dial budget
+	ongoingDials int
+	dialTime     time.Duration
 }
 
 // NewAutoNATService creates a new AutoNATService instance attached to a host
@@ -45,8 +51,9 @@ func newAutoNATService(c *config) (*autoNATService, error) {
 		return nil, errors.New("cannot create NAT service without a network")
 	}
 	return &autoNATService{
-		config: c,
-		reqs:   make(map[peer.ID]int),
+		config:     c,
+		reqs:       make(map[peer.ID]int),
+		subnetReqs: make(map[string]int),
 	}, nil
 }
 
@@ -90,7 +97,7 @@ func (as *autoNATService) handleStream(s network.Stream) {
 		return
 	}
 
-	dr := as.handleDial(pid, s.Conn().RemoteMultiaddr(), req.GetDial().GetPeer())
+	dr := as.handleDial(pid, s.Conn().RemoteMultiaddr(), req.GetDial().GetPeer(), req.GetDial().Nonce)
 	res.Type = pb.Message_DIAL_RESPONSE.Enum()
 	res.DialResponse = dr
 
@@ -102,7 +109,10 @@ func (as *autoNATService) handleStream(s network.Stream) {
 	}
 }
 
-func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Message_PeerInfo) *pb.Message_DialResponse {
+// handleDial handles a dial request. If the request contains a nonce, it is an address probe:
+// we only dial the first dialable address of the request, and send the nonce on the dial-back
+// connection.
+func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Message_PeerInfo, nonce *uint64) *pb.Message_DialResponse {
 	if mpi == nil {
 		return newDialResponseError(pb.Message_E_BAD_REQUEST, "missing peer info")
 	}
@@ -140,9 +150,14 @@ func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Me
 		return newDialResponseError(pb.Message_E_INTERNAL_ERROR, "expected an IP address")
 	}
 
-	// add observed addr to the list of addresses to dial
-	addrs = append(addrs, obsaddr)
-	seen[obsaddr.String()] = struct{}{}
+	maxAddrs := as.config.maxPeerAddresses
+	if nonce != nil {
+		maxAddrs = 1
+	} else {
+		// add observed addr to the list of addresses to dial
+		addrs = append(addrs, obsaddr)
+		seen[obsaddr.String()] = struct{}{}
+	}
 
 	for _, maddr := range mpi.GetAddrs() {
 		addr, err := ma.NewMultiaddrBytes(maddr)
@@ -151,7 +166,8 @@ func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Me
 			continue
 		}
 
-		// For security reasons, we _only_ dial the observed IP address.
+		// For security reasons, we _only_ dial the observed IP address, unless dialing
+		// other public IP addresses is explicitly allowed.
 		// Replace other IP addresses with the observed one so we can still try the
 		// requested ports/transports.
 		if ip, rest := ma.SplitFirst(addr); !ip.Equal(hostIP) {
@@ -161,9 +177,11 @@ func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Me
 			default:
 				continue
 			}
-			addr = hostIP
-			if rest != nil {
-				addr = addr.Encapsulate(rest)
+			if !as.config.allowIPMismatch || !manet.IsPublicAddr(ip) {
+				addr = hostIP
+				if rest != nil {
+					addr = addr.Encapsulate(rest)
+				}
 			}
 		}
 
@@ -182,7 +200,7 @@ func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Me
 		addrs = append(addrs, addr)
 		seen[str] = struct{}{}
 
-		if len(addrs) >= as.config.maxPeerAddresses {
+		if len(addrs) >= maxAddrs {
 			break
 		}
 	}
@@ -192,10 +210,10 @@ func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Me
 		return newDialResponseError(pb.Message_E_DIAL_REFUSED, "no dialable addresses")
 	}
 
-	return as.doDial(peer.AddrInfo{ID: p, Addrs: addrs})
+	return as.doDial(peer.AddrInfo{ID: p, Addrs: addrs}, subnetKey(hostIP), nonce)
 }
 
-func (as *autoNATService) doDial(pi peer.AddrInfo) *pb.Message_DialResponse {
+func (as *autoNATService) doDial(pi peer.AddrInfo, subnet string, nonce *uint64) *pb.Message_DialResponse {
 	// rate limit check
 	as.mx.Lock()
 	count := as.reqs[pi.ID]
@@ -204,10 +222,29 @@ func (as *autoNATService) doDial(pi peer.AddrInfo) *pb.Message_DialResponse {
 		as.mx.Unlock()
 		return newDialResponseError(pb.Message_E_DIAL_REFUSED, "too many dials")
 	}
+	if as.config.throttleSubnetMax > 0 && as.subnetReqs[subnet] >= as.config.throttleSubnetMax {
+		as.mx.Unlock()
+		return newDialResponseError(pb.Message_E_DIAL_REFUSED, "too many dials from subnet")
+	}
+	if (as.config.maxConcurrentDials > 0 && as.ongoingDials >= as.config.maxConcurrentDials) ||
+		(as.config.dialBudget > 0 && as.dialTime >= as.config.dialBudget) {
+		as.mx.Unlock()
+		return newDialResponseError(pb.Message_E_DIAL_REFUSED, "dial budget exhausted")
+	}
 	as.reqs[pi.ID] = count + 1
+	as.subnetReqs[subnet]++
 	as.globalReqs++
+	as.ongoingDials++
 	as.mx.Unlock()
 
+	start := time.Now()
+	defer func() {
+		as.mx.Lock()
+		as.ongoingDials--
+		as.dialTime += time.Since(start)
+		as.mx.Unlock()
+	}()
+
 	ctx, cancel := context.WithTimeout(context.Background(), as.config.dialTimeout)
 	defer cancel()
 
@@ -230,10 +267,30 @@ func (as *autoNATService) doDial(pi peer.AddrInfo) *pb.Message_DialResponse {
 	}
 
 	ra := conn.RemoteMultiaddr()
+	if nonce != nil {
+		if err := sendDialBack(ctx, conn, *nonce); err != nil {
+			log.Debugf("error sending dial back nonce to %s: %s", pi.ID.Pretty(), err.Error())
+			as.config.dialer.ClosePeer(pi.ID)
+			return newDialResponseError(pb.Message_E_DIAL_ERROR, "dial back failed")
+		}
+	}
 	as.config.dialer.ClosePeer(pi.ID)
 	return newDialResponseOK(ra)
 }
 
+// subnetKey returns the subnet of the IP address of a that requests are throttled by:
+// the /24 for IPv4 addresses and the /48 for IPv6 addresses.
+func subnetKey(a ma.Multiaddr) string {
+	ip, err := manet.ToIP(a)
+	if err != nil {
+		return a.String()
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
 // Enable the autoNAT service if it is not running.
 func (as *autoNATService) Enable() {
 	as.instanceLock.Lock()
@@ -272,7 +329,9 @@ func (as *autoNATService) background(ctx context.Context) {
 		case <-timer.C:
 			as.mx.Lock()
 			as.reqs = make(map[peer.ID]int)
+			as.subnetReqs = make(map[string]int)
 			as.globalReqs = 0
+			as.dialTime = 0
 			as.mx.Unlock()
 			jitter := rand.Float32() * float32(as.config.throttleResetJitter)
 			timer.Reset(as.config.throttleResetPeriod + time.Duration(int64(jitter)))
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	pb "github.com/libp2p/go-libp2p/p2p/host/autonat/pb"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 
@@ -89,6 +90,38 @@ func TestAutoNATServiceDialSuccess(t *testing.T) {
 	}
 }
 
+func TestAutoNATServiceAddrProbe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+	_ = makeAutoNATService(t, c)
+
+	hc := bhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer hc.Close()
+	v := newDialBackVerifier()
+	hc.SetStreamHandler(AutoNATDialBackProto, v.handleStream)
+	cli := &client{h: hc, addrFunc: hc.Addrs, verifier: v}
+	connect(t, c.host, hc)
+
+	for _, a := range hc.Addrs() {
+		require.NoError(t, cli.dialBackAddr(ctx, c.host.ID(), a), "probing %s", a)
+	}
+
+	// servers that don't send the nonce can't confirm the reachability of an address
+	hs := makeAutoNATServicePublic(t)
+	defer hs.Close()
+	connect(t, hs, hc)
+	require.ErrorIs(t, cli.dialBackAddr(ctx, hs.ID(), hc.Addrs()[0]), errDialBackUnverified)
+
+	// a client that isn't able to verify the nonce fails the probe
+	hc.RemoveStreamHandler(AutoNATDialBackProto)
+	err := cli.dialBackAddr(ctx, c.host.ID(), hc.Addrs()[0])
+	require.True(t, IsDialError(err), "expected dial error, got %v", err)
+}
+
 func TestAutoNATServiceDialRateLimiter(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -169,6 +202,123 @@ func TestAutoNATServiceGlobalLimiter(t *testing.T) {
 	}
 }
 
+func TestAutoNATServiceSubnetLimiter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+
+	c.throttleResetPeriod = 10 * time.Second
+	c.throttleResetJitter = 0
+	c.throttleSubnetMax = 2
+	_ = makeAutoNATService(t, c)
+
+	// all clients connect from 127.0.0.1
+	for i := 0; i < 2; i++ {
+		hc, ac := makeAutoNATClient(t)
+		defer hc.Close()
+		connect(t, c.host, hc)
+		_, err := ac.DialBack(ctx, c.host.ID())
+		require.NoError(t, err)
+	}
+
+	hc, ac := makeAutoNATClient(t)
+	defer hc.Close()
+	connect(t, c.host, hc)
+	_, err := ac.DialBack(ctx, c.host.ID())
+	require.True(t, IsDialRefused(err), "expected dial refused, got %v", err)
+}
+
+func TestAutoNATServiceDialBudget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+
+	c.throttleResetPeriod = 10 * time.Second
+	c.throttleResetJitter = 0
+	c.dialBudget = time.Hour
+	c.maxConcurrentDials = 1
+	svc := makeAutoNATService(t, c)
+
+	hc, ac := makeAutoNATClient(t)
+	defer hc.Close()
+	connect(t, c.host, hc)
+
+	// all dial slots are in use
+	svc.mx.Lock()
+	svc.ongoingDials = 1
+	svc.mx.Unlock()
+	_, err := ac.DialBack(ctx, c.host.ID())
+	require.True(t, IsDialRefused(err), "expected dial refused, got %v", err)
+
+	svc.mx.Lock()
+	svc.ongoingDials = 0
+	svc.mx.Unlock()
+	_, err = ac.DialBack(ctx, c.host.ID())
+	require.NoError(t, err)
+
+	// the dial time budget is used up
+	svc.mx.Lock()
+	svc.dialTime = time.Hour
+	svc.mx.Unlock()
+	_, err = ac.DialBack(ctx, c.host.ID())
+	require.True(t, IsDialRefused(err), "expected dial refused, got %v", err)
+}
+
+func TestAutoNATServiceIPMismatch(t *testing.T) {
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+	c.dialTimeout = 500 * time.Millisecond
+	c.throttlePeerMax = 10
+	svc := makeAutoNATService(t, c)
+	defer svc.Disable()
+
+	hc, _ := makeAutoNATClient(t)
+	defer hc.Close()
+	var port string
+	for _, a := range hc.Addrs() {
+		if p, err := a.ValueForProtocol(ma.P_TCP); err == nil {
+			port = p
+			break
+		}
+	}
+	require.NotEmpty(t, port)
+	// nothing listens on the port of the observed address
+	obsAddr := ma.StringCast("/ip4/127.0.0.1/tcp/1")
+	req := func(addr string) *pb.Message_PeerInfo {
+		return &pb.Message_PeerInfo{Addrs: [][]byte{ma.StringCast(addr).Bytes()}}
+	}
+
+	// addresses with a different IP are dialed on the observed IP
+	for _, addr := range []string{"/ip4/5.6.7.8/tcp/", "/ip4/192.168.1.1/tcp/"} {
+		res := svc.handleDial(hc.ID(), obsAddr, req(addr+port), nil)
+		require.Equal(t, pb.Message_OK, res.GetStatus(), addr)
+		a, err := ma.NewMultiaddrBytes(res.GetAddr())
+		require.NoError(t, err)
+		require.Equal(t, "/ip4/127.0.0.1/tcp/"+port, a.String())
+	}
+
+	// unless dialing other public IP addresses is allowed
+	c.allowIPMismatch = true
+	res := svc.handleDial(hc.ID(), obsAddr, req("/ip4/5.6.7.8/tcp/"+port), nil)
+	require.Equal(t, pb.Message_E_DIAL_ERROR, res.GetStatus())
+	res = svc.handleDial(hc.ID(), obsAddr, req("/ip4/192.168.1.1/tcp/"+port), nil)
+	require.Equal(t, pb.Message_OK, res.GetStatus())
+}
+
+func TestSubnetKey(t *testing.T) {
+	require.Equal(t, subnetKey(ma.StringCast("/ip4/1.2.3.4/tcp/1")), subnetKey(ma.StringCast("/ip4/1.2.3.200/udp/1/quic")))
+	require.NotEqual(t, subnetKey(ma.StringCast("/ip4/1.2.3.4/tcp/1")), subnetKey(ma.StringCast("/ip4/1.2.4.4/tcp/1")))
+	require.Equal(t, subnetKey(ma.StringCast("/ip6/2001:db8:1::1/tcp/1")), subnetKey(ma.StringCast("/ip6/2001:db8:1:ffff::1/tcp/1")))
+	require.NotEqual(t, subnetKey(ma.StringCast("/ip6/2001:db8:1::1/tcp/1")), subnetKey(ma.StringCast("/ip6/2001:db8:2::1/tcp/1")))
+}
+
 func TestAutoNATServiceRateLimitJitter(t *testing.T) {
 	c := makeAutoNATConfig(t)
 	defer c.host.Close()
@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 
+	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	basic "github.com/libp2p/go-libp2p/p2p/host/basic"
 
 	"github.com/libp2p/go-libp2p-core/event"
@@ -13,6 +14,7 @@ import (
 
 	logging "github.com/ipfs/go-log/v2"
 	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 )
 
 var log = logging.Logger("autorelay")
@@ -26,6 +28,10 @@ type AutoRelay struct {
 
 	mx     sync.Mutex
 	status network.Reachability
+	// reachability per IP address family, as reported by AutoNAT
+	familyStatus map[autonat.AddrFamily]network.Reachability
+	// NAT device type per transport, as classified by identify
+	natDeviceType map[network.NATTransportProtocol]network.NATDeviceType
 
 	relayFinder *relayFinder
 
@@ -37,9 +43,11 @@ type AutoRelay struct {
 
 func NewAutoRelay(bhost *basic.BasicHost, opts ...Option) (*AutoRelay, error) {
 	r := &AutoRelay{
-		host:   bhost,
-		addrsF: bhost.AddrsFactory,
-		status: network.ReachabilityUnknown,
+		host:          bhost,
+		addrsF:        bhost.AddrsFactory,
+		status:        network.ReachabilityUnknown,
+		familyStatus:  make(map[autonat.AddrFamily]network.Reachability),
+		natDeviceType: make(map[network.NATTransportProtocol]network.NATDeviceType),
 	}
 	conf := defaultConfig
 	for _, opt := range opts {
@@ -62,12 +70,27 @@ func NewAutoRelay(bhost *basic.BasicHost, opts ...Option) (*AutoRelay, error) {
 }
 
 func (r *AutoRelay) background() {
-	subReachability, err := r.host.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	subReachability, err := r.host.EventBus().Subscribe([]interface{}{
+		new(event.EvtLocalReachabilityChanged),
+		new(autonat.EvtFamilyReachabilityChanged),
+		new(event.EvtNATDeviceTypeChanged),
+	})
 	if err != nil {
 		log.Debug("failed to subscribe to the EvtLocalReachabilityChanged")
 		return
 	}
 	defer subReachability.Close()
+	// Family reachability events emitted before we subscribed are lost,
+	// so start with the current status of the host's AutoNAT, if it tracks it.
+	if ah, ok := r.host.(interface{ GetAutoNat() autonat.AutoNAT }); ok {
+		if rt, ok := ah.GetAutoNat().(autonat.ReachabilityTracker); ok {
+			r.mx.Lock()
+			for _, f := range []autonat.AddrFamily{autonat.AddrFamilyIPv4, autonat.AddrFamilyIPv6} {
+				r.familyStatus[f] = rt.FamilyStatus(f)
+			}
+			r.mx.Unlock()
+		}
+	}
 
 	var peerChan <-chan peer.AddrInfo
 	if len(r.conf.staticRelays) == 0 {
@@ -88,6 +111,19 @@ func (r *AutoRelay) background() {
 		}()
 	}
 
+	var peerstoreChan chan peer.AddrInfo
+	if r.conf.peerstoreSource {
+		peerstoreChan = make(chan peer.AddrInfo)
+		ps := newPeerstoreSource(r.host, r.conf)
+		r.refCount.Add(1)
+		go func() {
+			defer r.refCount.Done()
+			ps.run(r.ctx, peerstoreChan)
+		}()
+	}
+
+	// Several events can lead to the same decision. Only start and stop the relay finder on changes.
+	var finderRunning bool
 	for {
 		select {
 		case <-r.ctx.Done():
@@ -97,45 +133,104 @@ func (r *AutoRelay) background() {
 				return
 			}
 			// TODO: push changed addresses
-			evt := ev.(event.EvtLocalReachabilityChanged)
-			switch evt.Reachability {
-			case network.ReachabilityPrivate, network.ReachabilityUnknown:
+			r.mx.Lock()
+			switch evt := ev.(type) {
+			case event.EvtLocalReachabilityChanged:
+				r.status = evt.Reachability
+			case autonat.EvtFamilyReachabilityChanged:
+				r.familyStatus[evt.Family] = evt.Reachability
+			case event.EvtNATDeviceTypeChanged:
+				r.natDeviceType[evt.TransportProtocol] = evt.NatDeviceType
+			}
+			needsRelay := r.status != network.ReachabilityPublic || r.privateFamilyLocked() || r.symmetricNATLocked()
+			r.mx.Unlock()
+			switch {
+			case needsRelay && !finderRunning:
 				if err := r.relayFinder.Start(); err != nil {
 					log.Errorw("failed to start relay finder", "error", err)
 				}
-			case network.ReachabilityPublic:
+				finderRunning = true
+			case !needsRelay && finderRunning:
 				r.relayFinder.Stop()
+				finderRunning = false
 			}
-			r.mx.Lock()
-			r.status = evt.Reachability
-			r.mx.Unlock()
 		case pi := <-peerChan:
-			select {
-			case r.peerChanOut <- pi: // if there's space in the channel, great
-			default:
-				// no space left in the channel. Drop the oldest entry.
-				select {
-				case <-r.peerChanOut:
-				default: // The consumer might just have emptied the channel. Make sure we don't block in that case.
-				}
-				r.peerChanOut <- pi
-			}
+			r.addCandidate(pi)
+		case pi := <-peerstoreChan:
+			r.addCandidate(pi)
 		}
 	}
 }
 
+func (r *AutoRelay) addCandidate(pi peer.AddrInfo) {
+	select {
+	case r.peerChanOut <- pi: // if there's space in the channel, great
+	default:
+		// no space left in the channel. Drop the oldest entry.
+		select {
+		case <-r.peerChanOut:
+		default: // The consumer might just have emptied the channel. Make sure we don't block in that case.
+		}
+		r.peerChanOut <- pi
+	}
+}
+
 func (r *AutoRelay) hostAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	return r.relayAddrs(r.addrsF(addrs))
 }
 
+// privateFamilyLocked returns true if we're not reachable over at least one IP address family.
+// It must be called with mx held.
+func (r *AutoRelay) privateFamilyLocked() bool {
+	for _, s := range r.familyStatus {
+		if s == network.ReachabilityPrivate {
+			return true
+		}
+	}
+	return false
+}
+
+// symmetricNATLocked returns true if we're behind a symmetric NAT on every
+// transport we have classified. Peers won't be able to reach us directly, and hole
+// punching is hopeless, so we need a relay even if AutoNAT hasn't told us yet.
+// It must be called with mx held.
+func (r *AutoRelay) symmetricNATLocked() bool {
+	var classified bool
+	for _, t := range r.natDeviceType {
+		switch t {
+		case network.NATDeviceTypeSymmetric:
+			classified = true
+		case network.NATDeviceTypeCone:
+			return false
+		}
+	}
+	return classified
+}
+
 func (r *AutoRelay) relayAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	r.mx.Lock()
 	defer r.mx.Unlock()
 
-	if r.status != network.ReachabilityPrivate {
+	if r.status != network.ReachabilityPrivate && !r.privateFamilyLocked() && !r.symmetricNATLocked() {
 		return addrs
 	}
-	return r.relayFinder.relayAddrs(addrs)
+
+	// Keep the public addresses of the address families we're reachable over,
+	// and replace the other public addresses with relay addresses.
+	var reachable []ma.Multiaddr
+	for _, a := range addrs {
+		if !manet.IsPublicAddr(a) {
+			continue
+		}
+		if f, ok := autonat.AddrFamilyOf(a); ok && r.familyStatus[f] == network.ReachabilityPublic {
+			reachable = append(reachable, a)
+		}
+	}
+	raddrs := r.relayFinder.relayAddrs(addrs)
+	if len(reachable) == 0 {
+		return raddrs
+	}
+	return append(append(make([]ma.Multiaddr, 0, len(raddrs)+len(reachable)), raddrs...), reachable...)
 }
 
 func (r *AutoRelay) Close() error {
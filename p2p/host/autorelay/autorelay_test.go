@@ -1,17 +1,20 @@
 package autorelay_test
 
 import (
+	"context"
 	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
 	relayv1 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv1/relay"
 	circuitv2_proto "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 
+	"github.com/libp2p/go-libp2p-core/event"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -305,3 +308,109 @@ func TestRelayV1(t *testing.T) {
 		}, 3*time.Second, 100*time.Millisecond)
 	})
 }
+
+func TestPeerstoreSource(t *testing.T) {
+	h := newPrivateNode(t,
+		autorelay.WithPeerstoreSource(time.Hour),
+		autorelay.WithNumRelays(1),
+		autorelay.WithBootDelay(0),
+	)
+	defer h.Close()
+
+	// A peer that doesn't speak the relay protocol shouldn't become a relay.
+	nonRelay, err := libp2p.New(libp2p.DisableRelay())
+	require.NoError(t, err)
+	defer nonRelay.Close()
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: nonRelay.ID(), Addrs: nonRelay.Addrs()}))
+	require.Never(t, func() bool {
+		return len(ma.FilterAddrs(h.Addrs(), isRelayAddr)) > 0
+	}, 300*time.Millisecond, 50*time.Millisecond)
+
+	// Once we connect to a relay, identify tells us that it supports the hop protocol.
+	r := newRelay(t)
+	defer r.Close()
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: r.ID(), Addrs: r.Addrs()}))
+	require.Eventually(t, func() bool {
+		return len(ma.FilterAddrs(h.Addrs(), isRelayAddr)) > 0
+	}, 3*time.Second, 100*time.Millisecond)
+}
+
+func TestPeerstoreSourceStaticRelays(t *testing.T) {
+	r := newRelay(t)
+	defer r.Close()
+	_, err := libp2p.New(
+		libp2p.ForceReachabilityPrivate(),
+		libp2p.EnableAutoRelay(
+			autorelay.WithStaticRelays([]peer.AddrInfo{{ID: r.ID(), Addrs: r.Addrs()}}),
+			autorelay.WithPeerstoreSource(time.Minute),
+		),
+	)
+	require.Error(t, err)
+}
+
+func TestFamilyReachability(t *testing.T) {
+	r := newRelay(t)
+	t.Cleanup(func() { r.Close() })
+
+	public4 := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	public6 := ma.StringCast("/ip6/2604:1380::1/tcp/1234")
+	h, err := libp2p.New(
+		libp2p.ForceReachabilityPrivate(),
+		libp2p.EnableAutoRelay(autorelay.WithStaticRelays([]peer.AddrInfo{{ID: r.ID(), Addrs: r.Addrs()}})),
+		libp2p.AddrsFactory(func(addrs []ma.Multiaddr) []ma.Multiaddr {
+			return append(addrs, public4, public6)
+		}),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+
+	contains := func(addr ma.Multiaddr) bool {
+		for _, a := range h.Addrs() {
+			if a.Equal(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	require.Eventually(t, func() bool {
+		return len(ma.FilterAddrs(h.Addrs(), isRelayAddr)) > 0
+	}, 2*time.Second, 50*time.Millisecond)
+	require.False(t, contains(public4))
+	require.False(t, contains(public6))
+
+	// once we're reachable over IPv6, we advertise our IPv6 addresses alongside the relay addresses
+	em, err := h.EventBus().Emitter(new(autonat.EvtFamilyReachabilityChanged))
+	require.NoError(t, err)
+	defer em.Close()
+	require.NoError(t, em.Emit(autonat.EvtFamilyReachabilityChanged{Family: autonat.AddrFamilyIPv6, Reachability: network.ReachabilityPublic}))
+	require.Eventually(t, func() bool { return contains(public6) }, 2*time.Second, 50*time.Millisecond)
+	require.False(t, contains(public4))
+	require.NotEmpty(t, ma.FilterAddrs(h.Addrs(), isRelayAddr))
+}
+
+func TestSymmetricNAT(t *testing.T) {
+	r := newRelay(t)
+	t.Cleanup(func() { r.Close() })
+
+	h, err := libp2p.New(
+		libp2p.EnableAutoRelay(autorelay.WithStaticRelays([]peer.AddrInfo{{ID: r.ID(), Addrs: r.Addrs()}})),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, ma.FilterAddrs(h.Addrs(), isRelayAddr))
+
+	// behind a symmetric NAT, we need a relay even before AutoNAT figures out that we're private
+	em, err := h.EventBus().Emitter(new(event.EvtNATDeviceTypeChanged))
+	require.NoError(t, err)
+	defer em.Close()
+	require.NoError(t, em.Emit(event.EvtNATDeviceTypeChanged{
+		TransportProtocol: network.NATTransportTCP,
+		NatDeviceType:     network.NATDeviceTypeSymmetric,
+	}))
+	require.Eventually(t, func() bool {
+		return len(ma.FilterAddrs(h.Addrs(), isRelayAddr)) > 0
+	}, 2*time.Second, 50*time.Millisecond)
+}
@@ -11,6 +11,9 @@ import (
 type config struct {
 	peerChan     <-chan peer.AddrInfo
 	staticRelays []peer.AddrInfo
+	// see WithPeerstoreSource
+	peerstoreSource       bool
+	peerstoreScanInterval time.Duration
 	// see WithMinCandidates
 	minCandidates int
 	// see WithMaxCandidates
@@ -37,7 +40,10 @@ var defaultConfig = config{
 	desiredRelays: 2,
 }
 
-var errStaticRelaysMinCandidates = errors.New("cannot use WithMinCandidates and WithStaticRelays")
+var (
+	errStaticRelaysMinCandidates   = errors.New("cannot use WithMinCandidates and WithStaticRelays")
+	errStaticRelaysPeerstoreSource = errors.New("cannot use WithPeerstoreSource and WithStaticRelays")
+)
 
 // DefaultRelays are the known PL-operated v1 relays; will be decommissioned in 2022.
 var DefaultRelays = []string{
@@ -68,6 +74,9 @@ func WithStaticRelays(static []peer.AddrInfo) Option {
 		if c.setMinCandidates {
 			return errStaticRelaysMinCandidates
 		}
+		if c.peerstoreSource {
+			return errStaticRelaysPeerstoreSource
+		}
 		if len(c.staticRelays) > 0 {
 			return errors.New("can't set static relays, static relays already configured")
 		}
@@ -88,6 +97,26 @@ func WithPeerSource(peerChan <-chan peer.AddrInfo) Option {
 	}
 }
 
+// WithPeerstoreSource uses the host's peerstore and live connections as a source of relay candidates.
+// Peers that support the circuit v2 hop protocol (and circuit v1, if enabled) are considered,
+// preferring peers that we've been connected to the longest.
+// The peerstore is scanned every scanInterval, and whenever a peer completes identification
+// or updates its protocols.
+// This can be combined with WithPeerSource.
+func WithPeerstoreSource(scanInterval time.Duration) Option {
+	return func(c *config) error {
+		if len(c.staticRelays) > 0 {
+			return errStaticRelaysPeerstoreSource
+		}
+		if scanInterval <= 0 {
+			return errors.New("peerstore scan interval must be positive")
+		}
+		c.peerstoreSource = true
+		c.peerstoreScanInterval = scanInterval
+		return nil
+	}
+}
+
 // WithNumRelays sets the number of relays we strive to obtain reservations with.
 func WithNumRelays(n int) Option {
 	return func(c *config) error {
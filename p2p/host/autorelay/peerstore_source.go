@@ -0,0 +1,140 @@
+package autorelay
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// peerstoreSource is a built-in peer source that mines the host's peerstore and
+// live connections for peers that announce support for the relay hop protocol.
+// It allows nodes without a DHT (or any other discovery mechanism) to find relays
+// among the peers they already know.
+type peerstoreSource struct {
+	host host.Host
+	conf *config
+
+	// sent records when we last handed out a peer, so that we don't keep
+	// feeding the same peers into the relay finder on every scan.
+	sent map[peer.ID]time.Time
+}
+
+func newPeerstoreSource(h host.Host, conf *config) *peerstoreSource {
+	return &peerstoreSource{
+		host: h,
+		conf: conf,
+		sent: make(map[peer.ID]time.Time),
+	}
+}
+
+// run periodically scans the peerstore, and additionally every time a peer
+// completes identification or updates its protocols.
+// Candidates are sent on out, best candidates first.
+func (s *peerstoreSource) run(ctx context.Context, out chan<- peer.AddrInfo) {
+	sub, err := s.host.EventBus().Subscribe([]interface{}{
+		new(event.EvtPeerIdentificationCompleted),
+		new(event.EvtPeerProtocolsUpdated),
+	})
+	if err != nil {
+		log.Errorw("failed to subscribe to identify events", "error", err)
+		return
+	}
+	defer sub.Close()
+
+	ticker := time.NewTicker(s.conf.peerstoreScanInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, ai := range s.candidates(time.Now()) {
+			select {
+			case out <- ai:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case _, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// candidates returns the peers that support the relay hop protocol and that we haven't
+// handed out recently. Peers we're connected to come first, ordered by the age of their
+// oldest connection (oldest first), followed by peers we're not connected to.
+func (s *peerstoreSource) candidates(now time.Time) []peer.AddrInfo {
+	for p, t := range s.sent {
+		if now.Sub(t) > s.conf.backoff {
+			delete(s.sent, p)
+		}
+	}
+
+	type rankedPeer struct {
+		id     peer.ID
+		opened time.Time // zero if we're not connected to this peer
+	}
+
+	ranked := make([]rankedPeer, 0, 16)
+	for _, p := range s.host.Peerstore().PeersWithAddrs() {
+		if p == s.host.ID() {
+			continue
+		}
+		if _, ok := s.sent[p]; ok {
+			continue
+		}
+		if !s.supportsHop(p) {
+			continue
+		}
+		var opened time.Time
+		for _, c := range s.host.Network().ConnsToPeer(p) {
+			// connections via a relay don't tell us anything about this peer's ability to relay
+			if isRelayAddr(c.RemoteMultiaddr()) {
+				continue
+			}
+			if o := c.Stat().Opened; opened.IsZero() || o.Before(opened) {
+				opened = o
+			}
+		}
+		ranked = append(ranked, rankedPeer{id: p, opened: opened})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		oi, oj := ranked[i].opened, ranked[j].opened
+		if oi.IsZero() != oj.IsZero() {
+			return !oi.IsZero()
+		}
+		return oi.Before(oj)
+	})
+
+	if len(ranked) > s.conf.maxCandidates {
+		ranked = ranked[:s.conf.maxCandidates]
+	}
+	res := make([]peer.AddrInfo, 0, len(ranked))
+	for _, r := range ranked {
+		s.sent[r.id] = now
+		res = append(res, s.host.Peerstore().PeerInfo(r.id))
+	}
+	return res
+}
+
+func (s *peerstoreSource) supportsHop(p peer.ID) bool {
+	protos := []string{protoIDv2}
+	if s.conf.enableCircuitV1 {
+		protos = append(protos, protoIDv1)
+	}
+	supported, err := s.host.Peerstore().SupportsProtocols(p, protos...)
+	if err != nil {
+		return false
+	}
+	return len(supported) > 0
+}
@@ -0,0 +1,99 @@
+package basichost
+
+import (
+	"net"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// AnnouncePolicy controls which addresses the host announces.
+// It is applied before the AddrsFactory, so it's reflected in Addrs,
+// identify and in our signed peer records.
+type AnnouncePolicy struct {
+	// Announce, if not empty, replaces the addresses we'd announce otherwise.
+	Announce []ma.Multiaddr
+	// AppendAnnounce are announced in addition to our other addresses.
+	AppendAnnounce []ma.Multiaddr
+	// AppendAnnounceFuncs return addresses that change over time, e.g. the addresses a
+	// certificate was obtained for. They are called with our addresses (before Announce
+	// replaces them), and the returned addresses are announced in addition to our other addresses.
+	AppendAnnounceFuncs []func(addrs []ma.Multiaddr) []ma.Multiaddr
+	// NoAnnounce are addresses that are never announced.
+	NoAnnounce []ma.Multiaddr
+	// NoAnnounceSubnets are subnets whose addresses are never announced.
+	NoAnnounceSubnets []*net.IPNet
+	// NoPrivateWhenPublic removes private and loopback addresses if we have
+	// at least one public address to announce.
+	NoPrivateWhenPublic bool
+}
+
+// announceFilter is a compiled AnnouncePolicy.
+type announceFilter struct {
+	policy     AnnouncePolicy
+	noAnnounce map[string]struct{}
+	subnets    *ma.Filters
+}
+
+func newAnnounceFilter(p *AnnouncePolicy) *announceFilter {
+	if p == nil {
+		return nil
+	}
+	f := &announceFilter{
+		policy:     *p,
+		noAnnounce: make(map[string]struct{}, len(p.NoAnnounce)),
+	}
+	for _, a := range p.NoAnnounce {
+		f.noAnnounce[string(a.Bytes())] = struct{}{}
+	}
+	if len(p.NoAnnounceSubnets) > 0 {
+		f.subnets = ma.NewFilters()
+		for _, n := range p.NoAnnounceSubnets {
+			f.subnets.AddFilter(*n, ma.ActionDeny)
+		}
+	}
+	return f
+}
+
+func (f *announceFilter) apply(addrs []ma.Multiaddr) []ma.Multiaddr {
+	appendAddrs := f.policy.AppendAnnounce
+	if len(f.policy.AppendAnnounceFuncs) > 0 {
+		appendAddrs = append(make([]ma.Multiaddr, 0, len(appendAddrs)), appendAddrs...)
+		for _, fn := range f.policy.AppendAnnounceFuncs {
+			appendAddrs = append(appendAddrs, fn(addrs)...)
+		}
+	}
+	if len(f.policy.Announce) > 0 {
+		addrs = f.policy.Announce
+	}
+	if len(appendAddrs) > 0 {
+		addrs = dedupAddrs(append(append(make([]ma.Multiaddr, 0, len(addrs)+len(appendAddrs)), addrs...), appendAddrs...))
+	}
+
+	filtered := make([]ma.Multiaddr, 0, len(addrs))
+	var hasPublic bool
+	for _, a := range addrs {
+		if _, ok := f.noAnnounce[string(a.Bytes())]; ok {
+			continue
+		}
+		if f.subnets != nil && f.subnets.AddrBlocked(a) {
+			continue
+		}
+		if manet.IsPublicAddr(a) {
+			hasPublic = true
+		}
+		filtered = append(filtered, a)
+	}
+	if !f.policy.NoPrivateWhenPublic || !hasPublic {
+		return filtered
+	}
+
+	public := filtered[:0]
+	for _, a := range filtered {
+		if manet.IsPrivateAddr(a) || manet.IsIPLoopback(a) {
+			continue
+		}
+		public = append(public, a)
+	}
+	return public
+}
@@ -86,6 +86,8 @@ type BasicHost struct {
 	relayManager *relaysvc.RelayManager
 
 	AddrsFactory AddrsFactory
+	// see HostOpts.AnnouncePolicy
+	announce *announceFilter
 
 	negtimeout time.Duration
 
@@ -105,6 +107,8 @@ type BasicHost struct {
 	caBook                  peerstore.CertifiedAddrBook
 
 	autoNat autonat.AutoNAT
+	// see HostOpts.AdvertiseReachableAddrsOnly
+	reachableAddrsOnly bool
 }
 
 var _ host.Host = (*BasicHost)(nil)
@@ -124,6 +128,10 @@ type HostOpts struct {
 	// If omitted, there's no override or filtering, and the results of Addrs and AllAddrs are the same.
 	AddrsFactory AddrsFactory
 
+	// AnnouncePolicy controls which addresses are announced. It is applied before the AddrsFactory.
+	// If omitted, all addresses are announced.
+	AnnouncePolicy *AnnouncePolicy
+
 	// MultiaddrResolves holds the go-multiaddr-dns.Resolver used for resolving
 	// /dns4, /dns6, and /dnsaddr addresses before trying to connect to a peer.
 	MultiaddrResolver *madns.Resolver
@@ -132,6 +140,11 @@ type HostOpts struct {
 	// If omitted, this will simply be disabled.
 	NATManager func(network.Network) NATManager
 
+	// EventBus is the event bus of the host. If omitted, a new event bus is created.
+	// Setting it allows passing the bus to components created before the host,
+	// e.g. inat.WithEventBus to NewNATManagerWithOptions.
+	EventBus event.Bus
+
 	// ConnManager is a libp2p connection manager
 	ConnManager connmgr.ConnManager
 
@@ -146,6 +159,9 @@ type HostOpts struct {
 	// UserAgent sets the user-agent for the host.
 	UserAgent string
 
+	// IdentifyOpts are options for the identify service.
+	IdentifyOpts []identify.Option
+
 	// DisableSignedPeerRecord disables the generation of Signed Peer Records on this host.
 	DisableSignedPeerRecord bool
 
@@ -153,19 +169,27 @@ type HostOpts struct {
 	EnableHolePunching bool
 	// HolePunchingOptions are options for the hole punching service
 	HolePunchingOptions []holepunch.Option
+
+	// AdvertiseReachableAddrsOnly makes Addrs only return addresses that AutoNAT confirmed
+	// to be reachable, and relay addresses. It has no effect unless AutoNAT tests the
+	// reachability of individual addresses, see autonat.WithAddrReachability.
+	AdvertiseReachableAddrsOnly bool
 }
 
 // NewHost constructs a new *BasicHost and activates it by attaching its stream and connection handlers to the given inet.Network.
 func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
-	eventBus := eventbus.NewBus()
+	if opts == nil {
+		opts = &HostOpts{}
+	}
+	eventBus := opts.EventBus
+	if eventBus == nil {
+		eventBus = eventbus.NewBus()
+	}
 	psManager, err := pstoremanager.NewPeerstoreManager(n.Peerstore(), eventBus)
 	if err != nil {
 		return nil, err
 	}
 	hostCtx, cancel := context.WithCancel(context.Background())
-	if opts == nil {
-		opts = &HostOpts{}
-	}
 
 	h := &BasicHost{
 		network:                 n,
@@ -179,6 +203,8 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 		ctx:                     hostCtx,
 		ctxCancel:               cancel,
 		disableSignedPeerRecord: opts.DisableSignedPeerRecord,
+		reachableAddrsOnly:      opts.AdvertiseReachableAddrsOnly,
+		announce:                newAnnounceFilter(opts.AnnouncePolicy),
 	}
 
 	h.updateLocalIpAddr()
@@ -226,11 +252,11 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 	}
 
 	// we can't set this as a default above because it depends on the *BasicHost.
+	idOpts := append([]identify.Option{identify.UserAgent(opts.UserAgent)}, opts.IdentifyOpts...)
 	if h.disableSignedPeerRecord {
-		h.ids, err = identify.NewIDService(h, identify.UserAgent(opts.UserAgent), identify.DisableSignedPeerRecord())
-	} else {
-		h.ids, err = identify.NewIDService(h, identify.UserAgent(opts.UserAgent))
+		idOpts = append(idOpts, identify.DisableSignedPeerRecord())
 	}
+	h.ids, err = identify.NewIDService(h, idOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Identify service: %s", err)
 	}
@@ -509,6 +535,18 @@ func (h *BasicHost) background() {
 	ticker := time.NewTicker(addrChangeTickrInterval)
 	defer ticker.Stop()
 
+	// the set of addresses we advertise changes with the reachability of our addresses
+	var reachabilityChanged <-chan interface{}
+	if h.reachableAddrsOnly {
+		sub, err := h.eventbus.Subscribe(new(autonat.EvtAddrReachabilityChanged))
+		if err != nil {
+			log.Errorf("failed to subscribe to address reachability events: %s", err)
+		} else {
+			defer sub.Close()
+			reachabilityChanged = sub.Out()
+		}
+	}
+
 	for {
 		if len(h.network.ListenAddresses()) > 0 {
 			h.updateLocalIpAddr()
@@ -522,6 +560,7 @@ func (h *BasicHost) background() {
 		select {
 		case <-ticker.C:
 		case <-h.addrChangeChan:
+		case <-reachabilityChanged:
 		case <-h.ctx.Done():
 			return
 		}
@@ -800,9 +839,53 @@ func (h *BasicHost) ConnManager() connmgr.ConnManager {
 }
 
 // Addrs returns listening addresses that are safe to announce to the network.
-// The output is the same as AllAddrs, but processed by AddrsFactory.
+// The output is the same as AllAddrs, but processed by the AnnouncePolicy and AddrsFactory.
 func (h *BasicHost) Addrs() []ma.Multiaddr {
-	return h.AddrsFactory(h.AllAddrs())
+	addrs := h.UnfilteredAddrs()
+	if h.reachableAddrsOnly {
+		addrs = h.filterReachableAddrs(addrs)
+	}
+	return addrs
+}
+
+// UnfilteredAddrs returns the addresses returned by Addrs, without removing the ones that
+// AutoNAT didn't confirm to be reachable (see HostOpts.AdvertiseReachableAddrsOnly).
+// These are the addresses AutoNAT tests by default.
+func (h *BasicHost) UnfilteredAddrs() []ma.Multiaddr {
+	return h.AddrsFactory(h.AnnouncedAddrs())
+}
+
+// AnnouncedAddrs returns AllAddrs processed by the AnnouncePolicy, i.e. the input of the AddrsFactory.
+func (h *BasicHost) AnnouncedAddrs() []ma.Multiaddr {
+	addrs := h.AllAddrs()
+	if h.announce != nil {
+		addrs = h.announce.apply(addrs)
+	}
+	return addrs
+}
+
+// filterReachableAddrs removes the addresses that AutoNAT didn't confirm to be reachable.
+// Relay addresses are kept, since they aren't tested by AutoNAT.
+func (h *BasicHost) filterReachableAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	h.addrMu.RLock()
+	an := h.autoNat
+	h.addrMu.RUnlock()
+	rt, ok := an.(autonat.ReachabilityTracker)
+	if !ok {
+		return addrs
+	}
+	status := rt.AddrStatus()
+	if status == nil {
+		return addrs
+	}
+
+	filtered := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil || status[a.String()] == network.ReachabilityPublic {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
 }
 
 // mergeAddrs merges input address lists, leave only unique addresses
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"reflect"
 	"strings"
 	"sync"
@@ -12,6 +13,8 @@ import (
 	"time"
 
 	"github.com/libp2p/go-libp2p/p2p/host/autonat"
+	autonatpb "github.com/libp2p/go-libp2p/p2p/host/autonat/pb"
+	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 
@@ -26,6 +29,7 @@ import (
 	"github.com/libp2p/go-libp2p-core/test"
 
 	"github.com/libp2p/go-eventbus"
+	"github.com/libp2p/go-msgio/protoio"
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
 
@@ -198,6 +202,170 @@ func TestHostAddrsFactory(t *testing.T) {
 	}
 }
 
+type mockAutoNAT struct {
+	autonat.AutoNAT
+	status map[string]network.Reachability
+}
+
+var _ autonat.ReachabilityTracker = &mockAutoNAT{}
+
+func (m *mockAutoNAT) PublicAddr() (ma.Multiaddr, error)           { return nil, nil }
+func (m *mockAutoNAT) AddrStatus() map[string]network.Reachability { return m.status }
+func (m *mockAutoNAT) FamilyStatus(autonat.AddrFamily) network.Reachability {
+	return network.ReachabilityUnknown
+}
+func (m *mockAutoNAT) Close() error { return nil }
+
+func TestHostAdvertiseReachableAddrsOnly(t *testing.T) {
+	reachable := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	unreachable := ma.StringCast("/ip4/1.2.3.4/udp/1234/quic")
+	relayed := ma.StringCast("/ip4/5.6.7.8/tcp/1234/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC/p2p-circuit")
+	untested := ma.StringCast("/ip4/192.168.1.1/tcp/1234")
+	addrsFactory := func([]ma.Multiaddr) []ma.Multiaddr {
+		return []ma.Multiaddr{reachable, unreachable, relayed, untested}
+	}
+
+	h, err := NewHost(swarmt.GenSwarm(t), &HostOpts{AddrsFactory: addrsFactory, AdvertiseReachableAddrsOnly: true})
+	require.NoError(t, err)
+	defer h.Close()
+
+	// without AutoNAT, addresses are not filtered
+	require.Len(t, h.Addrs(), 4)
+
+	h.SetAutoNat(&mockAutoNAT{status: map[string]network.Reachability{
+		reachable.String():   network.ReachabilityPublic,
+		unreachable.String(): network.ReachabilityPrivate,
+	}})
+	require.ElementsMatch(t, []ma.Multiaddr{reachable, relayed}, h.Addrs())
+}
+
+// AutoNAT tests the addresses that are not advertised yet, since they haven't been confirmed.
+func TestAdvertiseReachableAddrsOnlyAutoNATAddrs(t *testing.T) {
+	h, err := NewHost(swarmt.GenSwarm(t), &HostOpts{AdvertiseReachableAddrsOnly: true})
+	require.NoError(t, err)
+	defer h.Close()
+
+	server := blankhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer server.Close()
+	dialed := make(chan []ma.Multiaddr, 1)
+	server.SetStreamHandler(autonat.AutoNATProto, func(s network.Stream) {
+		defer s.Close()
+		var req autonatpb.Message
+		if err := protoio.NewDelimitedReader(s, network.MessageSizeMax).ReadMsg(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		var addrs []ma.Multiaddr
+		for _, b := range req.GetDial().GetPeer().GetAddrs() {
+			a, err := ma.NewMultiaddrBytes(b)
+			require.NoError(t, err)
+			addrs = append(addrs, a)
+		}
+		select {
+		case dialed <- addrs:
+		default:
+		}
+		protoio.NewDelimitedWriter(s).WriteMsg(&autonatpb.Message{
+			Type:         autonatpb.Message_DIAL_RESPONSE.Enum(),
+			DialResponse: &autonatpb.Message_DialResponse{Status: autonatpb.Message_E_DIAL_ERROR.Enum()},
+		})
+	})
+
+	an, err := autonat.New(h, autonat.WithAddrReachability(), autonat.WithSchedule(100*time.Millisecond, time.Second), autonat.WithoutStartupDelay())
+	require.NoError(t, err)
+	defer an.Close()
+	h.SetAutoNat(an)
+	// none of the (loopback) addresses is confirmed
+	require.Empty(t, h.Addrs())
+
+	h.Peerstore().AddProtocols(server.ID(), autonat.AutoNATProto)
+	// AutoNAT doesn't ask peers that only have private addresses
+	h.Peerstore().AddAddr(server.ID(), ma.StringCast("/ip4/1.2.3.4/tcp/1234"), time.Hour)
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}))
+	select {
+	case addrs := <-dialed:
+		require.NotEmpty(t, addrs)
+		require.ElementsMatch(t, h.UnfilteredAddrs(), addrs)
+	case <-time.After(5 * time.Second):
+		t.Fatal("AutoNAT didn't send a dial request")
+	}
+}
+
+func TestAnnouncePolicy(t *testing.T) {
+	public := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	private := ma.StringCast("/ip4/192.168.1.1/tcp/1234")
+	loopback := ma.StringCast("/ip4/127.0.0.1/tcp/1234")
+	internal := ma.StringCast("/ip4/10.1.2.3/tcp/1234")
+	static := ma.StringCast("/dns4/example.com/tcp/1234")
+	_, subnet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	apply := func(p *AnnouncePolicy, addrs ...ma.Multiaddr) []ma.Multiaddr {
+		return newAnnounceFilter(p).apply(addrs)
+	}
+
+	// static addresses replace our addresses, but are still filtered
+	require.Equal(t, []ma.Multiaddr{static}, apply(&AnnouncePolicy{
+		Announce:   []ma.Multiaddr{static, private},
+		NoAnnounce: []ma.Multiaddr{private},
+	}, public))
+	require.Equal(t, []ma.Multiaddr{public, static}, apply(&AnnouncePolicy{AppendAnnounce: []ma.Multiaddr{static, public}}, public))
+	// dynamic addresses are computed from our addresses, before Announce replaces them
+	appendStatic := func(addrs []ma.Multiaddr) []ma.Multiaddr {
+		if len(addrs) > 0 && addrs[0].Equal(loopback) {
+			return []ma.Multiaddr{static}
+		}
+		return nil
+	}
+	require.Equal(t, []ma.Multiaddr{public, static}, apply(&AnnouncePolicy{
+		Announce:            []ma.Multiaddr{public},
+		AppendAnnounceFuncs: []func([]ma.Multiaddr) []ma.Multiaddr{appendStatic},
+	}, loopback))
+	require.Equal(t, []ma.Multiaddr{private}, apply(&AnnouncePolicy{
+		NoAnnounce:          []ma.Multiaddr{static},
+		AppendAnnounceFuncs: []func([]ma.Multiaddr) []ma.Multiaddr{appendStatic},
+	}, private))
+	require.Equal(t, []ma.Multiaddr{loopback}, apply(&AnnouncePolicy{
+		NoAnnounce:          []ma.Multiaddr{static},
+		AppendAnnounceFuncs: []func([]ma.Multiaddr) []ma.Multiaddr{appendStatic},
+	}, loopback))
+	require.Equal(t, []ma.Multiaddr{public, loopback}, apply(&AnnouncePolicy{
+		NoAnnounce:        []ma.Multiaddr{private},
+		NoAnnounceSubnets: []*net.IPNet{subnet},
+	}, public, private, loopback, internal))
+
+	require.Equal(t, []ma.Multiaddr{public, static}, apply(&AnnouncePolicy{NoPrivateWhenPublic: true}, public, private, loopback, static))
+	// without a public address, private addresses are announced
+	require.Equal(t, []ma.Multiaddr{private, loopback}, apply(&AnnouncePolicy{NoPrivateWhenPublic: true}, private, loopback))
+}
+
+func TestHostAnnouncePolicy(t *testing.T) {
+	announced := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	h, err := NewHost(swarmt.GenSwarm(t), &HostOpts{
+		AnnouncePolicy: &AnnouncePolicy{Announce: []ma.Multiaddr{announced}},
+		// the AnnouncePolicy is applied before the AddrsFactory
+		AddrsFactory: func(addrs []ma.Multiaddr) []ma.Multiaddr {
+			return append(addrs, ma.StringCast("/ip4/1.2.3.4/udp/1234/quic"))
+		},
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.Start()
+
+	expected := []ma.Multiaddr{announced, ma.StringCast("/ip4/1.2.3.4/udp/1234/quic")}
+	require.Equal(t, expected, h.Addrs())
+
+	// the signed peer record reflects the policy
+	cab, ok := peerstore.GetCertifiedAddrBook(h.Peerstore())
+	require.True(t, ok)
+	var env *record.Envelope
+	require.Eventually(t, func() bool {
+		env = cab.GetPeerRecord(h.ID())
+		return env != nil
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, expected, peerRecordFromEnvelope(t, env).Addrs)
+}
+
 func TestLocalIPChangesWhenListenAddrChanges(t *testing.T) {
 	// no listen addrs
 	h, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), nil)
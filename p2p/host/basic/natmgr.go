@@ -31,6 +31,16 @@ func NewNATManager(net network.Network) NATManager {
 	return newNatManager(net)
 }
 
+// NewNATManagerWithOptions returns a constructor for NAT managers that discover
+// and configure the NAT using the given options, e.g. to set the lifetime of port
+// mappings or the preferred port mapping protocol. Pass inat.WithEventBus with the
+// host's event bus, see HostOpts.EventBus, to emit changes of the external addresses.
+func NewNATManagerWithOptions(opts ...inat.Option) func(network.Network) NATManager {
+	return func(net network.Network) NATManager {
+		return newNatManager(net, opts...)
+	}
+}
+
 // natManager takes care of adding + removing port mappings to the nat.
 // Initialized with the host if it has a NATPortMap option enabled.
 // natManager receives signals from the network, and check on nat mappings:
@@ -38,9 +48,10 @@ func NewNATManager(net network.Network) NATManager {
 //    as the network signals Listen() or ListenClose().
 //  * closing the natManager closes the nat and its mappings.
 type natManager struct {
-	net   network.Network
-	natmu sync.RWMutex
-	nat   *inat.NAT
+	net     network.Network
+	natOpts []inat.Option
+	natmu   sync.RWMutex
+	nat     *inat.NAT
 
 	ready    chan struct{} // closed once the nat is ready to process port mappings
 	syncFlag chan struct{}
@@ -49,10 +60,11 @@ type natManager struct {
 	ctxCancel context.CancelFunc
 }
 
-func newNatManager(net network.Network) *natManager {
+func newNatManager(net network.Network, opts ...inat.Option) *natManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	nmgr := &natManager{
 		net:       net,
+		natOpts:   opts,
 		ready:     make(chan struct{}),
 		syncFlag:  make(chan struct{}, 1),
 		ctxCancel: cancel,
@@ -81,13 +93,15 @@ func (nmgr *natManager) background(ctx context.Context) {
 
 	discoverCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	natInstance, err := inat.DiscoverNAT(discoverCtx)
+	natInstance, err := inat.DiscoverNAT(discoverCtx, nmgr.natOpts...)
 	if err != nil {
 		log.Info("DiscoverNAT error:", err)
 		close(nmgr.ready)
 		return
 	}
 
+	defer natInstance.Close()
+
 	nmgr.natmu.Lock()
 	nmgr.nat = natInstance
 	nmgr.natmu.Unlock()
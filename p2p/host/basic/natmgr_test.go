@@ -0,0 +1,73 @@
+package basichost
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	inat "github.com/libp2p/go-libp2p/p2p/net/nat"
+	natt "github.com/libp2p/go-libp2p/p2p/net/nat/testing"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/libp2p/go-eventbus"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNATManager(t *testing.T) {
+	gw := natt.NewFakeGateway(inat.ProtocolNATPMP, net.IPv4(1, 2, 3, 4))
+	bus := eventbus.NewBus()
+	h, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), &HostOpts{
+		EventBus:   bus,
+		NATManager: NewNATManagerWithOptions(inat.WithGateway(gw), inat.WithMappingDuration(30*time.Millisecond), inat.WithEventBus(bus)),
+	})
+	require.NoError(t, err)
+	require.Equal(t, bus, h.EventBus())
+	sub, err := bus.Subscribe(new(inat.EvtExternalAddrChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+	h.Start()
+	defer h.Close()
+
+	<-h.natmgr.Ready()
+	require.NotNil(t, h.natmgr.NAT())
+
+	require.NoError(t, h.Network().Listen(ma.StringCast("/ip4/0.0.0.0/tcp/0")))
+	var port int
+	for _, a := range h.Network().ListenAddresses() {
+		if na, err := manet.ToNetAddr(a); err == nil {
+			port = na.(*net.TCPAddr).Port
+		}
+	}
+	require.NotZero(t, port)
+
+	hasAddr := func(addr ma.Multiaddr) func() bool {
+		return func() bool {
+			for _, a := range h.AllAddrs() {
+				if a.Equal(addr) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	require.Eventually(t, hasAddr(ma.StringCast(fmt.Sprintf("/ip4/1.2.3.4/tcp/%d", port))), time.Second, 10*time.Millisecond)
+
+	// the gateway assigns a different port when the mapping is renewed
+	gw.SetPortOffset(1)
+	require.Eventually(t, hasAddr(ma.StringCast(fmt.Sprintf("/ip4/1.2.3.4/tcp/%d", port+1))), time.Second, 10*time.Millisecond)
+	select {
+	case <-sub.Out():
+	case <-time.After(time.Second):
+		t.Fatal("expected an EvtExternalAddrChanged event on the host's event bus")
+	}
+
+	// closing the host removes the mapping from the gateway
+	require.NoError(t, h.Close())
+	_, ok := gw.ExternalPort("tcp", port)
+	require.False(t, ok)
+}
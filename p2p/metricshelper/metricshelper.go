@@ -0,0 +1,31 @@
+// Package metricshelper contains helpers shared by the Prometheus metrics of the libp2p components.
+package metricshelper
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterCollector registers c, or returns the existing collector if an equal collector is already registered.
+// This allows multiple instances of a component, e.g. multiple hosts in the same process, to share their metrics,
+// so multiple tracers can share a registerer.
+// If reg is nil, the metrics are registered with the default Prometheus registerer.
+func RegisterCollector(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// LatencyBuckets returns the histogram buckets used for latencies and RTTs, in seconds.
+func LatencyBuckets() []float64 {
+	return prometheus.ExponentialBuckets(0.001, 1.25, 40) // 1ms to ~6000ms
+}
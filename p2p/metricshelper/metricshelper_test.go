@@ -0,0 +1,26 @@
+package metricshelper
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	newCounter := func() prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{Name: "test_counter", Help: "test"})
+	}
+	c1 := newCounter()
+	c, err := RegisterCollector(reg, c1)
+	require.NoError(t, err)
+	require.Equal(t, c1, c)
+	// registering an equal collector returns the first one
+	c, err = RegisterCollector(reg, newCounter())
+	require.NoError(t, err)
+	require.Equal(t, c1, c)
+	// a different collector with the same name fails
+	_, err = RegisterCollector(reg, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_counter", Help: "other"}))
+	require.Error(t, err)
+}
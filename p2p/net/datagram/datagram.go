@@ -0,0 +1,9 @@
+// Package datagram contains definitions shared by the transports that support
+// unreliable datagrams and the swarm.
+package datagram
+
+import "errors"
+
+// ErrNotSupported is returned when sending or receiving datagrams on a
+// connection that doesn't support them.
+var ErrNotSupported = errors.New("connection doesn't support datagrams")
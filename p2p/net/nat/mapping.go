@@ -97,17 +97,40 @@ func (m *mapping) ExternalAddr() (net.Addr, error) {
 		m.cached = cval
 		m.cacheTime = time.Now()
 	}
+	return m.makeAddr(m.cached, oport), nil
+}
+
+// lastExternalAddr returns the external address as of the last refresh,
+// without asking the gateway. It returns nil if the mapping is not established.
+func (m *mapping) lastExternalAddr() net.Addr {
+	m.cacheLk.Lock()
+	defer m.cacheLk.Unlock()
+	oport := m.ExternalPort()
+	if oport == 0 || m.cached == nil {
+		return nil
+	}
+	return m.makeAddr(m.cached, oport)
+}
+
+func (m *mapping) setExternalIP(ip net.IP) {
+	m.cacheLk.Lock()
+	defer m.cacheLk.Unlock()
+	m.cached = ip
+	m.cacheTime = time.Now()
+}
+
+func (m *mapping) makeAddr(ip net.IP, port int) net.Addr {
 	switch m.Protocol() {
 	case "tcp":
 		return &net.TCPAddr{
-			IP:   m.cached,
-			Port: oport,
-		}, nil
+			IP:   ip,
+			Port: port,
+		}
 	case "udp":
 		return &net.UDPAddr{
-			IP:   m.cached,
-			Port: oport,
-		}, nil
+			IP:   ip,
+			Port: port,
+		}
 	default:
 		panic(fmt.Sprintf("invalid protocol %q", m.Protocol()))
 	}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"sync"
 	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 
+	"github.com/libp2p/go-libp2p-core/event"
+
 	"github.com/libp2p/go-nat"
 )
 
@@ -24,14 +28,38 @@ const MappingDuration = time.Second * 60
 // CacheTime is the time a mapping will cache an external address for
 const CacheTime = time.Second * 15
 
+// EvtExternalAddrChanged is emitted when the external address of a port mapping
+// changes, e.g. because the gateway assigned a different external port when
+// the mapping was renewed. See WithEventBus.
+type EvtExternalAddrChanged struct {
+	// Mapping is the port mapping whose external address changed.
+	Mapping Mapping
+	// Previous is the previous external address. It's nil if the mapping wasn't established.
+	Previous net.Addr
+	// Current is the new external address. It's nil if the mapping was lost.
+	Current net.Addr
+}
+
 // DiscoverNAT looks for a NAT device in the network and
 // returns an object that can manage port mappings.
-func DiscoverNAT(ctx context.Context) (*NAT, error) {
-	natInstance, err := nat.DiscoverGateway(ctx)
+func DiscoverNAT(ctx context.Context, opts ...Option) (*NAT, error) {
+	cfg, err := newConfig(opts)
 	if err != nil {
 		return nil, err
 	}
 
+	natInstance := cfg.gateway
+	if natInstance == nil {
+		if len(cfg.preference) > 0 {
+			natInstance, err = discoverPreferredGateway(ctx, cfg.preference)
+		} else {
+			natInstance, err = nat.DiscoverGateway(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Log the device addr.
 	addr, err := natInstance.GetDeviceAddress()
 	if err != nil {
@@ -40,7 +68,64 @@ func DiscoverNAT(ctx context.Context) (*NAT, error) {
 		log.Debug("DiscoverGateway address:", addr)
 	}
 
-	return newNAT(natInstance), nil
+	return newNAT(natInstance, cfg)
+}
+
+// NewNAT returns an object that manages port mappings on the given gateway.
+func NewNAT(gw nat.NAT, opts ...Option) (*NAT, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newNAT(gw, cfg)
+}
+
+func newConfig(opts []Option) (*config, error) {
+	cfg := &config{mappingDuration: MappingDuration}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// discoverPreferredGateway discovers all gateways in the network, and returns the
+// one speaking the most preferred protocol.
+func discoverPreferredGateway(ctx context.Context, preference []string) (nat.NAT, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var best nat.NAT
+	bestRank := len(preference) + 1
+	for gw := range nat.DiscoverNATs(ctx) {
+		rank := len(preference)
+		for i, p := range preference {
+			if gatewayProtocol(gw) == p {
+				rank = i
+				break
+			}
+		}
+		if rank < bestRank {
+			best, bestRank = gw, rank
+		}
+		if rank == 0 {
+			break // can't do any better than this
+		}
+	}
+	if best == nil {
+		return nil, nat.ErrNoNATFound
+	}
+	return best, nil
+}
+
+// gatewayProtocol returns the port mapping protocol spoken by the gateway.
+func gatewayProtocol(gw nat.NAT) string {
+	t := gw.Type()
+	if strings.HasPrefix(t, "UPNP") {
+		return ProtocolUPnP
+	}
+	return t
 }
 
 // NAT is an object that manages address port mappings in
@@ -51,6 +136,9 @@ type NAT struct {
 	natmu sync.Mutex
 	nat   nat.NAT
 
+	mappingDuration time.Duration
+	emitter         event.Emitter // nil if there's no event bus
+
 	refCount  sync.WaitGroup
 	ctx       context.Context
 	ctxCancel context.CancelFunc
@@ -60,14 +148,31 @@ type NAT struct {
 	mappings  map[*mapping]struct{}
 }
 
-func newNAT(realNAT nat.NAT) *NAT {
+func newNAT(realNAT nat.NAT, cfg *config) (*NAT, error) {
+	var emitter event.Emitter
+	if cfg.eventBus != nil {
+		var err error
+		emitter, err = cfg.eventBus.Emitter(new(EvtExternalAddrChanged))
+		if err != nil {
+			return nil, err
+		}
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	return &NAT{
-		nat:       realNAT,
-		mappings:  make(map[*mapping]struct{}),
-		ctx:       ctx,
-		ctxCancel: cancel,
-	}
+		nat:             realNAT,
+		mappingDuration: cfg.mappingDuration,
+		emitter:         emitter,
+		mappings:        make(map[*mapping]struct{}),
+		ctx:             ctx,
+		ctxCancel:       cancel,
+	}, nil
+}
+
+// Type returns the kind of port mapping service used by the gateway, e.g. "NAT-PMP".
+func (nat *NAT) Type() string {
+	nat.natmu.Lock()
+	defer nat.natmu.Unlock()
+	return nat.nat.Type()
 }
 
 // Close shuts down all port mappings. NAT can no longer be used.
@@ -78,6 +183,9 @@ func (nat *NAT) Close() error {
 
 	nat.ctxCancel()
 	nat.refCount.Wait()
+	if nat.emitter != nil {
+		return nat.emitter.Close()
+	}
 	return nil
 }
 
@@ -144,7 +252,7 @@ func (nat *NAT) removeMapping(m *mapping) {
 
 func (nat *NAT) refreshMappings(m *mapping) {
 	defer nat.refCount.Done()
-	t := time.NewTicker(MappingDuration / 3)
+	t := time.NewTicker(nat.mappingDuration / 3)
 	defer t.Stop()
 
 	for {
@@ -160,16 +268,22 @@ func (nat *NAT) refreshMappings(m *mapping) {
 
 func (nat *NAT) establishMapping(m *mapping) {
 	oldport := m.ExternalPort()
+	oldAddr := m.lastExternalAddr()
 
 	log.Debugf("Attempting port map: %s/%d", m.Protocol(), m.InternalPort())
 	const comment = "libp2p"
 
 	nat.natmu.Lock()
-	newport, err := nat.nat.AddPortMapping(m.Protocol(), m.InternalPort(), comment, MappingDuration)
+	newport, err := nat.nat.AddPortMapping(m.Protocol(), m.InternalPort(), comment, nat.mappingDuration)
 	if err != nil {
 		// Some hardware does not support mappings with timeout, so try that
 		newport, err = nat.nat.AddPortMapping(m.Protocol(), m.InternalPort(), comment, 0)
 	}
+	var extIP net.IP
+	if err == nil && newport != 0 {
+		// refresh the external IP as well, the gateway's address might have changed too
+		extIP, _ = nat.nat.GetExternalAddress()
+	}
 	nat.natmu.Unlock()
 
 	if err != nil || newport == 0 {
@@ -180,14 +294,31 @@ func (nat *NAT) establishMapping(m *mapping) {
 		} else {
 			log.Warnf("failed to establish port mapping: newport = 0")
 		}
+		nat.emitAddrChange(m, oldAddr, nil)
 		// we do not close if the mapping failed,
 		// because it may work again next time.
 		return
 	}
 
 	m.setExternalPort(newport)
+	if extIP != nil {
+		m.setExternalIP(extIP)
+	}
 	log.Debugf("NAT Mapping: %d --> %d (%s)", m.ExternalPort(), m.InternalPort(), m.Protocol())
 	if oldport != 0 && newport != oldport {
 		log.Debugf("failed to renew same port mapping: ch %d -> %d", oldport, newport)
 	}
+	nat.emitAddrChange(m, oldAddr, m.lastExternalAddr())
+}
+
+func (nat *NAT) emitAddrChange(m *mapping, prev, cur net.Addr) {
+	if nat.emitter == nil {
+		return
+	}
+	if prev == nil && cur == nil || prev != nil && cur != nil && prev.String() == cur.String() {
+		return
+	}
+	if err := nat.emitter.Emit(EvtExternalAddrChanged{Mapping: m, Previous: prev, Current: cur}); err != nil {
+		log.Debugf("failed to emit external address change: %s", err)
+	}
 }
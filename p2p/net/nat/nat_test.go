@@ -0,0 +1,118 @@
+package nat
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	natt "github.com/libp2p/go-libp2p/p2p/net/nat/testing"
+
+	"github.com/libp2p/go-eventbus"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappingDuration(t *testing.T) {
+	gw := natt.NewFakeGateway(ProtocolNATPMP, net.IPv4(1, 2, 3, 4))
+	n, err := DiscoverNAT(context.Background(), WithGateway(gw), WithMappingDuration(90*time.Millisecond))
+	require.NoError(t, err)
+	defer n.Close()
+
+	m, err := n.NewMapping("tcp", 1234)
+	require.NoError(t, err)
+	addr, err := m.ExternalAddr()
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3.4:1234", addr.String())
+	port, ok := gw.ExternalPort("tcp", 1234)
+	require.True(t, ok)
+	require.Equal(t, 1234, port)
+
+	// the mapping is renewed after a third of its lifetime
+	require.Eventually(t, func() bool { return len(gw.Timeouts()) >= 3 }, time.Second, 10*time.Millisecond)
+	for _, timeout := range gw.Timeouts() {
+		require.Equal(t, 90*time.Millisecond, timeout)
+	}
+
+	require.NoError(t, m.Close())
+	_, ok = gw.ExternalPort("tcp", 1234)
+	require.False(t, ok)
+	require.Empty(t, n.Mappings())
+}
+
+func TestPermanentMappingFallback(t *testing.T) {
+	gw := natt.NewFakeGateway(ProtocolNATPMP, net.IPv4(1, 2, 3, 4))
+	gw.RejectTimeouts()
+	n, err := NewNAT(gw)
+	require.NoError(t, err)
+	defer n.Close()
+
+	m, err := n.NewMapping("udp", 1234)
+	require.NoError(t, err)
+	require.Equal(t, 1234, m.ExternalPort())
+	require.Equal(t, []time.Duration{MappingDuration, 0}, gw.Timeouts())
+}
+
+func TestExternalAddrChangedEvents(t *testing.T) {
+	bus := eventbus.NewBus()
+	sub, err := bus.Subscribe(new(EvtExternalAddrChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	gw := natt.NewFakeGateway(ProtocolUPnP, net.IPv4(1, 2, 3, 4))
+	n, err := NewNAT(gw, WithEventBus(bus), WithMappingDuration(30*time.Millisecond))
+	require.NoError(t, err)
+	defer n.Close()
+
+	nextEvent := func() EvtExternalAddrChanged {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			return e.(EvtExternalAddrChanged)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+		return EvtExternalAddrChanged{}
+	}
+
+	m, err := n.NewMapping("udp", 1234)
+	require.NoError(t, err)
+	evt := nextEvent()
+	require.Equal(t, m, evt.Mapping)
+	require.Nil(t, evt.Previous)
+	require.Equal(t, "1.2.3.4:1234", evt.Current.String())
+
+	// the gateway assigns a new port when renewing the mapping
+	gw.SetPortOffset(1)
+	evt = nextEvent()
+	require.Equal(t, "1.2.3.4:1234", evt.Previous.String())
+	require.Equal(t, "1.2.3.4:1235", evt.Current.String())
+
+	// the gateway's address changes
+	gw.SetExternalIP(net.IPv4(5, 6, 7, 8))
+	evt = nextEvent()
+	require.Equal(t, "1.2.3.4:1235", evt.Previous.String())
+	require.Equal(t, "5.6.7.8:1235", evt.Current.String())
+
+	// the mapping is lost
+	gw.SetFailing(true)
+	evt = nextEvent()
+	require.Equal(t, "5.6.7.8:1235", evt.Previous.String())
+	require.Nil(t, evt.Current)
+	require.Zero(t, m.ExternalPort())
+
+	// no events are emitted while nothing changes
+	select {
+	case e := <-sub.Out():
+		t.Fatalf("unexpected event: %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestProtocolPreference(t *testing.T) {
+	require.Equal(t, ProtocolUPnP, gatewayProtocol(natt.NewFakeGateway("UPNP (IG2-IP1)", nil)))
+	require.Equal(t, ProtocolNATPMP, gatewayProtocol(natt.NewFakeGateway("NAT-PMP", nil)))
+
+	_, err := DiscoverNAT(context.Background(), WithProtocolPreference("PCP"))
+	require.EqualError(t, err, "unknown port mapping protocol: PCP")
+}
@@ -0,0 +1,79 @@
+package nat
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/event"
+
+	"github.com/libp2p/go-nat"
+)
+
+// Port mapping protocols that can be passed to WithProtocolPreference.
+const (
+	// ProtocolNATPMP is NAT-PMP (RFC 6886). Most PCP (RFC 6887) gateways
+	// also speak NAT-PMP, so this is how we use them.
+	ProtocolNATPMP = "NAT-PMP"
+	// ProtocolUPnP is the UPnP Internet Gateway Device protocol.
+	ProtocolUPnP = "UPnP"
+)
+
+type config struct {
+	mappingDuration time.Duration
+	preference      []string
+	eventBus        event.Bus
+	gateway         nat.NAT
+}
+
+// Option is an option that can be passed to DiscoverNAT and NewNAT.
+type Option func(*config) error
+
+// WithMappingDuration sets the lifetime we request for port mappings.
+// Mappings are renewed after a third of their lifetime.
+// Defaults to MappingDuration.
+func WithMappingDuration(d time.Duration) Option {
+	return func(cfg *config) error {
+		if d <= 0 {
+			return errors.New("mapping duration must be positive")
+		}
+		cfg.mappingDuration = d
+		return nil
+	}
+}
+
+// WithProtocolPreference makes DiscoverNAT prefer gateways speaking the given
+// protocols (ProtocolNATPMP or ProtocolUPnP), in order of preference.
+// Gateways speaking other protocols are only used if no preferred gateway is found.
+// By default, the gateway is chosen by its position in the network, regardless of the protocol.
+func WithProtocolPreference(protos ...string) Option {
+	return func(cfg *config) error {
+		for _, p := range protos {
+			switch p {
+			case ProtocolNATPMP, ProtocolUPnP:
+			default:
+				return fmt.Errorf("unknown port mapping protocol: %s", p)
+			}
+		}
+		cfg.preference = protos
+		return nil
+	}
+}
+
+// WithEventBus makes the NAT emit an EvtExternalAddrChanged event on the bus
+// whenever the external address of a port mapping changes.
+func WithEventBus(bus event.Bus) Option {
+	return func(cfg *config) error {
+		cfg.eventBus = bus
+		return nil
+	}
+}
+
+// WithGateway makes DiscoverNAT use the given gateway instead of discovering
+// one in the network. This is mostly useful for testing.
+func WithGateway(gw nat.NAT) Option {
+	return func(cfg *config) error {
+		cfg.gateway = gw
+		return nil
+	}
+}
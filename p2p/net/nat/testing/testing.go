@@ -0,0 +1,133 @@
+package testing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-nat"
+)
+
+// ErrGatewayFailing is returned by a FakeGateway that was told to fail.
+var ErrGatewayFailing = errors.New("gateway failing")
+
+// FakeGateway is an in-memory gateway that can be used to test port mapping
+// without a NAT device. It maps internal ports to the same external port,
+// plus an offset that can be changed to simulate a gateway reassigning ports.
+type FakeGateway struct {
+	mx         sync.Mutex
+	typ        string
+	externalIP net.IP
+	internalIP net.IP
+	deviceIP   net.IP
+	portOffset int
+	failing    bool
+	noTimeouts bool
+
+	mappings map[string]int // "proto/port" -> external port
+	timeouts []time.Duration
+}
+
+var _ nat.NAT = &FakeGateway{}
+
+// NewFakeGateway creates a FakeGateway of the given type (e.g. "NAT-PMP")
+// with the given external IP.
+func NewFakeGateway(typ string, externalIP net.IP) *FakeGateway {
+	return &FakeGateway{
+		typ:        typ,
+		externalIP: externalIP,
+		internalIP: net.IPv4(192, 168, 1, 2),
+		deviceIP:   net.IPv4(192, 168, 1, 1),
+		mappings:   make(map[string]int),
+	}
+}
+
+// SetExternalIP changes the external IP of the gateway.
+func (g *FakeGateway) SetExternalIP(ip net.IP) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	g.externalIP = ip
+}
+
+// SetPortOffset changes the external port assigned to mappings added from now on.
+func (g *FakeGateway) SetPortOffset(offset int) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	g.portOffset = offset
+}
+
+// SetFailing makes all requests to the gateway fail.
+func (g *FakeGateway) SetFailing(failing bool) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	g.failing = failing
+}
+
+// RejectTimeouts makes the gateway only accept permanent mappings,
+// like some routers do.
+func (g *FakeGateway) RejectTimeouts() {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	g.noTimeouts = true
+}
+
+// ExternalPort returns the external port the internal port is mapped to.
+func (g *FakeGateway) ExternalPort(protocol string, internalPort int) (int, bool) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	port, ok := g.mappings[mappingKey(protocol, internalPort)]
+	return port, ok
+}
+
+// Timeouts returns the lifetimes that were requested for mappings, in order.
+func (g *FakeGateway) Timeouts() []time.Duration {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	return append([]time.Duration(nil), g.timeouts...)
+}
+
+func (g *FakeGateway) Type() string { return g.typ }
+
+func (g *FakeGateway) GetDeviceAddress() (net.IP, error) { return g.deviceIP, nil }
+
+func (g *FakeGateway) GetInternalAddress() (net.IP, error) { return g.internalIP, nil }
+
+func (g *FakeGateway) GetExternalAddress() (net.IP, error) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	if g.failing {
+		return nil, ErrGatewayFailing
+	}
+	if g.externalIP == nil {
+		return nil, nat.ErrNoExternalAddress
+	}
+	return g.externalIP, nil
+}
+
+func (g *FakeGateway) AddPortMapping(protocol string, internalPort int, _ string, timeout time.Duration) (int, error) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	g.timeouts = append(g.timeouts, timeout)
+	if g.failing {
+		return 0, ErrGatewayFailing
+	}
+	if g.noTimeouts && timeout != 0 {
+		return 0, fmt.Errorf("only permanent mappings are supported")
+	}
+	port := internalPort + g.portOffset
+	g.mappings[mappingKey(protocol, internalPort)] = port
+	return port, nil
+}
+
+func (g *FakeGateway) DeletePortMapping(protocol string, internalPort int) error {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	delete(g.mappings, mappingKey(protocol, internalPort))
+	return nil
+}
+
+func mappingKey(protocol string, port int) string {
+	return fmt.Sprintf("%s/%d", protocol, port)
+}
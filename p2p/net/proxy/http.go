@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// dialHTTPConnect establishes a tunnel to addr through the HTTP proxy at proxyURL.
+func dialHTTPConnect(ctx context.Context, forward dialFunc, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	c, err := forward(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		conn, err := httpConnect(c, proxyURL, addr)
+		resCh <- result{conn: conn, err: err}
+	}()
+	select {
+	case res := <-resCh:
+		if res.err != nil {
+			c.Close()
+		}
+		return res.conn, res.err
+	case <-ctx.Done():
+		c.Close()
+		<-resCh
+		return nil, ctx.Err()
+	}
+}
+
+func httpConnect(c net.Conn, proxyURL *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(c); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy: CONNECT to %s failed: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// The peer might already have sent data, which ended up in our buffer.
+		return &bufferedConn{Conn: c, reader: br}, nil
+	}
+	return c, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	proxyt "github.com/libp2p/go-libp2p/p2p/net/proxy/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startEchoServer starts a server that greets every client, and then echoes the data it receives.
+func startEchoServer(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.Write([]byte("hello"))
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestDial(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		newServer func(user, password string) (*proxyt.Server, error)
+	}{
+		{name: "SOCKS5", newServer: proxyt.NewSOCKS5Server},
+		{name: "HTTP CONNECT", newServer: proxyt.NewHTTPConnectServer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ln := startEchoServer(t)
+			srv, err := tc.newServer("user", "secret")
+			require.NoError(t, err)
+			defer srv.Close()
+
+			d, err := NewDialer(srv.URL())
+			require.NoError(t, err)
+			raddr, err := manet.FromNetAddr(ln.Addr())
+			require.NoError(t, err)
+			c, err := d.DialMultiaddr(context.Background(), raddr)
+			require.NoError(t, err)
+			defer c.Close()
+			require.Equal(t, []string{ln.Addr().String()}, srv.Targets())
+			require.Equal(t, raddr, c.RemoteMultiaddr())
+			require.Equal(t, ln.Addr().String(), c.RemoteAddr().String())
+
+			// TCP options are applied to the connection to the proxy
+			require.NoError(t, c.(interface{ SetKeepAlive(bool) error }).SetKeepAlive(true))
+
+			b := make([]byte, 5)
+			_, err = io.ReadFull(c, b)
+			require.NoError(t, err)
+			require.Equal(t, "hello", string(b))
+			_, err = c.Write([]byte("foobar"))
+			require.NoError(t, err)
+			b = make([]byte, 6)
+			_, err = io.ReadFull(c, b)
+			require.NoError(t, err)
+			require.Equal(t, "foobar", string(b))
+		})
+	}
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	ln := startEchoServer(t)
+	for _, newServer := range []func(user, password string) (*proxyt.Server, error){proxyt.NewSOCKS5Server, proxyt.NewHTTPConnectServer} {
+		srv, err := newServer("user", "secret")
+		require.NoError(t, err)
+		defer srv.Close()
+
+		d, err := NewDialer(srv.URL())
+		require.NoError(t, err)
+		d.proxyURL.User = nil
+		_, err = d.DialContext(context.Background(), "tcp", ln.Addr().String())
+		require.Error(t, err)
+		require.Empty(t, srv.Targets())
+	}
+}
+
+func TestBypass(t *testing.T) {
+	ln := startEchoServer(t)
+	srv, err := proxyt.NewSOCKS5Server("", "")
+	require.NoError(t, err)
+	defer srv.Close()
+
+	_, err = NewDialer(srv.URL(), "localhost")
+	require.Error(t, err)
+	d, err := NewDialer(srv.URL(), "10.0.0.0/8", "127.0.0.1")
+	require.NoError(t, err)
+	require.True(t, d.Bypass(net.ParseIP("10.1.2.3")))
+	require.True(t, d.Bypass(net.ParseIP("127.0.0.1")))
+	require.False(t, d.Bypass(net.ParseIP("1.2.3.4")))
+
+	raddr, err := manet.FromNetAddr(ln.Addr())
+	require.NoError(t, err)
+	c, err := d.DialMultiaddr(context.Background(), raddr)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, raddr, c.RemoteMultiaddr())
+	require.Empty(t, srv.Targets())
+}
+
+func TestNewDialer(t *testing.T) {
+	_, err := NewDialer("https://proxy.example.com")
+	require.EqualError(t, err, `unsupported proxy scheme: "https"`)
+	_, err = NewDialer("socks5://")
+	require.Error(t, err)
+}
+
+func TestDialHostName(t *testing.T) {
+	ln := startEchoServer(t)
+	port := ln.Addr().(*net.TCPAddr).Port
+	for _, newServer := range []func(user, password string) (*proxyt.Server, error){proxyt.NewSOCKS5Server, proxyt.NewHTTPConnectServer} {
+		srv, err := newServer("", "")
+		require.NoError(t, err)
+		defer srv.Close()
+
+		// host names are resolved by the proxy, and never bypass it
+		d, err := NewDialer(srv.URL(), "127.0.0.0/8")
+		require.NoError(t, err)
+		raddr := ma.StringCast(fmt.Sprintf("/dns4/localhost/tcp/%d", port))
+		c, err := d.DialMultiaddr(context.Background(), raddr)
+		require.NoError(t, err)
+		defer c.Close()
+		require.Equal(t, []string{fmt.Sprintf("localhost:%d", port)}, srv.Targets())
+		require.Equal(t, raddr, c.RemoteMultiaddr())
+		require.Equal(t, fmt.Sprintf("localhost:%d", port), c.RemoteAddr().String())
+
+		nc, err := d.DialContext(context.Background(), "tcp", fmt.Sprintf("localhost:%d", port))
+		require.NoError(t, err)
+		defer nc.Close()
+		require.Equal(t, ma.StringCast(fmt.Sprintf("/dns/localhost/tcp/%d", port)), nc.(manet.Conn).RemoteMultiaddr())
+	}
+}
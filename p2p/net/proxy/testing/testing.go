@@ -0,0 +1,293 @@
+// Package testing provides SOCKS5 and HTTP CONNECT proxies for tests.
+package testing
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// Server is a minimal proxy server. It records the addresses it connects to.
+type Server struct {
+	scheme         string
+	user, password string
+
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mutex   sync.Mutex
+	targets []string
+	conns   map[net.Conn]struct{}
+}
+
+// NewSOCKS5Server starts a SOCKS5 proxy on localhost.
+// If user is non-empty, clients need to authenticate with user and password.
+func NewSOCKS5Server(user, password string) (*Server, error) {
+	return newServer("socks5", user, password)
+}
+
+// NewHTTPConnectServer starts an HTTP CONNECT proxy on localhost.
+// If user is non-empty, clients need to authenticate with user and password.
+func NewHTTPConnectServer(user, password string) (*Server, error) {
+	return newServer("http", user, password)
+}
+
+func newServer(scheme, user, password string) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		scheme:   scheme,
+		user:     user,
+		password: password,
+		ln:       ln,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// URL returns the URL of the proxy, including the credentials.
+func (s *Server) URL() string {
+	u := url.URL{Scheme: s.scheme, Host: s.ln.Addr().String()}
+	if s.user != "" {
+		u.User = url.UserPassword(s.user, s.password)
+	}
+	return u.String()
+}
+
+// Targets returns the addresses the proxy connected to.
+func (s *Server) Targets() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.targets...)
+}
+
+// Close stops the proxy and closes all proxied connections.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.mutex.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.trackConn(c)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer c.Close()
+			// the reader might buffer data sent by the client after the handshake
+			br := bufio.NewReader(c)
+			var target net.Conn
+			var err error
+			if s.scheme == "socks5" {
+				target, err = s.handleSOCKS5(br, c)
+			} else {
+				target, err = s.handleHTTPConnect(br, c)
+			}
+			if err != nil {
+				return
+			}
+			s.trackConn(target)
+			defer target.Close()
+			s.pipe(br, c, target)
+		}()
+	}
+}
+
+func (s *Server) trackConn(c net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.conns[c] = struct{}{}
+}
+
+func (s *Server) dial(addr string) (net.Conn, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	s.targets = append(s.targets, addr)
+	s.mutex.Unlock()
+	return c, nil
+}
+
+func (s *Server) pipe(br *bufio.Reader, c, target net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst io.WriteCloser, src io.Reader) {
+		io.Copy(dst, src)
+		dst.Close()
+		done <- struct{}{}
+	}
+	go cp(c, target)
+	go cp(target, br)
+	<-done
+	<-done
+}
+
+func (s *Server) handleSOCKS5(br *bufio.Reader, c net.Conn) (net.Conn, error) {
+	// greeting: version, number of methods, methods
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 5 {
+		return nil, errors.New("unsupported SOCKS version")
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return nil, err
+	}
+	method := byte(0x00) // no authentication required
+	if s.user != "" {
+		method = 0x02 // username / password
+	}
+	var found bool
+	for _, m := range methods {
+		if m == method {
+			found = true
+		}
+	}
+	if !found {
+		c.Write([]byte{5, 0xff})
+		return nil, errors.New("no acceptable authentication method")
+	}
+	if _, err := c.Write([]byte{5, method}); err != nil {
+		return nil, err
+	}
+	if method == 0x02 {
+		if err := s.socks5Authenticate(br, c); err != nil {
+			return nil, err
+		}
+	}
+
+	// request: version, command, reserved, address type
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(br, req); err != nil {
+		return nil, err
+	}
+	if req[1] != 1 { // CONNECT
+		c.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, errors.New("unsupported command")
+	}
+	var host string
+	switch req[3] {
+	case 1, 4:
+		ip := make([]byte, net.IPv4len)
+		if req[3] == 4 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(br, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		l, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		name := make([]byte, l)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		return nil, errors.New("unsupported address type")
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(br, port); err != nil {
+		return nil, err
+	}
+	target, err := s.dial(net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0}) // connection refused
+		return nil, err
+	}
+	local := target.LocalAddr().(*net.TCPAddr)
+	reply := []byte{5, 0, 0, 1}
+	reply = append(reply, local.IP.To4()...)
+	reply = append(reply, byte(local.Port>>8), byte(local.Port))
+	if _, err := c.Write(reply); err != nil {
+		target.Close()
+		return nil, err
+	}
+	return target, nil
+}
+
+func (s *Server) socks5Authenticate(br *bufio.Reader, c net.Conn) error {
+	readString := func() (string, error) {
+		l, err := br.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		b := make([]byte, l)
+		_, err = io.ReadFull(br, b)
+		return string(b), err
+	}
+	if _, err := br.ReadByte(); err != nil { // version of the subnegotiation
+		return err
+	}
+	user, err := readString()
+	if err != nil {
+		return err
+	}
+	password, err := readString()
+	if err != nil {
+		return err
+	}
+	if user != s.user || password != s.password {
+		c.Write([]byte{1, 1})
+		return errors.New("authentication failed")
+	}
+	_, err = c.Write([]byte{1, 0})
+	return err
+}
+
+func (s *Server) handleHTTPConnect(br *bufio.Reader, c net.Conn) (net.Conn, error) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, err
+	}
+	if req.Method != http.MethodConnect {
+		fmt.Fprint(c, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+		return nil, errors.New("unexpected method")
+	}
+	if s.user != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(s.user + ":" + s.password))
+		if req.Header.Get("Proxy-Authorization") != "Basic "+auth {
+			fmt.Fprint(c, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return nil, errors.New("authentication failed")
+		}
+	}
+	target, err := s.dial(req.Host)
+	if err != nil {
+		fmt.Fprint(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return nil, err
+	}
+	if _, err := fmt.Fprint(c, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		target.Close()
+		return nil, err
+	}
+	return target, nil
+}
@@ -0,0 +1,348 @@
+// Package sharedtcp shares a TCP listener between transports.
+//
+// Accepted connections are routed to a transport by sniffing their first bytes:
+// libp2p connections start with multistream-select, WebSocket connections with an HTTP request,
+// and secure WebSocket connections with a TLS handshake. This allows the TCP transport and the
+// WebSocket transport to listen on /tcp/4001 and /tcp/4001/ws at the same time.
+//
+// Connections that can't be sniffed are dropped. This includes connections to a private network,
+// which start with a nonce, so listeners can't be shared on private networks.
+package sharedtcp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/transport"
+
+	logging "github.com/ipfs/go-log/v2"
+
+	ma "github.com/multiformats/go-multiaddr"
+	mafmt "github.com/multiformats/go-multiaddr-fmt"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+var log = logging.Logger("sharedtcp")
+
+// defaultSniffTimeout is the time a client has to send the first bytes of a connection.
+const defaultSniffTimeout = 5 * time.Second
+
+// defaultMaxSniffing is the maximum number of connections that are sniffed at the same time.
+// Further connections wait in the accept queue of the TCP listener.
+const defaultMaxSniffing = 64
+
+// sniffLen is the number of bytes needed to determine the ConnType.
+const sniffLen = 3
+
+// ErrAlreadyListening is returned when listening for the same ConnType on an address twice.
+var ErrAlreadyListening = errors.New("sharedtcp: already listening for this connection type")
+
+// ErrPrivateNetwork is returned by CheckUpgrader if connections are protected by a pre-shared key.
+var ErrPrivateNetwork = errors.New("sharedtcp: can't share listeners on a private network")
+
+// CheckUpgrader returns ErrPrivateNetwork if the connections upgraded by u are protected by a
+// pre-shared key. These connections start with a nonce, so they can't be sniffed.
+func CheckUpgrader(u transport.Upgrader) error {
+	if pn, ok := u.(interface{ PrivateNetwork() bool }); ok && pn.PrivateNetwork() {
+		return ErrPrivateNetwork
+	}
+	return nil
+}
+
+// ConnType is the type of connections a listener accepts.
+type ConnType int
+
+const (
+	// ConnTypeMultistream are libp2p connections, which start with multistream-select.
+	ConnTypeMultistream ConnType = iota + 1
+	// ConnTypeHTTP are plaintext HTTP connections, e.g. WebSocket connections.
+	ConnTypeHTTP
+	// ConnTypeTLS are TLS connections, e.g. secure WebSocket connections.
+	ConnTypeTLS
+)
+
+func (t ConnType) String() string {
+	switch t {
+	case ConnTypeMultistream:
+		return "multistream"
+	case ConnTypeHTTP:
+		return "HTTP"
+	case ConnTypeTLS:
+		return "TLS"
+	default:
+		return fmt.Sprintf("unknown connection type (%d)", int(t))
+	}
+}
+
+// multistream-select messages are prefixed by their (varint) length.
+// The first message is "/multistream/1.0.0\n", which is 19 bytes long.
+var multistreamPrefix = []byte("\x13/m")
+
+var httpMethods = [][]byte{[]byte("GET"), []byte("HEA"), []byte("POS"), []byte("PUT"), []byte("DEL"), []byte("CON"), []byte("OPT"), []byte("TRA"), []byte("PAT")}
+
+// sniff determines the ConnType from the first sniffLen bytes of a connection.
+func sniff(b []byte) (ConnType, bool) {
+	if bytes.Equal(b, multistreamPrefix) {
+		return ConnTypeMultistream, true
+	}
+	// A TLS record of type handshake (22), followed by the major and minor version.
+	if b[0] == 0x16 && b[1] == 0x03 && b[2] <= 0x04 {
+		return ConnTypeTLS, true
+	}
+	for _, m := range httpMethods {
+		if bytes.Equal(b, m) {
+			return ConnTypeHTTP, true
+		}
+	}
+	return 0, false
+}
+
+var listenMatcher = mafmt.And(mafmt.IP, mafmt.Base(ma.P_TCP))
+
+// Manager manages the shared listeners. Transports using the same Manager share a
+// listener when listening on the same address.
+type Manager struct {
+	sniffTimeout time.Duration // can be overwritten by tests
+	// sniffing limits the number of connections that are sniffed at the same time
+	sniffing chan struct{}
+
+	mutex     sync.Mutex
+	listeners map[string]*sharedListener // by listen address
+}
+
+// NewManager creates a new Manager.
+func NewManager() *Manager {
+	return &Manager{
+		sniffTimeout: defaultSniffTimeout,
+		sniffing:     make(chan struct{}, defaultMaxSniffing),
+		listeners:    make(map[string]*sharedListener),
+	}
+}
+
+// Listen returns a listener for connections of type connType on laddr, an /ip4 or /ip6 TCP address.
+// The TCP listener is shared by all listeners for the same address. If the port is 0,
+// a new TCP listener on a random port is created, which can be shared by listening on its address.
+func (m *Manager) Listen(laddr ma.Multiaddr, connType ConnType) (manet.Listener, error) {
+	if !listenMatcher.Matches(laddr) {
+		return nil, fmt.Errorf("sharedtcp: can't listen on %s", laddr)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sl, ok := m.listeners[string(laddr.Bytes())]
+	if !ok {
+		nl, err := manet.Listen(laddr)
+		if err != nil {
+			return nil, err
+		}
+		sl = &sharedListener{
+			mgr:       m,
+			nl:        nl,
+			key:       string(nl.Multiaddr().Bytes()),
+			listeners: make(map[ConnType]*listener),
+			done:      make(chan struct{}),
+		}
+		m.listeners[sl.key] = sl
+		go sl.run()
+	}
+	if _, ok := sl.listeners[connType]; ok {
+		return nil, ErrAlreadyListening
+	}
+	l := &listener{
+		shared:   sl,
+		connType: connType,
+		incoming: make(chan manet.Conn),
+		closed:   make(chan struct{}),
+	}
+	sl.listeners[connType] = l
+	return l, nil
+}
+
+// removeListener removes a demultiplexed listener. When the last one is removed,
+// the TCP listener is closed.
+func (m *Manager) removeListener(l *listener) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	sl := l.shared
+	delete(sl.listeners, l.connType)
+	if len(sl.listeners) == 0 {
+		// The TCP listener might have failed, and a new one been created for the same address.
+		if m.listeners[sl.key] == sl {
+			delete(m.listeners, sl.key)
+		}
+		sl.nl.Close()
+	}
+}
+
+// getListener returns the listener for connType, if any.
+func (m *Manager) getListener(sl *sharedListener, connType ConnType) *listener {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return sl.listeners[connType]
+}
+
+// sharedListener is a TCP listener shared by multiple demultiplexed listeners.
+type sharedListener struct {
+	mgr *Manager
+	nl  manet.Listener
+	key string
+
+	// guarded by the Manager's mutex
+	listeners map[ConnType]*listener
+
+	// closed when the TCP listener fails
+	done chan struct{}
+	err  error
+}
+
+func (sl *sharedListener) run() {
+	defer close(sl.done)
+	for {
+		// Don't accept connections while too many connections are being sniffed.
+		sl.mgr.sniffing <- struct{}{}
+		c, err := sl.nl.Accept()
+		if err != nil {
+			<-sl.mgr.sniffing
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				log.Debugw("temporary accept error", "error", err)
+				continue
+			}
+			sl.err = err
+			sl.mgr.mutex.Lock()
+			if sl.mgr.listeners[sl.key] == sl {
+				delete(sl.mgr.listeners, sl.key)
+			}
+			sl.mgr.mutex.Unlock()
+			return
+		}
+		// Sniffing blocks until the client sends data. Don't block accepting other connections.
+		go sl.handleConn(c)
+	}
+}
+
+func (sl *sharedListener) handleConn(c manet.Conn) {
+	b := make([]byte, sniffLen)
+	c.SetReadDeadline(time.Now().Add(sl.mgr.sniffTimeout))
+	_, err := io.ReadFull(c, b)
+	<-sl.mgr.sniffing
+	if err != nil {
+		log.Debugw("failed to sniff connection", "remote", c.RemoteMultiaddr(), "error", err)
+		c.Close()
+		return
+	}
+	c.SetReadDeadline(time.Time{})
+	connType, ok := sniff(b)
+	if !ok {
+		log.Debugw("failed to determine connection type", "remote", c.RemoteMultiaddr(), "prefix", b)
+		c.Close()
+		return
+	}
+	l := sl.mgr.getListener(sl, connType)
+	if l == nil {
+		log.Debugw("not listening for connection type", "remote", c.RemoteMultiaddr(), "type", connType)
+		c.Close()
+		return
+	}
+	conn, err := newSniffedConn(c, b)
+	if err != nil {
+		c.Close()
+		return
+	}
+	select {
+	case l.incoming <- conn:
+	case <-l.closed:
+		c.Close()
+	}
+}
+
+// listener accepts the connections of one ConnType.
+type listener struct {
+	shared   *sharedListener
+	connType ConnType
+
+	incoming  chan manet.Conn
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ manet.Listener = &listener{}
+
+func (l *listener) Accept() (manet.Conn, error) {
+	select {
+	case c := <-l.incoming:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-l.shared.done:
+		return nil, l.shared.err
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.shared.mgr.removeListener(l)
+	})
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.shared.nl.Addr()
+}
+
+func (l *listener) Multiaddr() ma.Multiaddr {
+	return l.shared.nl.Multiaddr()
+}
+
+// tcpConn are the methods of a *net.TCPConn used by the TCP transport.
+type tcpConn interface {
+	SyscallConn() (syscall.RawConn, error)
+	SetLinger(sec int) error
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(d time.Duration) error
+}
+
+// sniffedConn returns the sniffed bytes before reading from the connection.
+type sniffedConn struct {
+	manet.Conn
+	tcpConn tcpConn
+
+	mutex  sync.Mutex
+	prefix []byte
+}
+
+var _ manet.Conn = &sniffedConn{}
+
+func newSniffedConn(c manet.Conn, prefix []byte) (*sniffedConn, error) {
+	tc, ok := c.(tcpConn)
+	if !ok {
+		return nil, errors.New("sharedtcp: expected a TCP connection")
+	}
+	return &sniffedConn{Conn: c, tcpConn: tc, prefix: prefix}, nil
+}
+
+func (c *sniffedConn) Read(b []byte) (int, error) {
+	c.mutex.Lock()
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		c.mutex.Unlock()
+		return n, nil
+	}
+	c.mutex.Unlock()
+	return c.Conn.Read(b)
+}
+
+func (c *sniffedConn) SyscallConn() (syscall.RawConn, error) { return c.tcpConn.SyscallConn() }
+func (c *sniffedConn) SetLinger(sec int) error               { return c.tcpConn.SetLinger(sec) }
+func (c *sniffedConn) SetKeepAlive(keepalive bool) error     { return c.tcpConn.SetKeepAlive(keepalive) }
+func (c *sniffedConn) SetKeepAlivePeriod(d time.Duration) error {
+	return c.tcpConn.SetKeepAlivePeriod(d)
+}
@@ -0,0 +1,149 @@
+package sharedtcp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniff(t *testing.T) {
+	for _, tc := range []struct {
+		data     string
+		connType ConnType
+	}{
+		{data: "\x13/multistream/1.0.0\n", connType: ConnTypeMultistream},
+		{data: "GET / HTTP/1.1\r\n", connType: ConnTypeHTTP},
+		{data: "POST / HTTP/1.1\r\n", connType: ConnTypeHTTP},
+		{data: "\x16\x03\x01\x02\x00", connType: ConnTypeTLS},
+	} {
+		connType, ok := sniff([]byte(tc.data[:sniffLen]))
+		require.True(t, ok, tc.data)
+		require.Equal(t, tc.connType, connType, tc.data)
+	}
+	for _, data := range []string{"foobar", "\x16\x03\x05", "\x14/multistream"} {
+		_, ok := sniff([]byte(data[:sniffLen]))
+		require.False(t, ok, data)
+	}
+}
+
+// connect dials l and sends data.
+func connect(t *testing.T, l manet.Listener, data string) net.Conn {
+	t.Helper()
+	c, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	_, err = c.Write([]byte(data))
+	require.NoError(t, err)
+	return c
+}
+
+func accept(t *testing.T, l manet.Listener, data string) manet.Conn {
+	t.Helper()
+	c, err := l.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	b := make([]byte, len(data))
+	_, err = io.ReadFull(c, b)
+	require.NoError(t, err)
+	require.Equal(t, data, string(b))
+	return c
+}
+
+func requireClosed(t *testing.T, c net.Conn) {
+	t.Helper()
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err := c.Read(make([]byte, 1))
+	// Depending on the timing, the connection is closed or reset.
+	require.Error(t, err)
+	require.False(t, errors.Is(err, os.ErrDeadlineExceeded))
+}
+
+func TestListen(t *testing.T) {
+	m := NewManager()
+	_, err := m.Listen(ma.StringCast("/ip4/127.0.0.1/udp/0"), ConnTypeMultistream)
+	require.Error(t, err)
+
+	msl, err := m.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"), ConnTypeMultistream)
+	require.NoError(t, err)
+	defer msl.Close()
+	httpl, err := m.Listen(msl.Multiaddr(), ConnTypeHTTP)
+	require.NoError(t, err)
+	defer httpl.Close()
+	require.Equal(t, msl.Multiaddr(), httpl.Multiaddr())
+	_, err = m.Listen(msl.Multiaddr(), ConnTypeHTTP)
+	require.ErrorIs(t, err, ErrAlreadyListening)
+
+	const multistream = "\x13/multistream/1.0.0\n"
+	const http = "GET / HTTP/1.1\r\n\r\n"
+	connect(t, msl, multistream)
+	connect(t, msl, http)
+	accept(t, httpl, http)
+	c := accept(t, msl, multistream)
+
+	// TCP options can be set on accepted connections
+	require.NoError(t, c.(interface{ SetKeepAlive(bool) error }).SetKeepAlive(true))
+	require.NoError(t, c.(interface{ SetLinger(int) error }).SetLinger(0))
+
+	// unknown protocols, and protocols we're not listening for, are dropped
+	requireClosed(t, connect(t, msl, "foobar"))
+	requireClosed(t, connect(t, msl, "\x16\x03\x01\x02\x00"))
+}
+
+func TestSniffTimeout(t *testing.T) {
+	m := NewManager()
+	m.sniffTimeout = 50 * time.Millisecond
+	l, err := m.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"), ConnTypeMultistream)
+	require.NoError(t, err)
+	defer l.Close()
+	requireClosed(t, connect(t, l, "\x13"))
+}
+
+func TestMaxSniffing(t *testing.T) {
+	m := NewManager()
+	m.sniffTimeout = 500 * time.Millisecond
+	m.sniffing = make(chan struct{}, 1)
+	l, err := m.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"), ConnTypeMultistream)
+	require.NoError(t, err)
+	defer l.Close()
+
+	// The first connection doesn't send anything, so the second one is only sniffed once it times out.
+	start := time.Now()
+	c := connect(t, l, "")
+	connect(t, l, "\x13/m")
+	accept(t, l, "\x13/m")
+	require.Greater(t, time.Since(start), 400*time.Millisecond)
+	requireClosed(t, c)
+}
+
+func TestClose(t *testing.T) {
+	m := NewManager()
+	msl, err := m.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"), ConnTypeMultistream)
+	require.NoError(t, err)
+	laddr := msl.Multiaddr()
+	httpl, err := m.Listen(laddr, ConnTypeHTTP)
+	require.NoError(t, err)
+
+	// The TCP listener is kept open until all listeners are closed.
+	require.NoError(t, msl.Close())
+	_, err = msl.Accept()
+	require.ErrorIs(t, err, net.ErrClosed)
+	connect(t, httpl, "GET")
+	accept(t, httpl, "GET")
+	msl, err = m.Listen(laddr, ConnTypeMultistream)
+	require.NoError(t, err)
+	require.NoError(t, msl.Close())
+
+	require.NoError(t, httpl.Close())
+	// the port is free now
+	nl, err := manet.Listen(laddr)
+	require.NoError(t, err)
+	nl.Close()
+}
@@ -8,6 +8,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/libp2p/go-libp2p/p2p/net/datagram"
+
 	ic "github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -21,6 +23,31 @@ import (
 // ErrConnClosed is returned when operating on a closed connection.
 var ErrConnClosed = errors.New("connection closed")
 
+// ErrDatagramsNotSupported is returned when using datagrams on a connection that doesn't support them.
+// Transports return the same error.
+var ErrDatagramsNotSupported = datagram.ErrNotSupported
+
+// DatagramConn is implemented by the connections returned by the swarm.
+// Datagrams are unreliable and unordered, and are only supported by some
+// transports (e.g. QUIC, if enabled on both sides), see SupportsDatagrams.
+type DatagramConn interface {
+	network.Conn
+
+	// SupportsDatagrams returns whether datagrams can be sent on this connection.
+	SupportsDatagrams() bool
+	// SendDatagram sends b as a datagram.
+	SendDatagram(b []byte) error
+	// ReceiveDatagram returns the next datagram received on this connection.
+	ReceiveDatagram(ctx context.Context) ([]byte, error)
+}
+
+// datagramConn is implemented by transport connections that support datagrams.
+type datagramConn interface {
+	SupportsDatagrams() bool
+	SendDatagram([]byte) error
+	ReceiveDatagram(context.Context) ([]byte, error)
+}
+
 // Conn is the connection type used by swarm. In general, you won't use this
 // type directly.
 type Conn struct {
@@ -41,7 +68,7 @@ type Conn struct {
 	stat network.ConnStats
 }
 
-var _ network.Conn = &Conn{}
+var _ DatagramConn = &Conn{}
 
 func (c *Conn) ID() string {
 	// format: <first 10 chars of peer id>-<global conn ordinal>
@@ -248,6 +275,32 @@ func (c *Conn) GetStreams() []network.Stream {
 	return streams
 }
 
+// SupportsDatagrams returns whether datagrams can be sent on this connection.
+func (c *Conn) SupportsDatagrams() bool {
+	dc, ok := c.conn.(datagramConn)
+	return ok && dc.SupportsDatagrams()
+}
+
+// SendDatagram sends b as a datagram.
+// It returns ErrDatagramsNotSupported if the connection doesn't support datagrams.
+func (c *Conn) SendDatagram(b []byte) error {
+	dc, ok := c.conn.(datagramConn)
+	if !ok || !dc.SupportsDatagrams() {
+		return ErrDatagramsNotSupported
+	}
+	return dc.SendDatagram(b)
+}
+
+// ReceiveDatagram returns the next datagram received on this connection.
+// It returns ErrDatagramsNotSupported if the connection doesn't support datagrams.
+func (c *Conn) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	dc, ok := c.conn.(datagramConn)
+	if !ok || !dc.SupportsDatagrams() {
+		return nil, ErrDatagramsNotSupported
+	}
+	return dc.ReceiveDatagram(ctx)
+}
+
 func (c *Conn) Scope() network.ConnScope {
 	return c.conn.Scope()
 }
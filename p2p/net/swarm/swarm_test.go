@@ -15,6 +15,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	. "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
 
 	"github.com/libp2p/go-libp2p-core/control"
 	"github.com/libp2p/go-libp2p-core/network"
@@ -390,6 +391,64 @@ func TestTypedNilConn(t *testing.T) {
 	require.Nil(t, c)
 }
 
+func TestDatagrams(t *testing.T) {
+	s1 := GenSwarm(t, OptDisableTCP, OptQUICOptions(quic.EnableDatagrams()))
+	defer s1.Close()
+	s2 := GenSwarm(t, OptDisableTCP, OptQUICOptions(quic.EnableDatagrams()))
+	defer s2.Close()
+	s2.Peerstore().AddAddrs(s1.LocalPeer(), s1.ListenAddresses(), peerstore.PermanentAddrTTL)
+
+	c, err := s2.DialPeer(context.Background(), s1.LocalPeer())
+	require.NoError(t, err)
+	dc := c.(swarm.DatagramConn)
+	require.True(t, dc.SupportsDatagrams())
+	require.Eventually(t, func() bool { return len(s1.ConnsToPeer(s2.LocalPeer())) == 1 }, time.Second, 10*time.Millisecond)
+	remote := s1.ConnsToPeer(s2.LocalPeer())[0].(swarm.DatagramConn)
+	require.True(t, remote.SupportsDatagrams())
+
+	// datagrams are unreliable, so keep sending until one arrives
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				dc.SendDatagram([]byte("foobar"))
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	b, err := remote.ReceiveDatagram(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foobar"), b)
+}
+
+func TestDatagramsNotSupported(t *testing.T) {
+	// datagrams need to be enabled on both sides
+	s1 := GenSwarm(t, OptDisableTCP)
+	defer s1.Close()
+	s2 := GenSwarm(t, OptQUICOptions(quic.EnableDatagrams()))
+	defer s2.Close()
+	// TCP doesn't support datagrams
+	s3 := GenSwarm(t, OptDisableQUIC)
+	defer s3.Close()
+	s2.Peerstore().AddAddrs(s1.LocalPeer(), s1.ListenAddresses(), peerstore.PermanentAddrTTL)
+	s2.Peerstore().AddAddrs(s3.LocalPeer(), s3.ListenAddresses(), peerstore.PermanentAddrTTL)
+
+	for _, p := range []peer.ID{s1.LocalPeer(), s3.LocalPeer()} {
+		c, err := s2.DialPeer(context.Background(), p)
+		require.NoError(t, err)
+		dc := c.(swarm.DatagramConn)
+		require.False(t, dc.SupportsDatagrams())
+		require.ErrorIs(t, dc.SendDatagram([]byte("foobar")), swarm.ErrDatagramsNotSupported)
+		_, err = dc.ReceiveDatagram(context.Background())
+		require.ErrorIs(t, err, swarm.ErrDatagramsNotSupported)
+	}
+}
+
 func TestPreventDialListenAddr(t *testing.T) {
 	s := GenSwarm(t, OptDialOnly)
 	if err := s.Listen(ma.StringCast("/ip4/0.0.0.0/udp/0/quic")); err != nil {
@@ -33,6 +33,7 @@ type config struct {
 	dialOnly         bool
 	disableTCP       bool
 	disableQUIC      bool
+	quicOpts         []quic.Option
 	dialTimeout      time.Duration
 	connectionGater  connmgr.ConnectionGater
 	rcmgr            network.ResourceManager
@@ -80,6 +81,13 @@ var OptDisableQUIC Option = func(_ *testing.T, c *config) {
 	c.disableQUIC = true
 }
 
+// OptQUICOptions passes the given options to the QUIC transport of this test swarm.
+func OptQUICOptions(opts ...quic.Option) Option {
+	return func(_ *testing.T, c *config) {
+		c.quicOpts = append(c.quicOpts, opts...)
+	}
+}
+
 // OptConnGater configures the given connection gater on the test
 func OptConnGater(cg connmgr.ConnectionGater) Option {
 	return func(_ *testing.T, c *config) {
@@ -182,7 +190,7 @@ func GenSwarm(t *testing.T, opts ...Option) *swarm.Swarm {
 		}
 	}
 	if !cfg.disableQUIC {
-		quicTransport, err := quic.NewTransport(p.PrivKey, nil, cfg.connectionGater, nil)
+		quicTransport, err := quic.NewTransport(p.PrivKey, nil, cfg.connectionGater, nil, cfg.quicOpts...)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -95,6 +95,11 @@ func New(secureMuxer sec.SecureMuxer, muxer network.Multiplexer, opts ...Option)
 	return u, nil
 }
 
+// PrivateNetwork returns true if connections are protected by a pre-shared key.
+func (u *upgrader) PrivateNetwork() bool {
+	return len(u.psk) > 0
+}
+
 // UpgradeListener upgrades the passed multiaddr-net listener into a full libp2p-transport listener.
 func (u *upgrader) UpgradeListener(t transport.Transport, list manet.Listener) transport.Listener {
 	ctx, cancel := context.WithCancel(context.Background())
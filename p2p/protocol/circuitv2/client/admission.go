@@ -0,0 +1,95 @@
+package client
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// AdmissionPolicy controls which incoming relayed connections are accepted by the client.
+// The zero value accepts all relayed connections.
+type AdmissionPolicy struct {
+	// AllowedPeers is the (optional) set of source peers that are allowed to connect to us
+	// through a relay. If empty, any peer is allowed.
+	AllowedPeers []peer.ID
+	// AllowedRelays is the (optional) set of relays that we accept relayed connections through.
+	// If empty, any relay is allowed.
+	AllowedRelays []peer.ID
+
+	// MaxConnsPerRelay is the maximum number of concurrent relayed connections through the same
+	// relay. If 0, there is no limit.
+	MaxConnsPerRelay int
+	// MaxConns is the maximum number of concurrent relayed connections. If 0, there is no limit.
+	MaxConns int
+}
+
+// admission tracks the incoming relayed connections admitted under an AdmissionPolicy.
+type admission struct {
+	allowedPeers  map[peer.ID]struct{}
+	allowedRelays map[peer.ID]struct{}
+
+	maxConnsPerRelay int
+	maxConns         int
+
+	conns    map[peer.ID]int // relay -> number of admitted connections
+	numConns int
+}
+
+func newAdmission(p AdmissionPolicy) *admission {
+	a := &admission{
+		maxConnsPerRelay: p.MaxConnsPerRelay,
+		maxConns:         p.MaxConns,
+		conns:            make(map[peer.ID]int),
+	}
+	if len(p.AllowedPeers) > 0 {
+		a.allowedPeers = make(map[peer.ID]struct{}, len(p.AllowedPeers))
+		for _, p := range p.AllowedPeers {
+			a.allowedPeers[p] = struct{}{}
+		}
+	}
+	if len(p.AllowedRelays) > 0 {
+		a.allowedRelays = make(map[peer.ID]struct{}, len(p.AllowedRelays))
+		for _, p := range p.AllowedRelays {
+			a.allowedRelays[p] = struct{}{}
+		}
+	}
+	return a
+}
+
+// allowed returns true if relayed connections from src through relay are permitted.
+func (a *admission) allowed(src, relay peer.ID) bool {
+	if a.allowedPeers != nil {
+		if _, ok := a.allowedPeers[src]; !ok {
+			return false
+		}
+	}
+	if a.allowedRelays != nil {
+		if _, ok := a.allowedRelays[relay]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// admit reserves a connection slot for a relayed connection through relay.
+// It returns false if the connection limits are exceeded.
+// Must be called with the client mutex held.
+func (a *admission) admit(relay peer.ID) bool {
+	if a.maxConns > 0 && a.numConns >= a.maxConns {
+		return false
+	}
+	if a.maxConnsPerRelay > 0 && a.conns[relay] >= a.maxConnsPerRelay {
+		return false
+	}
+	a.numConns++
+	a.conns[relay]++
+	return true
+}
+
+// release releases a connection slot obtained with admit.
+// Must be called with the client mutex held.
+func (a *admission) release(relay peer.ID) {
+	a.numConns--
+	a.conns[relay]--
+	if a.conns[relay] <= 0 {
+		delete(a.conns, relay)
+	}
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"sync"
 
@@ -35,6 +36,10 @@ type Client struct {
 	mx          sync.Mutex
 	activeDials map[peer.ID]*completion
 	hopCount    map[peer.ID]int
+	admission   *admission
+
+	// maxHops is the maximum number of relays we dial through. See WithMultiHop.
+	maxHops int
 }
 
 var _ io.Closer = &Client{}
@@ -53,7 +58,7 @@ type completion struct {
 
 // New constructs a new p2p-circuit/v2 client, attached to the given host and using the given
 // upgrader to perform connection upgrades.
-func New(h host.Host, upgrader transport.Upgrader) (*Client, error) {
+func New(h host.Host, upgrader transport.Upgrader, opts ...Option) (*Client, error) {
 	cl := &Client{
 
 		host:        h,
@@ -61,6 +66,13 @@ func New(h host.Host, upgrader transport.Upgrader) (*Client, error) {
 		incoming:    make(chan accept),
 		activeDials: make(map[peer.ID]*completion),
 		hopCount:    make(map[peer.ID]int),
+		admission:   newAdmission(AdmissionPolicy{}),
+		maxHops:     1,
+	}
+	for _, opt := range opts {
+		if err := opt(cl); err != nil {
+			return nil, fmt.Errorf("error applying circuit client option: %w", err)
+		}
 	}
 	cl.ctx, cl.ctxCancel = context.WithCancel(context.Background())
 	return cl, nil
@@ -5,6 +5,8 @@ import (
 	"net"
 	"time"
 
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 
@@ -15,12 +17,9 @@ import (
 // HopTagWeight is the connection manager weight for connections carrying relay hop streams
 var HopTagWeight = 5
 
-type statLimitDuration struct{}
-type statLimitData struct{}
-
 var (
-	StatLimitDuration = statLimitDuration{}
-	StatLimitData     = statLimitData{}
+	StatLimitDuration = util.StatLimitDuration
+	StatLimitData     = util.StatLimitData
 )
 
 type Conn struct {
@@ -30,6 +29,9 @@ type Conn struct {
 	stat network.ConnStats
 
 	client *Client
+	// admitted is true if this is an incoming connection that holds a slot of the admission policy.
+	// Guarded by the client's mutex.
+	admitted bool
 }
 
 type NetAddr struct {
@@ -52,15 +54,20 @@ var _ manet.Conn = (*Conn)(nil)
 
 func (c *Conn) Close() error {
 	c.untagHop()
+	c.release()
 	return c.stream.Reset()
 }
 
 func (c *Conn) Read(buf []byte) (int, error) {
-	return c.stream.Read(buf)
+	n, err := c.stream.Read(buf)
+	util.CountData(c.stat, n, 0)
+	return n, err
 }
 
 func (c *Conn) Write(buf []byte) (int, error) {
-	return c.stream.Write(buf)
+	n, err := c.stream.Write(buf)
+	util.CountData(c.stat, 0, n)
+	return n, err
 }
 
 func (c *Conn) SetDeadline(t time.Time) error {
@@ -144,3 +151,14 @@ func (c *Conn) untagHop() {
 		delete(c.client.hopCount, p)
 	}
 }
+
+// release frees the admission slot held by an incoming relayed connection.
+func (c *Conn) release() {
+	c.client.mx.Lock()
+	defer c.client.mx.Unlock()
+
+	if c.admitted {
+		c.admitted = false
+		c.client.admission.release(c.stream.Conn().RemotePeer())
+	}
+}
@@ -42,10 +42,14 @@ func isRelayError(err error) bool {
 
 // dialer
 func (c *Client) dial(ctx context.Context, a ma.Multiaddr, p peer.ID) (*Conn, error) {
+	if hops := circuitHops(a); hops > c.maxHops {
+		return nil, fmt.Errorf("can't dial %s: circuit traverses %d relays, at most %d allowed", a, hops, c.maxHops)
+	}
+
 	// split /a/p2p-circuit/b into (/a, /p2p-circuit/b)
-	relayaddr, destaddr := ma.SplitFunc(a, func(c ma.Component) bool {
-		return c.Protocol().Code == ma.P_CIRCUIT
-	})
+	// For multi-hop circuits, the relay address is a circuit address itself:
+	// /r1/p2p-circuit/r2/p2p-circuit/b is split into (/r1/p2p-circuit/r2, /p2p-circuit/b)
+	relayaddr, destaddr := splitLastCircuit(a)
 
 	// If the address contained no /p2p-circuit part, the second part is nil.
 	if destaddr == nil {
@@ -125,6 +129,13 @@ func (c *Client) dialPeer(ctx context.Context, relay, dest peer.AddrInfo) (*Conn
 
 	dialCtx, cancel := context.WithTimeout(ctx, DialRelayTimeout)
 	defer cancel()
+	for _, addr := range relay.Addrs {
+		if circuitHops(addr) > 0 {
+			// multi-hop circuit: the connection to the relay is relayed itself
+			dialCtx = network.WithUseTransient(dialCtx, "relay hop")
+			break
+		}
+	}
 	s, err := c.host.NewStream(dialCtx, relay.ID, proto.ProtoIDv2Hop, proto.ProtoIDv1)
 	if err != nil {
 		return nil, fmt.Errorf("error opening hop stream to relay: %w", err)
@@ -192,10 +203,7 @@ func (c *Client) connectV2(s network.Stream, dest peer.AddrInfo) (*Conn, error)
 	// relay connection and we mark the connection as transient.
 	var stat network.ConnStats
 	if limit := msg.GetLimit(); limit != nil {
-		stat.Transient = true
-		stat.Extra = make(map[interface{}]interface{})
-		stat.Extra[StatLimitDuration] = time.Duration(limit.GetDuration()) * time.Second
-		stat.Extra[StatLimitData] = limit.GetData()
+		stat = util.NewLimitedStat(limit)
 	}
 
 	return &Conn{stream: s, remote: dest, stat: stat, client: c}, nil
@@ -249,3 +257,33 @@ func (c *Client) connectV1(s network.Stream, dest peer.AddrInfo) (*Conn, error)
 
 	return &Conn{stream: s, remote: dest, client: c}, nil
 }
+
+// circuitHops returns the number of relays the given address traverses.
+func circuitHops(a ma.Multiaddr) int {
+	var hops int
+	ma.ForEach(a, func(c ma.Component) bool {
+		if c.Protocol().Code == ma.P_CIRCUIT {
+			hops++
+		}
+		return true
+	})
+	return hops
+}
+
+// splitLastCircuit splits an address at its last /p2p-circuit component.
+// The second part starts with the /p2p-circuit component, and is nil if the address doesn't
+// contain any /p2p-circuit component.
+func splitLastCircuit(a ma.Multiaddr) (ma.Multiaddr, ma.Multiaddr) {
+	comps := ma.Split(a)
+	for i := len(comps) - 1; i >= 0; i-- {
+		if comps[i].Protocols()[0].Code != ma.P_CIRCUIT {
+			continue
+		}
+		var relayaddr ma.Multiaddr
+		if i > 0 {
+			relayaddr = ma.Join(comps[:i]...)
+		}
+		return relayaddr, ma.Join(comps[i:]...)
+	}
+	return a, nil
+}
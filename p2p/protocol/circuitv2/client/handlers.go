@@ -8,6 +8,7 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
 
 	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 )
 
 var (
@@ -69,22 +70,33 @@ func (c *Client) handleStreamV2(s network.Stream) {
 	// relay connection and we mark the connection as transient.
 	var stat network.ConnStats
 	if limit := msg.GetLimit(); limit != nil {
-		stat.Transient = true
-		stat.Extra = make(map[interface{}]interface{})
-		stat.Extra[StatLimitDuration] = time.Duration(limit.GetDuration()) * time.Second
-		stat.Extra[StatLimitData] = limit.GetData()
+		stat = util.NewLimitedStat(limit)
+	}
+
+	relay := s.Conn().RemotePeer()
+	if !c.admission.allowed(src.ID, relay) {
+		log.Debugf("refusing relayed connection from %s through %s; permission denied", src.ID, relay)
+		handleError(pbv2.Status_PERMISSION_DENIED)
+		return
+	}
+	conn, ok := c.admit(s, src, stat)
+	if !ok {
+		log.Debugf("refusing relayed connection from %s through %s; too many relayed connections", src.ID, relay)
+		handleError(pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
+		return
 	}
 
 	log.Debugf("incoming relay connection from: %s", src.ID)
 
 	select {
 	case c.incoming <- accept{
-		conn: &Conn{stream: s, remote: src, stat: stat, client: c},
+		conn: conn,
 		writeResponse: func() error {
 			return writeResponse(pbv2.Status_OK)
 		},
 	}:
 	case <-time.After(AcceptTimeout):
+		conn.release()
 		handleError(pbv2.Status_CONNECTION_FAILED)
 	}
 }
@@ -157,16 +169,41 @@ func (c *Client) handleStreamV1(s network.Stream) {
 		return
 	}
 
+	relay := s.Conn().RemotePeer()
+	if !c.admission.allowed(src.ID, relay) {
+		log.Debugf("refusing relayed connection from %s through %s; permission denied", src.ID, relay)
+		handleError(pbv1.CircuitRelay_STOP_RELAY_REFUSED)
+		return
+	}
+	conn, ok := c.admit(s, src, network.ConnStats{})
+	if !ok {
+		log.Debugf("refusing relayed connection from %s through %s; too many relayed connections", src.ID, relay)
+		handleError(pbv1.CircuitRelay_STOP_RELAY_REFUSED)
+		return
+	}
+
 	log.Debugf("incoming relay connection from: %s", src.ID)
 
 	select {
 	case c.incoming <- accept{
-		conn: &Conn{stream: s, remote: src, client: c},
+		conn: conn,
 		writeResponse: func() error {
 			return writeResponse(pbv1.CircuitRelay_SUCCESS)
 		},
 	}:
 	case <-time.After(AcceptTimeout):
+		conn.release()
 		handleError(pbv1.CircuitRelay_STOP_RELAY_REFUSED)
 	}
 }
+
+// admit creates an incoming relayed connection, if the admission policy's connection limits allow it.
+func (c *Client) admit(s network.Stream, src peer.AddrInfo, stat network.ConnStats) (*Conn, bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if !c.admission.admit(s.Conn().RemotePeer()) {
+		return nil, false
+	}
+	return &Conn{stream: s, remote: src, stat: stat, client: c, admitted: true}, true
+}
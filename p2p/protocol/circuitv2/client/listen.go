@@ -23,6 +23,7 @@ func (l *Listener) Accept() (manet.Conn, error) {
 			err := evt.writeResponse()
 			if err != nil {
 				log.Debugf("error writing relay response: %s", err.Error())
+				evt.conn.release()
 				evt.conn.stream.Reset()
 				continue
 			}
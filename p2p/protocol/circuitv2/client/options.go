@@ -0,0 +1,30 @@
+package client
+
+import "errors"
+
+// Option is a Client option.
+type Option func(*Client) error
+
+// WithMultiHop enables dialing peers through chains of up to maxHops relays, using addresses
+// of the form /p2p/R1/p2p-circuit/p2p/R2/p2p-circuit/p2p/D.
+// The relays along the chain need to enable multi-hop relaying as well.
+func WithMultiHop(maxHops int) Option {
+	return func(c *Client) error {
+		if maxHops < 1 {
+			return errors.New("the maximum number of hops must be at least 1")
+		}
+		c.maxHops = maxHops
+		return nil
+	}
+}
+
+// WithAdmissionPolicy sets the policy for accepting incoming relayed connections.
+func WithAdmissionPolicy(p AdmissionPolicy) Option {
+	return func(c *Client) error {
+		if p.MaxConns < 0 || p.MaxConnsPerRelay < 0 {
+			return errors.New("connection limits must not be negative")
+		}
+		c.admission = newAdmission(p)
+		return nil
+	}
+}
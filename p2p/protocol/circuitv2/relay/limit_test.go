@@ -0,0 +1,50 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+type limitedConn struct {
+	network.Conn
+	stat network.ConnStats
+}
+
+func (c *limitedConn) Stat() network.ConnStats { return c.stat }
+
+func newLimitedConn(duration uint32, data uint64, opened time.Time, dataUsed int) *limitedConn {
+	stat := util.NewLimitedStat(&pbv2.Limit{Duration: &duration, Data: &data})
+	stat.Opened = opened
+	util.CountData(stat, dataUsed, 0)
+	return &limitedConn{stat: stat}
+}
+
+func TestCircuitLimit(t *testing.T) {
+	r := &Relay{rc: DefaultResources()}
+	r.rc.Limit = &RelayLimit{Duration: time.Minute, Data: 1 << 17}
+
+	// the remaining limit of a relayed hop is composed with the relay's limit
+	limit, ok := r.circuitLimit(newLimitedConn(60, 1<<16, time.Now().Add(-30*time.Second), 1<<10))
+	if !ok {
+		t.Fatal("expected the circuit to be allowed")
+	}
+	if limit.Duration > 30*time.Second || limit.Duration < 29*time.Second {
+		t.Fatalf("unexpected duration limit: %s", limit.Duration)
+	}
+	if limit.Data != 1<<16-1<<10 {
+		t.Fatalf("unexpected data limit: %d", limit.Data)
+	}
+
+	// circuits over hops with an expired or exhausted limit are refused
+	if _, ok := r.circuitLimit(newLimitedConn(60, 1<<16, time.Now().Add(-time.Minute), 0)); ok {
+		t.Fatal("expected the circuit over an expired hop to be refused")
+	}
+	if _, ok := r.circuitLimit(newLimitedConn(60, 1<<16, time.Now(), 1<<16)); ok {
+		t.Fatal("expected the circuit over an exhausted hop to be refused")
+	}
+}
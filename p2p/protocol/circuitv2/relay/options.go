@@ -1,5 +1,7 @@
 package relay
 
+import "errors"
+
 type Option func(*Relay) error
 
 // WithResources is a Relay option that sets specific relay resources for the relay.
@@ -25,3 +27,18 @@ func WithACL(acl ACLFilter) Option {
 		return nil
 	}
 }
+
+// WithMultiHop is a Relay option that allows relaying connections (and accepting reservations)
+// over relayed connections, so that circuits can be chained through up to maxHops relays,
+// including this one.
+// The limits of relayed connections that are part of a circuit are composed with the relay's
+// own limit, so that the endpoints learn the effective limit of the whole circuit.
+func WithMultiHop(maxHops int) Option {
+	return func(r *Relay) error {
+		if maxHops < 1 {
+			return errors.New("the maximum number of hops must be at least 1")
+		}
+		r.maxHops = maxHops
+		return nil
+	}
+}
@@ -57,6 +57,10 @@ type Relay struct {
 	rsvp  map[peer.ID]time.Time
 	conns map[peer.ID]int
 
+	// maxHops is the maximum number of relays a circuit through this relay may traverse.
+	// See WithMultiHop.
+	maxHops int
+
 	selfAddr ma.Multiaddr
 }
 
@@ -65,13 +69,14 @@ func New(h host.Host, opts ...Option) (*Relay, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	r := &Relay{
-		ctx:    ctx,
-		cancel: cancel,
-		host:   h,
-		rc:     DefaultResources(),
-		acl:    nil,
-		rsvp:   make(map[peer.ID]time.Time),
-		conns:  make(map[peer.ID]int),
+		ctx:     ctx,
+		cancel:  cancel,
+		host:    h,
+		rc:      DefaultResources(),
+		acl:     nil,
+		rsvp:    make(map[peer.ID]time.Time),
+		conns:   make(map[peer.ID]int),
+		maxHops: 1,
 	}
 
 	for _, opt := range opts {
@@ -170,8 +175,9 @@ func (r *Relay) handleReserve(s network.Stream) {
 	p := s.Conn().RemotePeer()
 	a := s.Conn().RemoteMultiaddr()
 
-	if isRelayAddr(a) {
-		log.Debugf("refusing relay reservation for %s; reservation attempt over relay connection")
+	// A circuit to p through us traverses all the relays of the connection the reservation was made on.
+	if circuitHops(a)+1 > r.maxHops {
+		log.Debugf("refusing relay reservation for %s; reservation attempt over relay connection", p)
 		r.handleError(s, pbv2.Status_PERMISSION_DENIED)
 		return
 	}
@@ -182,6 +188,13 @@ func (r *Relay) handleReserve(s network.Stream) {
 		return
 	}
 
+	limit, ok := r.circuitLimit(s.Conn())
+	if !ok {
+		log.Debugf("refusing relay reservation for %s; limit of the relayed connection used up", p)
+		r.handleError(s, pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
+		return
+	}
+
 	r.mx.Lock()
 	now := time.Now()
 
@@ -205,7 +218,7 @@ func (r *Relay) handleReserve(s network.Stream) {
 	// Delivery of the reservation might fail for a number of reasons.
 	// For example, the stream might be reset or the connection might be closed before the reservation is received.
 	// In that case, the reservation will just be garbage collected later.
-	if err := r.writeResponse(s, pbv2.Status_OK, r.makeReservationMsg(p, expire), r.makeLimitMsg(p)); err != nil {
+	if err := r.writeResponse(s, pbv2.Status_OK, r.makeReservationMsg(p, expire), r.makeLimitMsg(limit)); err != nil {
 		log.Debugf("error writing reservation response; retracting reservation for %s", p)
 		s.Reset()
 	}
@@ -234,8 +247,9 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) {
 		return
 	}
 
-	if isRelayAddr(a) {
-		log.Debugf("refusing connection from %s; connection attempt over relay connection")
+	srcHops := circuitHops(a)
+	if srcHops+1 > r.maxHops {
+		log.Debugf("refusing connection from %s; connection attempt over relay connection", src)
 		fail(pbv2.Status_PERMISSION_DENIED)
 		return
 	}
@@ -252,6 +266,14 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) {
 		return
 	}
 
+	// the connection to the destination might be relayed as well
+	destHops := r.destHops(dest.ID)
+	if srcHops+destHops+1 > r.maxHops {
+		log.Debugf("refusing connection from %s to %s; too many hops", src, dest.ID)
+		fail(pbv2.Status_PERMISSION_DENIED)
+		return
+	}
+
 	r.mx.Lock()
 	_, rsvp := r.rsvp[dest.ID]
 	if !rsvp {
@@ -293,6 +315,9 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) {
 	defer cancel()
 
 	ctx = network.WithNoDial(ctx, "relay connect")
+	if destHops > 0 {
+		ctx = network.WithUseTransient(ctx, "relay connect")
+	}
 
 	bs, err := r.host.NewStream(ctx, dest.ID, proto.ProtoIDv2Stop)
 	if err != nil {
@@ -329,7 +354,13 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) {
 	var stopmsg pbv2.StopMessage
 	stopmsg.Type = pbv2.StopMessage_CONNECT.Enum()
 	stopmsg.Peer = util.PeerInfoToPeerV2(peer.AddrInfo{ID: src})
-	stopmsg.Limit = r.makeLimitMsg(dest.ID)
+	limit, ok := r.circuitLimit(s.Conn(), bs.Conn())
+	if !ok {
+		log.Debugf("refusing connection from %s to %s; limit of a relayed connection used up", src, dest.ID)
+		fail(pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
+		return
+	}
+	stopmsg.Limit = r.makeLimitMsg(limit)
 
 	bs.SetDeadline(time.Now().Add(HandshakeTimeout))
 
@@ -364,7 +395,7 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) {
 	var response pbv2.HopMessage
 	response.Type = pbv2.HopMessage_STATUS.Enum()
 	response.Status = pbv2.Status_OK.Enum()
-	response.Limit = r.makeLimitMsg(dest.ID)
+	response.Limit = r.makeLimitMsg(limit)
 
 	wr = util.NewDelimitedWriter(s)
 	// 写消息
@@ -393,13 +424,15 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) {
 		}
 	}
 
-	if r.rc.Limit != nil {
-		deadline := time.Now().Add(r.rc.Limit.Duration)
+	if limit != nil && limit.Duration > 0 {
+		deadline := time.Now().Add(limit.Duration)
 		s.SetDeadline(deadline)
 		bs.SetDeadline(deadline)
+	}
+	if limit != nil && limit.Data > 0 {
 		// 统计流量
-		go r.relayLimited(s, bs, src, dest.ID, r.rc.Limit.Data, done)
-		go r.relayLimited(bs, s, dest.ID, src, r.rc.Limit.Data, done)
+		go r.relayLimited(s, bs, src, dest.ID, limit.Data, done)
+		go r.relayLimited(bs, s, dest.ID, src, limit.Data, done)
 	} else {
 		go r.relayUnlimited(s, bs, src, dest.ID, done)
 		go r.relayUnlimited(bs, s, dest.ID, src, done)
@@ -622,13 +655,13 @@ func (r *Relay) makeReservationMsg(p peer.ID, expire time.Time) *pbv2.Reservatio
 	return rsvp
 }
 
-func (r *Relay) makeLimitMsg(p peer.ID) *pbv2.Limit {
-	if r.rc.Limit == nil {
+func (r *Relay) makeLimitMsg(limit *RelayLimit) *pbv2.Limit {
+	if limit == nil {
 		return nil
 	}
 
-	duration := uint32(r.rc.Limit.Duration / time.Second)
-	data := uint64(r.rc.Limit.Data)
+	duration := uint32(limit.Duration / time.Second)
+	data := uint64(limit.Data)
 
 	return &pbv2.Limit{
 		Duration: &duration,
@@ -682,7 +715,72 @@ func (r *Relay) disconnected(n network.Network, c network.Conn) {
 	delete(r.rsvp, p)
 }
 
-func isRelayAddr(a ma.Multiaddr) bool {
-	_, err := a.ValueForProtocol(ma.P_CIRCUIT)
-	return err == nil
+// circuitLimit returns the limit of a circuit that is relayed over the given connections.
+// If any of the connections is itself a limited relayed connection, its remaining limit,
+// i.e. the time until its deadline and the data not yet relayed over it, is composed with
+// the relay's own limit. It returns false if the limit of one of the connections is used up.
+func (r *Relay) circuitLimit(conns ...network.Conn) (*RelayLimit, bool) {
+	var limit *RelayLimit
+	if r.rc.Limit != nil {
+		l := *r.rc.Limit
+		limit = &l
+	}
+
+	for _, c := range conns {
+		cl, ok := util.GetConnLimit(c)
+		if !ok || (cl.Duration == 0 && cl.Data == 0) {
+			continue
+		}
+		d := cl.Duration
+		if !cl.Deadline.IsZero() {
+			d = time.Until(cl.Deadline)
+			// The limit is in seconds, and the relay resets the connection once it expires.
+			if d < time.Second {
+				return nil, false
+			}
+		}
+		var data int64
+		if cl.Data > 0 {
+			if cl.DataUsed >= cl.Data {
+				return nil, false
+			}
+			data = int64(cl.Data - cl.DataUsed)
+		}
+		if limit == nil {
+			limit = &RelayLimit{}
+		}
+		if d > 0 && (limit.Duration == 0 || d < limit.Duration) {
+			limit.Duration = d
+		}
+		if data > 0 && (limit.Data == 0 || data < limit.Data) {
+			limit.Data = data
+		}
+	}
+	return limit, true
+}
+
+// destHops returns the minimum number of relays traversed by our connections to p.
+func (r *Relay) destHops(p peer.ID) int {
+	hops := -1
+	for _, c := range r.host.Network().ConnsToPeer(p) {
+		if h := circuitHops(c.RemoteMultiaddr()); hops == -1 || h < hops {
+			hops = h
+		}
+	}
+	if hops == -1 {
+		return 0
+	}
+	return hops
+}
+
+// circuitHops returns the number of relays traversed by a connection with the given remote address.
+func circuitHops(a ma.Multiaddr) int {
+	var hops int
+	ma.ForEach(a, func(c ma.Component) bool {
+		if c.Protocol().Code == ma.P_CIRCUIT {
+			hops++
+		}
+		return true
+	})
+	return hops
 }
@@ -14,6 +14,7 @@ import (
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 
 	"github.com/libp2p/go-libp2p-core/crypto"
@@ -360,3 +361,219 @@ func TestRelayLimitData(t *testing.T) {
 	}
 
 }
+
+func TestMultiHopRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// hosts[0] is the destination, only reachable through hosts[1].
+	// hosts[1] is a relay, only reachable through hosts[2].
+	// hosts[2] is a public relay.
+	// hosts[3] is the source.
+	hosts, upgraders := getNetHosts(t, ctx, 4)
+	addTransport(t, hosts[0], upgraders[0])
+	addTransport(t, hosts[1], upgraders[1])
+	if err := client.AddTransport(hosts[3], upgraders[3], client.WithMultiHop(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	rch := make(chan []byte, 1)
+	hosts[0].SetStreamHandler("test", func(s network.Stream) {
+		defer s.Close()
+		defer close(rch)
+
+		buf, err := io.ReadAll(s)
+		if err != nil {
+			t.Error(err)
+		}
+		rch <- buf
+	})
+
+	rc1 := relay.DefaultResources()
+	rc1.Limit.Duration = 30 * time.Second
+	r1, err := relay.New(hosts[1], relay.WithResources(rc1), relay.WithMultiHop(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+
+	rc2 := relay.DefaultResources()
+	rc2.Limit.Data = 1 << 15
+	r2, err := relay.New(hosts[2], relay.WithResources(rc2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+	connect(t, hosts[2], hosts[3])
+
+	if _, err := client.Reserve(ctx, hosts[1], hosts[2].Peerstore().PeerInfo(hosts[2].ID())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Reserve(ctx, hosts[0], hosts[1].Peerstore().PeerInfo(hosts[1].ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s/p2p-circuit/p2p/%s", hosts[2].ID(), hosts[1].ID(), hosts[0].ID()))
+	if err := hosts[3].Connect(ctx, peer.AddrInfo{ID: hosts[0].ID(), Addrs: []ma.Multiaddr{raddr}}); err != nil {
+		t.Fatal(err)
+	}
+
+	conns := hosts[3].Network().ConnsToPeer(hosts[0].ID())
+	if len(conns) != 1 {
+		t.Fatalf("expected 1 connection, but got %d", len(conns))
+	}
+	stat := conns[0].Stat()
+	if !stat.Transient {
+		t.Fatal("expected transient connection")
+	}
+	// the limits of both relays are composed
+	if d := stat.Extra[client.StatLimitDuration].(time.Duration); d > 30*time.Second || d < 28*time.Second {
+		t.Fatalf("unexpected duration limit: %s", d)
+	}
+	// the data already relayed over the first hop (handshakes and the hop stream) is not available to the circuit
+	if data := stat.Extra[client.StatLimitData].(uint64); data >= 1<<15 || data < 1<<14 {
+		t.Fatalf("unexpected data limit: %d", data)
+	}
+	firstHop, ok := util.GetConnLimit(hosts[1].Network().ConnsToPeer(hosts[3].ID())[0])
+	if !ok {
+		t.Fatal("expected a limited connection")
+	}
+	if firstHop.DataUsed == 0 || firstHop.DataUsed >= firstHop.Data {
+		t.Fatalf("unexpected data used: %+v", firstHop)
+	}
+
+	s, err := hosts[3].NewStream(network.WithUseTransient(ctx, "test"), hosts[0].ID(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("multi-hop relay works!")
+	if _, err := s.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	s.CloseWrite()
+
+	if got := <-rch; !bytes.Equal(msg, got) {
+		t.Fatalf("Wrong echo; expected %s but got %s", string(msg), string(got))
+	}
+}
+
+func TestMultiHopRelayDisabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts, upgraders := getNetHosts(t, ctx, 4)
+	addTransport(t, hosts[0], upgraders[0])
+	addTransport(t, hosts[1], upgraders[1])
+	// the client supports multi-hop circuits, but the relays don't
+	if err := client.AddTransport(hosts[3], upgraders[3], client.WithMultiHop(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	r1, err := relay.New(hosts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+	r2, err := relay.New(hosts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+	connect(t, hosts[2], hosts[3])
+
+	if _, err := client.Reserve(ctx, hosts[1], hosts[2].Peerstore().PeerInfo(hosts[2].ID())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Reserve(ctx, hosts[0], hosts[1].Peerstore().PeerInfo(hosts[1].ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s/p2p-circuit/p2p/%s", hosts[2].ID(), hosts[1].ID(), hosts[0].ID()))
+	if err := hosts[3].Connect(ctx, peer.AddrInfo{ID: hosts[0].ID(), Addrs: []ma.Multiaddr{raddr}}); err == nil {
+		t.Fatal("expected multi-hop dial to fail")
+	}
+}
+
+func TestRelayAdmissionPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// hosts[0] is the destination, hosts[1] the relay, and hosts[2], hosts[3] and hosts[4] are sources.
+	hosts, upgraders := getNetHosts(t, ctx, 5)
+	err := client.AddTransport(hosts[0], upgraders[0], client.WithAdmissionPolicy(client.AdmissionPolicy{
+		AllowedPeers:     []peer.ID{hosts[2].ID(), hosts[4].ID()},
+		MaxConnsPerRelay: 1,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{2, 3, 4} {
+		addTransport(t, hosts[i], upgraders[i])
+	}
+
+	r, err := relay.New(hosts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, h := range hosts[2:] {
+		connect(t, hosts[1], h)
+	}
+	connect(t, hosts[0], hosts[1])
+
+	if _, err := client.Reserve(ctx, hosts[0], hosts[1].Peerstore().PeerInfo(hosts[1].ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", hosts[1].ID(), hosts[0].ID()))
+	dest := peer.AddrInfo{ID: hosts[0].ID(), Addrs: []ma.Multiaddr{raddr}}
+
+	// hosts[3] is not allowed to connect
+	if err := hosts[3].Connect(ctx, dest); err == nil {
+		t.Fatal("expected connection from a peer that's not allowed to fail")
+	}
+
+	if err := hosts[2].Connect(ctx, dest); err != nil {
+		t.Fatal(err)
+	}
+	limit, ok := util.GetConnLimit(hosts[2].Network().ConnsToPeer(hosts[0].ID())[0])
+	if !ok {
+		t.Fatal("expected a limited connection")
+	}
+	if limit.Data != uint64(relay.DefaultLimit().Data) || limit.Duration != relay.DefaultLimit().Duration {
+		t.Fatalf("unexpected limit: %+v", limit)
+	}
+	if limit.Deadline.IsZero() {
+		t.Fatal("expected a deadline")
+	}
+
+	// we're only accepting a single connection through the relay
+	if err := hosts[4].Connect(ctx, dest); err == nil {
+		t.Fatal("expected connection exceeding the per-relay limit to fail")
+	}
+
+	// once the first connection is closed, there's room for another one
+	if err := hosts[2].Network().ClosePeer(hosts[0].ID()); err != nil {
+		t.Fatal(err)
+	}
+	hosts[4].Network().(*swarm.Swarm).Backoff().Clear(hosts[0].ID())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := hosts[4].Connect(ctx, dest)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		hosts[4].Network().(*swarm.Swarm).Backoff().Clear(hosts[0].ID())
+		time.Sleep(50 * time.Millisecond)
+	}
+}
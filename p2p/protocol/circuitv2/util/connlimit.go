@@ -0,0 +1,94 @@
+package util
+
+import (
+	"sync/atomic"
+	"time"
+
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+type statLimitDuration struct{}
+type statLimitData struct{}
+type statDataUsed struct{}
+
+var (
+	StatLimitDuration = statLimitDuration{}
+	StatLimitData     = statLimitData{}
+)
+
+// ConnLimit is the limit a relay imposes on a relayed connection.
+type ConnLimit struct {
+	// Duration is the time limit after which the relay resets the connection. If 0, there is no limit.
+	Duration time.Duration
+	// Data is the number of bytes the relay relays in each direction before resetting the
+	// connection. If 0, there is no limit.
+	Data uint64
+	// Deadline is the time at which the relay resets the connection, if known.
+	Deadline time.Time
+	// DataUsed is the number of bytes relayed so far, in the direction that has used more of
+	// the Data limit.
+	DataUsed uint64
+}
+
+// dataCounter counts the bytes sent and received on a limited relayed connection.
+type dataCounter struct {
+	read, written uint64 // accessed atomically
+}
+
+func (d *dataCounter) used() uint64 {
+	r, w := atomic.LoadUint64(&d.read), atomic.LoadUint64(&d.written)
+	if r > w {
+		return r
+	}
+	return w
+}
+
+// NewLimitedStat returns the ConnStats of a relayed connection with the given limit.
+func NewLimitedStat(limit *pbv2.Limit) network.ConnStats {
+	var stat network.ConnStats
+	stat.Transient = true
+	stat.Extra = make(map[interface{}]interface{})
+	stat.Extra[StatLimitDuration] = time.Duration(limit.GetDuration()) * time.Second
+	stat.Extra[StatLimitData] = limit.GetData()
+	stat.Extra[statDataUsed{}] = &dataCounter{}
+	return stat
+}
+
+// CountData records the bytes read and written on a relayed connection with the given stats.
+// It does nothing if the stats were not created by NewLimitedStat.
+func CountData(stat network.ConnStats, read, written int) {
+	counter, ok := stat.Extra[statDataUsed{}].(*dataCounter)
+	if !ok {
+		return
+	}
+	if read > 0 {
+		atomic.AddUint64(&counter.read, uint64(read))
+	}
+	if written > 0 {
+		atomic.AddUint64(&counter.written, uint64(written))
+	}
+}
+
+// GetConnLimit returns the limit of a relayed connection.
+// It returns false if the connection is not a limited relayed connection.
+func GetConnLimit(c network.Conn) (ConnLimit, bool) {
+	stat := c.Stat()
+	if !stat.Transient || stat.Extra == nil {
+		return ConnLimit{}, false
+	}
+	d, okDuration := stat.Extra[StatLimitDuration].(time.Duration)
+	data, okData := stat.Extra[StatLimitData].(uint64)
+	if !okDuration && !okData {
+		return ConnLimit{}, false
+	}
+	limit := ConnLimit{Duration: d, Data: data}
+	if counter, ok := stat.Extra[statDataUsed{}].(*dataCounter); ok {
+		limit.DataUsed = counter.used()
+	}
+	if d > 0 && !stat.Opened.IsZero() {
+		limit.Deadline = stat.Opened.Add(d)
+	}
+	return limit, true
+}
@@ -3,18 +3,22 @@ package holepunch_test
 import (
 	"context"
 	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
 
 	"github.com/libp2p/go-libp2p"
 
+	"github.com/libp2p/go-libp2p-core/event"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/test"
 	"github.com/libp2p/go-libp2p-testing/race"
 
 	relayv1 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv1/relay"
@@ -22,10 +26,12 @@ import (
 	holepunch_pb "github.com/libp2p/go-libp2p/p2p/protocol/holepunch/pb"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 
+	"github.com/libp2p/go-eventbus"
 	"github.com/libp2p/go-msgio/protoio"
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 )
 
@@ -212,6 +218,128 @@ func TestFailuresOnInitiator(t *testing.T) {
 	}
 }
 
+func TestHolePunchAttempts(t *testing.T) {
+	h1, h2, relay, _ := makeRelayedHosts(t, nil, nil, false)
+	defer h1.Close()
+	defer h2.Close()
+	defer relay.Close()
+
+	// h1 replies with an address that doesn't accept connections, so every attempt fails
+	var mx sync.Mutex
+	var attempts int
+	h1.SetStreamHandler(holepunch.Protocol, func(s network.Stream) {
+		mx.Lock()
+		attempts++
+		mx.Unlock()
+		rd := protoio.NewDelimitedReader(s, 4096)
+		wr := protoio.NewDelimitedWriter(s)
+		var msg holepunch_pb.HolePunch
+		if err := rd.ReadMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		wr.WriteMsg(&holepunch_pb.HolePunch{
+			Type:     holepunch_pb.HolePunch_CONNECT.Enum(),
+			ObsAddrs: addrsToBytes([]ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/1")}),
+		})
+		rd.ReadMsg(&msg)
+		s.Close()
+	})
+	// make sure we don't (accidentally) succeed by dialing one of h1's actual addresses
+	h2.Peerstore().ClearAddrs(h1.ID())
+
+	hps, err := holepunch.NewService(h2, newMockIDService(t, h2),
+		holepunch.WithMaxAttempts(2),
+		holepunch.WithAttemptBackoff(50*time.Millisecond),
+		holepunch.WithSyncDelay(func(time.Duration) time.Duration { return 0 }),
+	)
+	require.NoError(t, err)
+	defer hps.Close()
+
+	start := time.Now()
+	err = hps.DirectConnect(h1.ID())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "all retries")
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	mx.Lock()
+	require.Equal(t, 2, attempts)
+	mx.Unlock()
+}
+
+func TestHolePunchTransports(t *testing.T) {
+	tr := &mockEventTracer{}
+	h1, h2, relay, _ := makeRelayedHosts(t, nil, nil, false)
+	defer h1.Close()
+	defer h2.Close()
+	defer relay.Close()
+
+	// all our hosts only have TCP addresses
+	hps, err := holepunch.NewService(h2, newMockIDService(t, h2),
+		holepunch.WithTransports(false, true),
+		holepunch.WithTracer(tr),
+	)
+	require.NoError(t, err)
+	defer hps.Close()
+
+	err = hps.DirectConnect(h1.ID())
+	require.Error(t, err)
+	for _, ev := range tr.getEvents() {
+		require.NotEqual(t, holepunch.HolePunchAttemptEvtT, ev.Type)
+	}
+}
+
+func TestNoHolePunchBehindSymmetricNAT(t *testing.T) {
+	tr := &mockEventTracer{}
+	h1, h2, relay, _ := makeRelayedHosts(t, nil, nil, false)
+	defer h1.Close()
+	defer h2.Close()
+	defer relay.Close()
+
+	// all our hosts only have TCP addresses
+	em, err := h2.EventBus().Emitter(new(event.EvtNATDeviceTypeChanged), eventbus.Stateful)
+	require.NoError(t, err)
+	defer em.Close()
+	require.NoError(t, em.Emit(event.EvtNATDeviceTypeChanged{
+		TransportProtocol: network.NATTransportTCP,
+		NatDeviceType:     network.NATDeviceTypeSymmetric,
+	}))
+
+	hps, err := holepunch.NewService(h2, newMockIDService(t, h2), holepunch.WithTracer(tr))
+	require.NoError(t, err)
+	defer hps.Close()
+
+	require.Eventually(t, func() bool {
+		err := hps.DirectConnect(h1.ID())
+		return err != nil && strings.Contains(err.Error(), "symmetric NAT")
+	}, 5*time.Second, 50*time.Millisecond)
+	for _, ev := range tr.getEvents() {
+		require.NotEqual(t, holepunch.HolePunchAttemptEvtT, ev.Type)
+	}
+}
+
+func TestPunchOnlyIfLimited(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+	_, err = holepunch.NewService(h, newMockIDService(t, h), holepunch.WithPunchOnlyIfLimited(0, 0))
+	require.Error(t, err)
+
+	// The circuit v1 relay doesn't impose any limits on the relayed connection.
+	h1, h2, relay, _ := makeRelayedHosts(t, nil, holepunch.WithPunchOnlyIfLimited(time.Hour, 1<<20), true)
+	defer h1.Close()
+	defer h2.Close()
+	defer relay.Close()
+
+	require.Never(t, func() bool {
+		for _, c := range h2.Network().ConnsToPeer(h1.ID()) {
+			if _, err := c.RemoteMultiaddr().ValueForProtocol(ma.P_CIRCUIT); err != nil {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 50*time.Millisecond)
+}
+
 func addrsToBytes(as []ma.Multiaddr) [][]byte {
 	bzs := make([][]byte, 0, len(as))
 	for _, a := range as {
@@ -439,3 +567,91 @@ func mkHostWithHolePunchSvc(t *testing.T, opts ...holepunch.Option) (host.Host,
 	require.NoError(t, err)
 	return h, hps
 }
+
+func TestHolePuncherStartsOnFamilyReachability(t *testing.T) {
+	h, err := libp2p.New(libp2p.ListenAddrs(ma.StringCast("/ip4/127.0.0.1/tcp/0")))
+	require.NoError(t, err)
+	defer h.Close()
+	hps, err := holepunch.NewService(h, newMockIDService(t, h))
+	require.NoError(t, err)
+	defer hps.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hps.DirectConnect(test.RandPeerIDFatal(t))
+	}()
+	select {
+	case <-done:
+		t.Fatal("hole puncher shouldn't be running before we know that we're private")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// being private over IPv4 is enough to start the hole puncher
+	em, err := h.EventBus().Emitter(new(autonat.EvtFamilyReachabilityChanged))
+	require.NoError(t, err)
+	defer em.Close()
+	require.NoError(t, em.Emit(autonat.EvtFamilyReachabilityChanged{Family: autonat.AddrFamilyIPv4, Reachability: network.ReachabilityPrivate}))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("hole puncher didn't start")
+	}
+}
+
+func TestMetricsTracer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tr, err := holepunch.NewMetricsTracer(reg)
+	require.NoError(t, err)
+	// a second tracer can share the registry
+	_, err = holepunch.NewMetricsTracer(reg)
+	require.NoError(t, err)
+
+	remote := peer.ID("remote")
+	trace := func(evt interface{}) {
+		tr.Trace(&holepunch.Event{Timestamp: time.Now().UnixNano(), Remote: remote, Evt: evt})
+	}
+	trace(&holepunch.DirectDialEvt{Success: false})
+	trace(&holepunch.StartHolePunchEvt{
+		RemoteAddrs: []string{"/ip4/1.2.3.4/tcp/1234", "/ip6/::1/udp/1234/quic", "/ip4/1.2.3.4/tcp/4321"},
+		RTT:         100 * time.Millisecond,
+	})
+	trace(&holepunch.HolePunchAttemptEvt{Attempt: 1})
+	trace(&holepunch.EndHolePunchEvt{Success: false})
+	trace(&holepunch.StartHolePunchEvt{RemoteAddrs: []string{"/ip4/1.2.3.4/udp/1234/quic"}})
+	trace(&holepunch.HolePunchAttemptEvt{Attempt: 2})
+	trace(&holepunch.EndHolePunchEvt{Success: true, EllapsedTime: 50 * time.Millisecond, RemoteAddr: "/ip4/1.2.3.4/udp/1234/quic"})
+	trace(&holepunch.ProtocolErrorEvt{Error: "foobar"})
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	value := func(name string, labels map[string]string) float64 {
+		for _, mf := range mfs {
+			if mf.GetName() != name {
+				continue
+			}
+		metrics:
+			for _, m := range mf.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if labels[l.GetName()] != l.GetValue() {
+						continue metrics
+					}
+				}
+				if h := m.GetHistogram(); h != nil {
+					return float64(h.GetSampleCount())
+				}
+				return m.GetCounter().GetValue()
+			}
+		}
+		return 0
+	}
+
+	require.Equal(t, 1.0, value("holepunch_direct_dials_total", map[string]string{"outcome": "failure"}))
+	require.Equal(t, 2.0, value("holepunch_attempts_total", nil))
+	require.Equal(t, 1.0, value("holepunch_protocol_errors_total", nil))
+	require.Equal(t, 1.0, value("holepunch_outcomes_total", map[string]string{"transport": "tcp", "ip_version": "ip4", "outcome": "failure"}))
+	require.Equal(t, 1.0, value("holepunch_outcomes_total", map[string]string{"transport": "quic", "ip_version": "ip6", "outcome": "failure"}))
+	require.Equal(t, 1.0, value("holepunch_outcomes_total", map[string]string{"transport": "quic", "ip_version": "ip4", "outcome": "success"}))
+	require.Equal(t, 1.0, value("holepunch_success_duration", map[string]string{"transport": "quic", "ip_version": "ip4"}))
+	require.Equal(t, 2.0, value("holepunch_rtt", nil))
+}
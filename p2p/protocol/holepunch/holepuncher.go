@@ -23,10 +23,7 @@ import (
 // ErrHolePunchActive is returned from DirectConnect when another hole punching attempt is currently running
 var ErrHolePunchActive = errors.New("another hole punching attempt to this peer is active")
 
-const (
-	dialTimeout = 5 * time.Second
-	maxRetries  = 3
-)
+const dialTimeout = 5 * time.Second
 
 // The holePuncher is run on the peer that's behind a NAT / Firewall.
 // It observes new incoming connections via a relay that it has a reservation with,
@@ -49,15 +46,19 @@ type holePuncher struct {
 	closeMx sync.RWMutex
 	closed  bool
 
-	tracer *tracer
+	conf     *config
+	tracer   *tracer
+	natTypes *natDeviceTypes
 }
 
-func newHolePuncher(h host.Host, ids identify.IDService, tracer *tracer) *holePuncher {
+func newHolePuncher(h host.Host, ids identify.IDService, tracer *tracer, conf *config, nat *natDeviceTypes) *holePuncher {
 	hp := &holePuncher{
-		host:   h,
-		ids:    ids,
-		active: make(map[peer.ID]struct{}),
-		tracer: tracer,
+		host:     h,
+		ids:      ids,
+		active:   make(map[peer.ID]struct{}),
+		conf:     conf,
+		tracer:   tracer,
+		natTypes: nat,
 	}
 	hp.ctx, hp.ctxCancel = context.WithCancel(context.Background())
 	h.Network().Notify((*netNotifiee)(hp))
@@ -131,15 +132,30 @@ func (hp *holePuncher) directConnect(rp peer.ID) error {
 
 	log.Debugw("got inbound proxy conn", "peer", rp)
 
+	// Behind a symmetric NAT, the remote peer can't reach us on any of our observed addresses.
+	if addrs := hp.conf.filterAddrs(removeRelayAddrs(hp.ids.OwnObservedAddrs())); len(addrs) > 0 && len(hp.natTypes.filterAddrs(addrs)) == 0 {
+		err := errors.New("not hole punching, as we're behind a symmetric NAT")
+		hp.tracer.ProtocolError(rp, err)
+		return err
+	}
+
 	// hole punch
-	for i := 0; i < maxRetries; i++ {
+	for i := 0; i < hp.conf.maxAttempts; i++ {
+		if i > 0 && hp.conf.backoff > 0 {
+			select {
+			case <-time.After(hp.conf.backoff):
+			case <-hp.ctx.Done():
+				return hp.ctx.Err()
+			}
+		}
+
 		addrs, rtt, err := hp.initiateHolePunch(rp)
 		if err != nil {
 			log.Debugw("hole punching failed", "peer", rp, "error", err)
 			hp.tracer.ProtocolError(rp, err)
 			return err
 		}
-		synTime := rtt / 2
+		synTime := hp.conf.syncDelay(rtt)
 		log.Debugf("peer RTT is %s; starting hole punch in %s", rtt, synTime)
 
 		// wait for sync to reach the other peer and then punch a hole for it in our NAT
@@ -153,9 +169,9 @@ func (hp *holePuncher) directConnect(rp peer.ID) error {
 			}
 			hp.tracer.StartHolePunch(rp, addrs, rtt)
 			hp.tracer.HolePunchAttempt(pi.ID)
-			err := holePunchConnect(hp.ctx, hp.host, pi, true)
+			addr, err := holePunchConnect(hp.ctx, hp.host, pi, true)
 			dt := time.Since(start)
-			hp.tracer.EndHolePunch(rp, dt, err)
+			hp.tracer.EndHolePunch(rp, dt, addr, err)
 			if err == nil {
 				log.Debugw("hole punching with successful", "peer", rp, "time", dt)
 				return nil
@@ -208,7 +224,7 @@ func (hp *holePuncher) initiateHolePunchImpl(str network.Stream) ([]ma.Multiaddr
 	start := time.Now()
 	if err := w.WriteMsg(&pb.HolePunch{
 		Type:     pb.HolePunch_CONNECT.Enum(),
-		ObsAddrs: addrsToBytes(removeRelayAddrs(hp.ids.OwnObservedAddrs())),
+		ObsAddrs: addrsToBytes(hp.ownAddrs()),
 	}); err != nil {
 		str.Reset()
 		return nil, 0, err
@@ -223,7 +239,7 @@ func (hp *holePuncher) initiateHolePunchImpl(str network.Stream) ([]ma.Multiaddr
 	if t := msg.GetType(); t != pb.HolePunch_CONNECT {
 		return nil, 0, fmt.Errorf("expect CONNECT message, got %s", t)
 	}
-	addrs := removeRelayAddrs(addrsFromBytes(msg.ObsAddrs))
+	addrs := hp.natTypes.filterAddrs(hp.conf.filterAddrs(removeRelayAddrs(addrsFromBytes(msg.ObsAddrs))))
 	if len(addrs) == 0 {
 		return nil, 0, errors.New("didn't receive any public addresses in CONNECT")
 	}
@@ -234,6 +250,11 @@ func (hp *holePuncher) initiateHolePunchImpl(str network.Stream) ([]ma.Multiaddr
 	return addrs, rtt, nil
 }
 
+// ownAddrs returns our observed addresses that are worth hole punching on.
+func (hp *holePuncher) ownAddrs() []ma.Multiaddr {
+	return hp.natTypes.filterAddrs(hp.conf.filterAddrs(removeRelayAddrs(hp.ids.OwnObservedAddrs())))
+}
+
 func (hp *holePuncher) Close() error {
 	hp.closeMx.Lock()
 	hp.closed = true
@@ -251,6 +272,11 @@ func (nn *netNotifiee) Connected(_ network.Network, conn network.Conn) {
 	// Hole punch if it's an inbound proxy connection.
 	// If we already have a direct connection with the remote peer, this will be a no-op.
 	if conn.Stat().Direction == network.DirInbound && isRelayAddress(conn.RemoteMultiaddr()) {
+		if !hs.conf.shouldPunch(conn) {
+			log.Debugw("not hole punching; relayed connection isn't restrictive", "peer", conn.RemotePeer())
+			return
+		}
+
 		hs.refCount.Add(1)
 		go func() {
 			defer hs.refCount.Done()
@@ -0,0 +1,182 @@
+package holepunch
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+)
+
+// metricsTracer is an EventTracer that records hole punching metrics.
+type metricsTracer struct {
+	directDials    *prometheus.CounterVec
+	attempts       prometheus.Counter
+	outcomes       *prometheus.CounterVec
+	successLatency *prometheus.HistogramVec
+	rtts           prometheus.Histogram
+	protocolErrors prometheus.Counter
+
+	mutex sync.Mutex
+	// the addresses we're currently hole punching, per remote peer.
+	// Hole punch failures are attributed to the transports and address families of these addresses.
+	punching map[peer.ID][]ma.Multiaddr
+}
+
+var _ EventTracer = &metricsTracer{}
+
+// NewMetricsTracer creates an EventTracer that records Prometheus metrics for hole punch attempts,
+// their outcome per transport and IP version, the time it takes for a hole punch to succeed,
+// direct dials preceding the hole punch and protocol errors.
+// The metrics are registered with reg, see metricshelper.RegisterCollector.
+func NewMetricsTracer(reg prometheus.Registerer) (EventTracer, error) {
+	t := &metricsTracer{punching: make(map[peer.ID][]ma.Multiaddr)}
+
+	directDials, err := metricshelper.RegisterCollector(reg, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "holepunch_direct_dials_total",
+			Help: "Direct dials attempted before hole punching",
+		},
+		[]string{"outcome"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	t.directDials = directDials.(*prometheus.CounterVec)
+
+	attempts, err := metricshelper.RegisterCollector(reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "holepunch_attempts_total",
+		Help: "Hole punch attempts",
+	}))
+	if err != nil {
+		return nil, err
+	}
+	t.attempts = attempts.(prometheus.Counter)
+
+	outcomes, err := metricshelper.RegisterCollector(reg, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "holepunch_outcomes_total",
+			Help: "Hole punch outcomes, per transport and IP version",
+		},
+		[]string{"transport", "ip_version", "outcome"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	t.outcomes = outcomes.(*prometheus.CounterVec)
+
+	successLatency, err := metricshelper.RegisterCollector(reg, prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "holepunch_success_duration",
+			Help:    "Time until a hole punch succeeded",
+			Buckets: metricshelper.LatencyBuckets(),
+		},
+		[]string{"transport", "ip_version"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	t.successLatency = successLatency.(*prometheus.HistogramVec)
+
+	rtts, err := metricshelper.RegisterCollector(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "holepunch_rtt",
+		Help:    "RTT measured on the relayed connection during the hole punch coordination",
+		Buckets: metricshelper.LatencyBuckets(),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	t.rtts = rtts.(prometheus.Histogram)
+
+	protocolErrors, err := metricshelper.RegisterCollector(reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "holepunch_protocol_errors_total",
+		Help: "Hole punch protocol errors",
+	}))
+	if err != nil {
+		return nil, err
+	}
+	t.protocolErrors = protocolErrors.(prometheus.Counter)
+
+	return t, nil
+}
+
+func (t *metricsTracer) Trace(evt *Event) {
+	switch e := evt.Evt.(type) {
+	case *DirectDialEvt:
+		outcome := outcomeFailure
+		if e.Success {
+			outcome = outcomeSuccess
+		}
+		t.directDials.WithLabelValues(outcome).Inc()
+	case *ProtocolErrorEvt:
+		t.protocolErrors.Inc()
+	case *StartHolePunchEvt:
+		t.rtts.Observe(e.RTT.Seconds())
+		addrs := make([]ma.Multiaddr, 0, len(e.RemoteAddrs))
+		for _, s := range e.RemoteAddrs {
+			if a, err := ma.NewMultiaddr(s); err == nil {
+				addrs = append(addrs, a)
+			}
+		}
+		t.mutex.Lock()
+		t.punching[evt.Remote] = addrs
+		t.mutex.Unlock()
+	case *HolePunchAttemptEvt:
+		t.attempts.Inc()
+	case *EndHolePunchEvt:
+		t.mutex.Lock()
+		addrs := t.punching[evt.Remote]
+		delete(t.punching, evt.Remote)
+		t.mutex.Unlock()
+
+		if e.Success {
+			transport, ipVersion := "unknown", "unknown"
+			if a, err := ma.NewMultiaddr(e.RemoteAddr); err == nil {
+				transport, ipVersion = addrLabels(a)
+			}
+			t.outcomes.WithLabelValues(transport, ipVersion, outcomeSuccess).Inc()
+			t.successLatency.WithLabelValues(transport, ipVersion).Observe(e.EllapsedTime.Seconds())
+			return
+		}
+		// Count a failure for every combination of transport and IP version that we tried.
+		tried := make(map[[2]string]struct{}, len(addrs))
+		for _, a := range addrs {
+			transport, ipVersion := addrLabels(a)
+			tried[[2]string{transport, ipVersion}] = struct{}{}
+		}
+		if len(tried) == 0 {
+			tried[[2]string{"unknown", "unknown"}] = struct{}{}
+		}
+		for l := range tried {
+			t.outcomes.WithLabelValues(l[0], l[1], outcomeFailure).Inc()
+		}
+	}
+}
+
+// addrLabels returns the transport and IP version labels for an address.
+func addrLabels(a ma.Multiaddr) (transport, ipVersion string) {
+	transport, ipVersion = "other", "unknown"
+	ma.ForEach(a, func(c ma.Component) bool {
+		switch c.Protocol().Code {
+		case ma.P_IP4:
+			ipVersion = "ip4"
+		case ma.P_IP6:
+			ipVersion = "ip6"
+		case ma.P_TCP:
+			transport = "tcp"
+		case ma.P_QUIC:
+			transport = "quic"
+			return false
+		}
+		return true
+	})
+	return transport, ipVersion
+}
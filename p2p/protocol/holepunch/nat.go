@@ -0,0 +1,55 @@
+package holepunch
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/network"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// natDeviceTypes tracks the NAT device types reported by identify.
+// Behind a symmetric NAT, the port observed by other peers is of no use
+// to the peer we're punching with, so there's no point in hole punching
+// over that transport.
+type natDeviceTypes struct {
+	mx  sync.RWMutex
+	tcp network.NATDeviceType
+	udp network.NATDeviceType
+}
+
+func (n *natDeviceTypes) set(proto network.NATTransportProtocol, t network.NATDeviceType) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	switch proto {
+	case network.NATTransportTCP:
+		n.tcp = t
+	case network.NATTransportUDP:
+		n.udp = t
+	}
+}
+
+// punchable returns false if we're behind a symmetric NAT for the
+// transport of the given address.
+func (n *natDeviceTypes) punchable(a ma.Multiaddr) bool {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+	if _, err := a.ValueForProtocol(ma.P_TCP); err == nil {
+		return n.tcp != network.NATDeviceTypeSymmetric
+	}
+	if _, err := a.ValueForProtocol(ma.P_UDP); err == nil {
+		return n.udp != network.NATDeviceTypeSymmetric
+	}
+	return true
+}
+
+// filterAddrs removes the addresses of transports we can't hole punch on.
+func (n *natDeviceTypes) filterAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	result := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if n.punchable(a) {
+			result = append(result, a)
+		}
+	}
+	return result
+}
@@ -0,0 +1,137 @@
+package holepunch
+
+import (
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
+	"github.com/libp2p/go-libp2p-core/network"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// config configures how the Service hole punches.
+type config struct {
+	// maxAttempts is the number of hole punch attempts the initiator makes. See WithMaxAttempts.
+	maxAttempts int
+	// backoff is the time the initiator waits between two attempts. See WithAttemptBackoff.
+	backoff time.Duration
+	// syncDelay computes the time the initiator waits after sending the SYNC message. See WithSyncDelay.
+	syncDelay func(rtt time.Duration) time.Duration
+
+	// see WithTransports
+	tcp, quic bool
+
+	// see WithPunchOnlyIfLimited
+	onlyIfLimited       bool
+	limitedMaxDuration  time.Duration
+	limitedMaxDataBytes uint64
+}
+
+func defaultConfig() config {
+	return config{
+		maxAttempts: 3,
+		syncDelay:   func(rtt time.Duration) time.Duration { return rtt / 2 },
+		tcp:         true,
+		quic:        true,
+	}
+}
+
+// WithMaxAttempts sets the number of hole punch attempts the initiator makes before giving up.
+func WithMaxAttempts(n int) Option {
+	return func(s *Service) error {
+		if n < 1 {
+			return errors.New("need at least one hole punch attempt")
+		}
+		s.conf.maxAttempts = n
+		return nil
+	}
+}
+
+// WithAttemptBackoff sets the time the initiator waits between two consecutive hole punch attempts.
+func WithAttemptBackoff(d time.Duration) Option {
+	return func(s *Service) error {
+		s.conf.backoff = d
+		return nil
+	}
+}
+
+// WithSyncDelay sets the function that computes how long the initiator waits after sending the
+// SYNC message before dialing the remote peer, based on the measured round trip time.
+// The delay should approximate the time it takes for the SYNC message to reach the remote peer,
+// such that both peers dial each other at the same time. Defaults to half of the RTT.
+func WithSyncDelay(f func(rtt time.Duration) time.Duration) Option {
+	return func(s *Service) error {
+		if f == nil {
+			return errors.New("sync delay function can't be nil")
+		}
+		s.conf.syncDelay = f
+		return nil
+	}
+}
+
+// WithTransports sets the transports used for hole punching: TCP simultaneous open and / or QUIC.
+// Addresses of disabled transports are neither announced to, nor dialed on the remote peer.
+func WithTransports(tcp, quic bool) Option {
+	return func(s *Service) error {
+		if !tcp && !quic {
+			return errors.New("need at least one transport for hole punching")
+		}
+		s.conf.tcp = tcp
+		s.conf.quic = quic
+		return nil
+	}
+}
+
+// WithPunchOnlyIfLimited configures the initiator to only hole punch if the relayed connection
+// is restrictive, i.e. if the relay limits it to less than maxDuration or to less than maxData
+// bytes. Relayed connections without any limits are never considered restrictive.
+// A zero value disables the respective check, but at least one of them needs to be set.
+func WithPunchOnlyIfLimited(maxDuration time.Duration, maxData uint64) Option {
+	return func(s *Service) error {
+		if maxDuration <= 0 && maxData == 0 {
+			return errors.New("need a duration or a data limit for hole punching only over limited connections")
+		}
+		s.conf.onlyIfLimited = true
+		s.conf.limitedMaxDuration = maxDuration
+		s.conf.limitedMaxDataBytes = maxData
+		return nil
+	}
+}
+
+// shouldPunch returns if we should hole punch for an inbound relayed connection.
+func (c *config) shouldPunch(conn network.Conn) bool {
+	if !c.onlyIfLimited {
+		return true
+	}
+	limit, ok := util.GetConnLimit(conn)
+	if !ok {
+		return false
+	}
+	if c.limitedMaxDuration > 0 && limit.Duration > 0 && limit.Duration < c.limitedMaxDuration {
+		return true
+	}
+	if c.limitedMaxDataBytes > 0 && limit.Data > 0 && limit.Data < c.limitedMaxDataBytes {
+		return true
+	}
+	return false
+}
+
+// filterAddrs removes the addresses of transports that are disabled for hole punching.
+func (c *config) filterAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	if c.tcp && c.quic {
+		return addrs
+	}
+	result := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if _, err := a.ValueForProtocol(ma.P_TCP); err == nil && !c.tcp {
+			continue
+		}
+		if _, err := a.ValueForProtocol(ma.P_QUIC); err == nil && !c.quic {
+			continue
+		}
+		result = append(result, a)
+	}
+	return result
+}
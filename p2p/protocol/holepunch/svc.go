@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	pb "github.com/libp2p/go-libp2p/p2p/protocol/holepunch/pb"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 
@@ -53,8 +54,11 @@ type Service struct {
 
 	hasPublicAddrsChan chan struct{}
 
+	conf   config
 	tracer *tracer
 
+	natTypes *natDeviceTypes
+
 	refCount sync.WaitGroup
 }
 
@@ -75,6 +79,8 @@ func NewService(h host.Host, ids identify.IDService, opts ...Option) (*Service,
 		host:               h,
 		ids:                ids,
 		hasPublicAddrsChan: make(chan struct{}),
+		conf:               defaultConfig(),
+		natTypes:           &natDeviceTypes{},
 	}
 
 	for _, opt := range opts {
@@ -84,12 +90,38 @@ func NewService(h host.Host, ids identify.IDService, opts ...Option) (*Service,
 		}
 	}
 
-	s.refCount.Add(1)
+	natSub, err := h.EventBus().Subscribe(new(event.EvtNATDeviceTypeChanged))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s.refCount.Add(2)
 	go s.watchForPublicAddr()
+	go s.watchNATDeviceType(natSub)
 
 	return s, nil
 }
 
+func (s *Service) watchNATDeviceType(sub event.Subscription) {
+	defer s.refCount.Done()
+	defer sub.Close()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			evt := e.(event.EvtNATDeviceTypeChanged)
+			log.Debugw("NAT device type changed", "transport", evt.TransportProtocol, "type", evt.NatDeviceType)
+			s.natTypes.set(evt.TransportProtocol, evt.NatDeviceType)
+		}
+	}
+}
+
 func (s *Service) watchForPublicAddr() {
 	defer s.refCount.Done()
 
@@ -122,14 +154,24 @@ func (s *Service) watchForPublicAddr() {
 		}
 	}
 
-	// Only start the holePuncher if we're behind a NAT / firewall.
-	sub, err := s.host.EventBus().Subscribe(&event.EvtLocalReachabilityChanged{})
+	// Only start the holePuncher if we're behind a NAT / firewall,
+	// for at least one IP address family.
+	sub, err := s.host.EventBus().Subscribe([]interface{}{
+		new(event.EvtLocalReachabilityChanged),
+		new(autonat.EvtFamilyReachabilityChanged),
+	})
 	if err != nil {
 		log.Debugf("failed to subscripe to Reachability event: %s", err)
 		return
 	}
 	defer sub.Close()
-	for {
+	// Family reachability events emitted before we subscribed are lost,
+	// so start with the current status of the host's AutoNAT, if it tracks it.
+	var reachability network.Reachability
+	if privateFamily(s.host) {
+		reachability = network.ReachabilityPrivate
+	}
+	for reachability != network.ReachabilityPrivate {
 		select {
 		case <-s.ctx.Done():
 			return
@@ -137,16 +179,33 @@ func (s *Service) watchForPublicAddr() {
 			if !ok {
 				return
 			}
-			if e.(event.EvtLocalReachabilityChanged).Reachability != network.ReachabilityPrivate {
-				continue
+			switch evt := e.(type) {
+			case event.EvtLocalReachabilityChanged:
+				reachability = evt.Reachability
+			case autonat.EvtFamilyReachabilityChanged:
+				reachability = evt.Reachability
 			}
-			s.holePuncherMx.Lock()
-			s.holePuncher = newHolePuncher(s.host, s.ids, s.tracer)
-			s.holePuncherMx.Unlock()
-			close(s.hasPublicAddrsChan)
-			return
 		}
 	}
+	s.holePuncherMx.Lock()
+	s.holePuncher = newHolePuncher(s.host, s.ids, s.tracer, &s.conf, s.natTypes)
+	s.holePuncherMx.Unlock()
+	close(s.hasPublicAddrsChan)
+}
+
+// privateFamily returns true if the AutoNAT of h reports that we're not reachable
+// over at least one IP address family.
+func privateFamily(h host.Host) bool {
+	ah, ok := h.(interface{ GetAutoNat() autonat.AutoNAT })
+	if !ok {
+		return false
+	}
+	rt, ok := ah.GetAutoNat().(autonat.ReachabilityTracker)
+	if !ok {
+		return false
+	}
+	return rt.FamilyStatus(autonat.AddrFamilyIPv4) == network.ReachabilityPrivate ||
+		rt.FamilyStatus(autonat.AddrFamilyIPv6) == network.ReachabilityPrivate
 }
 
 // Close closes the Hole Punch Service.
@@ -169,11 +228,15 @@ func (s *Service) incomingHolePunch(str network.Stream) (rtt time.Duration, addr
 	if !isRelayAddress(str.Conn().RemoteMultiaddr()) {
 		return 0, nil, fmt.Errorf("received hole punch stream: %s", str.Conn().RemoteMultiaddr())
 	}
-	ownAddrs := removeRelayAddrs(s.ids.OwnObservedAddrs())
+	ownAddrs := s.conf.filterAddrs(removeRelayAddrs(s.ids.OwnObservedAddrs()))
 	// If we can't tell the peer where to dial us, there's no point in starting the hole punching.
 	if len(ownAddrs) == 0 {
 		return 0, nil, errors.New("rejecting hole punch request, as we don't have any public addresses")
 	}
+	ownAddrs = s.natTypes.filterAddrs(ownAddrs)
+	if len(ownAddrs) == 0 {
+		return 0, nil, errors.New("rejecting hole punch request, as we're behind a symmetric NAT")
+	}
 
 	if err := str.Scope().ReserveMemory(maxMsgSize, network.ReservationPriorityAlways); err != nil {
 		log.Debugf("error reserving memory for stream: %s, err")
@@ -195,7 +258,7 @@ func (s *Service) incomingHolePunch(str network.Stream) (rtt time.Duration, addr
 	if t := msg.GetType(); t != pb.HolePunch_CONNECT {
 		return 0, nil, fmt.Errorf("expected CONNECT message from initiator but got %d", t)
 	}
-	obsDial := removeRelayAddrs(addrsFromBytes(msg.ObsAddrs))
+	obsDial := s.natTypes.filterAddrs(s.conf.filterAddrs(removeRelayAddrs(addrsFromBytes(msg.ObsAddrs))))
 	log.Debugw("received hole punch request", "peer", str.Conn().RemotePeer(), "addrs", obsDial)
 	if len(obsDial) == 0 {
 		return 0, nil, errors.New("expected CONNECT message to contain at least one address")
@@ -257,9 +320,9 @@ func (s *Service) handleNewStream(str network.Stream) {
 	log.Debugw("starting hole punch", "peer", rp)
 	start := time.Now()
 	s.tracer.HolePunchAttempt(pi.ID)
-	err = holePunchConnect(s.ctx, s.host, pi, false)
+	addr, err := holePunchConnect(s.ctx, s.host, pi, false)
 	dt := time.Since(start)
-	s.tracer.EndHolePunch(rp, dt, err)
+	s.tracer.EndHolePunch(rp, dt, addr, err)
 }
 
 // DirectConnect is only exposed for testing purposes.
@@ -91,6 +91,8 @@ type EndHolePunchEvt struct {
 	Success      bool
 	EllapsedTime time.Duration
 	Error        string `json:",omitempty"`
+	// RemoteAddr is the remote address of the direct connection, if the hole punch succeeded.
+	RemoteAddr string `json:",omitempty"`
 }
 
 type HolePunchAttemptEvt struct {
@@ -171,7 +173,7 @@ func (t *tracer) StartHolePunch(p peer.ID, obsAddrs []ma.Multiaddr, rtt time.Dur
 	})
 }
 
-func (t *tracer) EndHolePunch(p peer.ID, dt time.Duration, err error) {
+func (t *tracer) EndHolePunch(p peer.ID, dt time.Duration, addr ma.Multiaddr, err error) {
 	if t == nil {
 		return
 	}
@@ -183,6 +185,9 @@ func (t *tracer) EndHolePunch(p peer.ID, dt time.Duration, err error) {
 	if err != nil {
 		evt.Error = err.Error()
 	}
+	if addr != nil {
+		evt.RemoteAddr = addr.String()
+	}
 
 	t.tr.Trace(&Event{
 		Timestamp: time.Now().UnixNano(),
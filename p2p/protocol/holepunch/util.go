@@ -54,7 +54,8 @@ func addrsFromBytes(bzs [][]byte) []ma.Multiaddr {
 	return addrs
 }
 
-func holePunchConnect(ctx context.Context, host host.Host, pi peer.AddrInfo, isClient bool) error {
+// holePunchConnect attempts a hole punch, and returns the remote address of the resulting direct connection.
+func holePunchConnect(ctx context.Context, host host.Host, pi peer.AddrInfo, isClient bool) (ma.Multiaddr, error) {
 	holePunchCtx := network.WithSimultaneousConnect(ctx, isClient, "hole-punching")
 	forceDirectConnCtx := network.WithForceDirectDial(holePunchCtx, "hole-punching")
 	dialCtx, cancel := context.WithTimeout(forceDirectConnCtx, dialTimeout)
@@ -62,8 +63,13 @@ func holePunchConnect(ctx context.Context, host host.Host, pi peer.AddrInfo, isC
 
 	if err := host.Connect(dialCtx, pi); err != nil {
 		log.Debugw("hole punch attempt with peer failed", "peer ID", pi.ID, "error", err)
-		return err
+		return nil, err
 	}
 	log.Debugw("hole punch successful", "peer", pi.ID)
-	return nil
+	for _, c := range host.Network().ConnsToPeer(pi.ID) {
+		if !isRelayAddress(c.RemoteMultiaddr()) {
+			return c.RemoteMultiaddr(), nil
+		}
+	}
+	return nil, nil
 }
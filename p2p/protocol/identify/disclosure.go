@@ -0,0 +1,74 @@
+package identify
+
+import (
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// DisclosurePolicy decides which of our protocols and listen addresses we
+// disclose to a peer, in identify responses as well as in pushes.
+//
+// Note that this only controls what we advertise. Peers can still try to
+// negotiate protocols we didn't disclose, or dial addresses they learned
+// about from somewhere else.
+type DisclosurePolicy interface {
+	// DiscloseProtocols returns the protocols to disclose to the peer on connection c.
+	DiscloseProtocols(c network.Conn, protos []string) []string
+	// DiscloseAddrs returns the listen addresses to disclose to the peer on connection c.
+	// If any address is withheld, we don't send our signed peer record to this peer,
+	// as it contains all our addresses.
+	DiscloseAddrs(c network.Conn, addrs []ma.Multiaddr) []ma.Multiaddr
+}
+
+// RestrictedDisclosure is a DisclosurePolicy that only discloses some protocols to
+// allowlisted peers, and that can restrict private addresses to peers on our LAN.
+type RestrictedDisclosure struct {
+	// Protocols maps protocols to the peers allowed to learn about them.
+	// Protocols that are not in this map are disclosed to every peer.
+	Protocols map[string][]peer.ID
+	// PrivateAddrsToLANOnly only discloses private addresses to peers that are
+	// connected to us via a private address.
+	PrivateAddrsToLANOnly bool
+}
+
+var _ DisclosurePolicy = &RestrictedDisclosure{}
+
+func (d *RestrictedDisclosure) DiscloseProtocols(c network.Conn, protos []string) []string {
+	if len(d.Protocols) == 0 {
+		return protos
+	}
+	p := c.RemotePeer()
+	disclosed := make([]string, 0, len(protos))
+	for _, proto := range protos {
+		allowed, ok := d.Protocols[proto]
+		if !ok || containsPeer(allowed, p) {
+			disclosed = append(disclosed, proto)
+		}
+	}
+	return disclosed
+}
+
+func (d *RestrictedDisclosure) DiscloseAddrs(c network.Conn, addrs []ma.Multiaddr) []ma.Multiaddr {
+	if !d.PrivateAddrsToLANOnly || !manet.IsPublicAddr(c.RemoteMultiaddr()) {
+		return addrs
+	}
+	disclosed := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if !manet.IsPrivateAddr(a) {
+			disclosed = append(disclosed, a)
+		}
+	}
+	return disclosed
+}
+
+func containsPeer(peers []peer.ID, p peer.ID) bool {
+	for _, pp := range peers {
+		if pp == p {
+			return true
+		}
+	}
+	return false
+}
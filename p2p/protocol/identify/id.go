@@ -42,7 +42,10 @@ const LibP2PVersion = "ipfs/0.1.0"
 
 const ServiceName = "libp2p.identify"
 
-const maxPushConcurrency = 32
+const (
+	defaultMaxPushConcurrency = 32
+	defaultPushCoalesceWindow = 100 * time.Millisecond
+)
 
 // StreamReadTimeout is the read timeout on all incoming Identify family streams.
 var StreamReadTimeout = 60 * time.Second
@@ -121,6 +124,15 @@ type idService struct {
 	// pushSemaphore limits the push/delta concurrency to avoid storms
 	// that clog the transient scope.
 	pushSemaphore chan struct{}
+	// updates are coalesced for this long before being pushed
+	pushCoalesceWindow time.Duration
+
+	metricsTracer MetricsTracer
+
+	// persists received signed peer records, if configured
+	peerRecords *peerRecordStore
+
+	disclosurePolicy DisclosurePolicy
 }
 
 // NewIDService constructs a new *idService and activates it by
@@ -135,6 +147,14 @@ func NewIDService(h host.Host, opts ...Option) (*idService, error) {
 	if cfg.userAgent != "" {
 		userAgent = cfg.userAgent
 	}
+	maxPushConcurrency := defaultMaxPushConcurrency
+	if cfg.maxPushConcurrency > 0 {
+		maxPushConcurrency = cfg.maxPushConcurrency
+	}
+	pushCoalesceWindow := defaultPushCoalesceWindow
+	if cfg.pushCoalesceWindow != 0 {
+		pushCoalesceWindow = cfg.pushCoalesceWindow
+	}
 
 	s := &idService{
 		Host:      h,
@@ -147,14 +167,30 @@ func NewIDService(h host.Host, opts ...Option) (*idService, error) {
 		addPeerHandlerCh: make(chan addPeerHandlerReq),
 		rmPeerHandlerCh:  make(chan rmPeerHandlerReq),
 
-		pushSemaphore: make(chan struct{}, maxPushConcurrency),
+		pushSemaphore:      make(chan struct{}, maxPushConcurrency),
+		pushCoalesceWindow: pushCoalesceWindow,
+
+		metricsTracer:    cfg.metricsTracer,
+		disclosurePolicy: cfg.disclosurePolicy,
 	}
+
+	if cfg.peerRecordsDatastore != nil {
+		s.peerRecords = newPeerRecordStore(cfg.peerRecordsDatastore, cfg.clock, cfg.peerRecordsMaxAge, cfg.maxPeerRecords)
+		if cab, ok := peerstore.GetCertifiedAddrBook(h.Peerstore()); ok {
+			// We're not connected to these peers (yet), so we treat their
+			// addresses like any other address we learned about.
+			if err := s.peerRecords.load(cab, peerstore.AddressTTL); err != nil {
+				return nil, fmt.Errorf("failed to load signed peer records: %w", err)
+			}
+		}
+	}
+
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
 
 	// handle local protocol handler updates, and push deltas to peers.
 	var err error
 
-	observedAddrs, err := NewObservedAddrManager(h)
+	observedAddrs, err := newObservedAddrManager(h, &cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create observed address manager: %s", err)
 	}
@@ -326,7 +362,15 @@ func (ids *idService) IdentifyWait(c network.Conn) <-chan struct{} {
 		// stream then forget the connection.
 		go func() {
 			defer close(wait)
-			if err := ids.identifyConn(c); err != nil {
+			start := time.Now()
+			err := ids.identifyConn(c)
+			if ids.metricsTracer != nil {
+				ids.metricsTracer.IdentifyRequest(network.DirOutbound, err)
+				if err == nil {
+					ids.metricsTracer.IdentifyLatency(time.Since(start))
+				}
+			}
+			if err != nil {
 				log.Warnf("failed to identify %s: %s", c.RemotePeer(), err)
 				ids.emitters.evtPeerIdentificationFailed.Emit(event.EvtPeerIdentificationFailed{Peer: c.RemotePeer(), Reason: err})
 				return
@@ -404,7 +448,10 @@ func (ids *idService) sendIdentifyResp(s network.Stream) {
 	ph.snapshotMu.RLock()
 	snapshot := ph.snapshot
 	ph.snapshotMu.RUnlock()
-	ids.writeChunkedIdentifyMsg(c, snapshot, s)
+	err := ids.writeChunkedIdentifyMsg(c, snapshot, s)
+	if ids.metricsTracer != nil {
+		ids.metricsTracer.IdentifyRequest(network.DirInbound, err)
+	}
 	log.Debugf("%s sent message to %s %s", ID, c.RemotePeer(), c.RemoteMultiaddr())
 }
 
@@ -438,6 +485,9 @@ func (ids *idService) handleIdentifyResponse(s network.Stream) error {
 	defer s.Close()
 
 	log.Debugf("%s received message from %s %s", s.Protocol(), c.RemotePeer(), c.RemoteMultiaddr())
+	if ids.metricsTracer != nil {
+		ids.metricsTracer.MessageReceived(mes.Size())
+	}
 
 	ids.consumeMessage(mes, c)
 
@@ -473,30 +523,45 @@ func (ids *idService) getSnapshot() *identifySnapshot {
 }
 
 func (ids *idService) writeChunkedIdentifyMsg(c network.Conn, snapshot *identifySnapshot, s network.Stream) error {
-	mes := ids.createBaseIdentifyResponse(c, snapshot)
-	sr := ids.getSignedRecord(snapshot)
+	mes, allAddrs := ids.createBaseIdentifyResponse(c, snapshot)
+	var sr []byte
+	// The signed peer record contains all our addresses. Don't send it if the
+	// disclosure policy withholds some of them from this peer.
+	if allAddrs {
+		sr = ids.getSignedRecord(snapshot)
+	}
 	mes.SignedPeerRecord = sr
 	writer := protoio.NewDelimitedWriter(s)
 
 	if sr == nil || proto.Size(mes) <= legacyIDSize {
-		return writer.WriteMsg(mes)
+		return ids.writeIdentifyMsg(writer, mes)
 	}
 	mes.SignedPeerRecord = nil
-	if err := writer.WriteMsg(mes); err != nil {
+	if err := ids.writeIdentifyMsg(writer, mes); err != nil {
 		return err
 	}
 
 	// then write just the signed record
 	m := &pb.Identify{SignedPeerRecord: sr}
-	err := writer.WriteMsg(m)
-	return err
+	return ids.writeIdentifyMsg(writer, m)
+}
 
+func (ids *idService) writeIdentifyMsg(w protoio.Writer, mes *pb.Identify) error {
+	if err := w.WriteMsg(mes); err != nil {
+		return err
+	}
+	if ids.metricsTracer != nil {
+		ids.metricsTracer.MessageSent(mes.Size())
+	}
+	return nil
 }
 
+// createBaseIdentifyResponse creates the identify message for the peer on conn.
+// It returns false if the disclosure policy withholds some of our addresses.
 func (ids *idService) createBaseIdentifyResponse(
 	conn network.Conn,
 	snapshot *identifySnapshot,
-) *pb.Identify {
+) (*pb.Identify, bool) {
 	mes := &pb.Identify{}
 
 	remoteAddr := conn.RemoteMultiaddr()
@@ -504,6 +569,13 @@ func (ids *idService) createBaseIdentifyResponse(
 
 	// set protocols this node is currently handling
 	mes.Protocols = snapshot.protocols
+	addrs := snapshot.addrs
+	allAddrs := true
+	if ids.disclosurePolicy != nil {
+		mes.Protocols = ids.disclosurePolicy.DiscloseProtocols(conn, mes.Protocols)
+		addrs = ids.disclosurePolicy.DiscloseAddrs(conn, addrs)
+		allAddrs = len(addrs) == len(snapshot.addrs)
+	}
 
 	// observed address so other side is informed of their
 	// "public" address, at least in relation to us.
@@ -513,8 +585,8 @@ func (ids *idService) createBaseIdentifyResponse(
 	// peers that do not yet support signed addresses will need this.
 	// Note: LocalMultiaddr is sometimes 0.0.0.0
 	viaLoopback := manet.IsIPLoopback(localAddr) || manet.IsIPLoopback(remoteAddr)
-	mes.ListenAddrs = make([][]byte, 0, len(snapshot.addrs))
-	for _, addr := range snapshot.addrs {
+	mes.ListenAddrs = make([][]byte, 0, len(addrs))
+	for _, addr := range addrs {
 		if !viaLoopback && manet.IsIPLoopback(addr) {
 			continue
 		}
@@ -547,7 +619,7 @@ func (ids *idService) createBaseIdentifyResponse(
 	mes.ProtocolVersion = &pv
 	mes.AgentVersion = &av
 
-	return mes
+	return mes, allAddrs
 }
 
 func (ids *idService) getSignedRecord(snapshot *identifySnapshot) []byte {
@@ -619,12 +691,15 @@ func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn) {
 	}
 
 	// add signed addrs if we have them and the peerstore supports them
+	var persistRecord bool
 	cab, ok := peerstore.GetCertifiedAddrBook(ids.Host.Peerstore())
 	if ok && signedPeerRecord != nil {
-		_, addErr := cab.ConsumePeerRecord(signedPeerRecord, ttl)
+		accepted, addErr := cab.ConsumePeerRecord(signedPeerRecord, ttl)
 		if addErr != nil {
 			log.Debugf("error adding signed addrs to peerstore: %v", addErr)
 		}
+		// only persist records that are newer than the one we already have
+		persistRecord = accepted && ids.peerRecords != nil
 	} else {
 		ids.Host.Peerstore().AddAddrs(p, lmaddrs, ttl)
 	}
@@ -633,6 +708,12 @@ func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn) {
 	ids.Host.Peerstore().UpdateAddrs(p, peerstore.TempAddrTTL, 0)
 	ids.addrMu.Unlock()
 
+	if persistRecord {
+		if err := ids.peerRecords.put(p, signedPeerRecord, mes.SignedPeerRecord); err != nil {
+			log.Warnw("failed to persist signed peer record", "peer", p, "error", err)
+		}
+	}
+
 	log.Debugf("%s received listen addrs for %s: %s", c.LocalPeer(), c.RemotePeer(), lmaddrs)
 
 	// get protocol versions
@@ -41,12 +41,16 @@ func (ids *idService) deltaHandler(s network.Stream) {
 	if err := r.ReadMsg(&mes); err != nil {
 		log.Warn("error reading identify message: ", err)
 		_ = s.Reset()
+		ids.pushReceived(err)
 		return
 	}
 
 	defer s.Close()
 
 	log.Debugf("%s received message from %s %s", s.Protocol(), c.RemotePeer(), c.RemoteMultiaddr())
+	if ids.metricsTracer != nil {
+		ids.metricsTracer.MessageReceived(mes.Size())
+	}
 
 	delta := mes.GetDelta()
 	if delta == nil {
@@ -54,10 +58,12 @@ func (ids *idService) deltaHandler(s network.Stream) {
 	}
 
 	p := s.Conn().RemotePeer()
-	if err := ids.consumeDelta(p, delta); err != nil {
+	err := ids.consumeDelta(p, delta)
+	if err != nil {
 		_ = s.Reset()
 		log.Warnf("delta update from peer %s failed: %s", p, err)
 	}
+	ids.pushReceived(err)
 }
 
 // consumeDelta processes an incoming delta from a peer, updating the peerstore
@@ -13,5 +13,11 @@ const IDPush = "/ipfs/id/push/1.0.0"
 
 // pushHandler handles incoming identify push streams. The behaviour is identical to the ordinary identify protocol.
 func (ids *idService) pushHandler(s network.Stream) {
-	ids.handleIdentifyResponse(s)
+	ids.pushReceived(ids.handleIdentifyResponse(s))
+}
+
+func (ids *idService) pushReceived(err error) {
+	if ids.metricsTracer != nil {
+		ids.metricsTracer.PushReceived(err)
+	}
 }
@@ -31,9 +31,12 @@ import (
 	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
 
 	mockClock "github.com/benbjohnson/clock"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-msgio/protoio"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -1139,3 +1142,235 @@ func waitForDisconnectNotification(swarm *swarm.Swarm) <-chan struct{} {
 
 	return done
 }
+
+type mockMetricsTracer struct {
+	mx           sync.Mutex
+	requests     map[network.Direction]int
+	pushesSent   int
+	pushesRcvd   int
+	messagesSent int
+	messagesRcvd int
+}
+
+var _ identify.MetricsTracer = &mockMetricsTracer{}
+
+func newMockMetricsTracer() *mockMetricsTracer {
+	return &mockMetricsTracer{requests: make(map[network.Direction]int)}
+}
+
+func (m *mockMetricsTracer) IdentifyRequest(dir network.Direction, err error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if err == nil {
+		m.requests[dir]++
+	}
+}
+
+func (m *mockMetricsTracer) IdentifyLatency(time.Duration) {}
+
+func (m *mockMetricsTracer) PushSent(err error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if err == nil {
+		m.pushesSent++
+	}
+}
+
+func (m *mockMetricsTracer) PushReceived(err error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if err == nil {
+		m.pushesRcvd++
+	}
+}
+
+func (m *mockMetricsTracer) MessageSent(int) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.messagesSent++
+}
+
+func (m *mockMetricsTracer) MessageReceived(int) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.messagesRcvd++
+}
+
+func (m *mockMetricsTracer) pushes() (sent, rcvd int) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return m.pushesSent, m.pushesRcvd
+}
+
+func TestIdentifyPushCoalescing(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	defer h2.Close()
+
+	tr1 := newMockMetricsTracer()
+	tr2 := newMockMetricsTracer()
+	ids1, err := identify.NewIDService(h1, identify.WithMetricsTracer(tr1), identify.PushCoalesceWindow(200*time.Millisecond))
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids2, err := identify.NewIDService(h2, identify.WithMetricsTracer(tr2))
+	require.NoError(t, err)
+	defer ids2.Close()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	ids1.IdentifyConn(h1.Network().ConnsToPeer(h2.ID())[0])
+	require.Eventually(t, func() bool {
+		return len(h2.Network().ConnsToPeer(h1.ID())) > 0
+	}, time.Second, 10*time.Millisecond)
+	ids2.IdentifyConn(h2.Network().ConnsToPeer(h1.ID())[0])
+
+	tr1.mx.Lock()
+	require.Equal(t, 1, tr1.requests[network.DirOutbound])
+	require.NotZero(t, tr1.messagesRcvd)
+	tr1.mx.Unlock()
+
+	// all address changes within the window result in a single push
+	for i := 0; i < 5; i++ {
+		emitAddrChangeEvt(t, h1)
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Eventually(t, func() bool {
+		sent, _ := tr1.pushes()
+		_, rcvd := tr2.pushes()
+		return sent == 1 && rcvd == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	sent, _ := tr1.pushes()
+	require.Equal(t, 1, sent)
+}
+
+func TestIdentifyMetricsTracer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tr, err := identify.NewMetricsTracer(reg)
+	require.NoError(t, err)
+	// tracers can share a registry
+	_, err = identify.NewMetricsTracer(reg)
+	require.NoError(t, err)
+
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	defer h2.Close()
+	ids1, err := identify.NewIDService(h1, identify.WithMetricsTracer(tr))
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids2, err := identify.NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	ids1.IdentifyConn(h1.Network().ConnsToPeer(h2.ID())[0])
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	names := make(map[string]struct{})
+	for _, mf := range mfs {
+		names[mf.GetName()] = struct{}{}
+	}
+	require.Contains(t, names, "identify_requests_total")
+	require.Contains(t, names, "identify_latency_seconds")
+	require.Contains(t, names, "identify_message_size_bytes")
+}
+
+func TestPersistPeerRecords(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	invalidKey := datastore.NewKey("/libp2p/identify/peer-records/invalid")
+	require.NoError(t, ds.Put(context.Background(), invalidKey, []byte("foobar")))
+
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	defer h2.Close()
+
+	ids1, err := identify.NewIDService(h1, identify.PersistPeerRecords(ds))
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids2, err := identify.NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+
+	// invalid records are removed when loading
+	has, err := ds.Has(context.Background(), invalidKey)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	ids1.IdentifyConn(h1.Network().ConnsToPeer(h2.ID())[0])
+	cab1, ok := peerstore.GetCertifiedAddrBook(h1.Peerstore())
+	require.True(t, ok)
+	rec := cab1.GetPeerRecord(h2.ID())
+	require.NotNil(t, rec)
+
+	// after a "restart", h2's signed peer record is loaded from the datastore
+	h3 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h3.Close()
+	ids3, err := identify.NewIDService(h3, identify.PersistPeerRecords(ds))
+	require.NoError(t, err)
+	defer ids3.Close()
+	cab3, ok := peerstore.GetCertifiedAddrBook(h3.Peerstore())
+	require.True(t, ok)
+	loaded := cab3.GetPeerRecord(h2.ID())
+	require.NotNil(t, loaded)
+	require.True(t, rec.Equal(loaded))
+	require.ElementsMatch(t, h1.Peerstore().Addrs(h2.ID()), h3.Peerstore().Addrs(h2.ID()))
+}
+
+func TestDisclosurePolicy(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h3 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	defer h2.Close()
+	defer h3.Close()
+
+	const adminProto = "/admin/1.0.0"
+	h1.SetStreamHandler(adminProto, func(network.Stream) {})
+	h1.SetStreamHandler(protocol.TestingID, func(network.Stream) {})
+
+	ids1, err := identify.NewIDService(h1, identify.WithDisclosurePolicy(&identify.RestrictedDisclosure{
+		Protocols: map[string][]peer.ID{adminProto: {h3.ID()}},
+	}))
+	require.NoError(t, err)
+	defer ids1.Close()
+	for _, h := range []host.Host{h2, h3} {
+		ids, err := identify.NewIDService(h)
+		require.NoError(t, err)
+		defer ids.Close()
+
+		require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}))
+		ids.IdentifyConn(h.Network().ConnsToPeer(h1.ID())[0])
+	}
+
+	protos, err := h2.Peerstore().SupportsProtocols(h1.ID(), adminProto, string(protocol.TestingID))
+	require.NoError(t, err)
+	require.Equal(t, []string{string(protocol.TestingID)}, protos)
+	protos, err = h3.Peerstore().SupportsProtocols(h1.ID(), adminProto, string(protocol.TestingID))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{adminProto, string(protocol.TestingID)}, protos)
+}
+
+type mockConn struct {
+	network.Conn
+	remotePeer peer.ID
+	remoteAddr ma.Multiaddr
+}
+
+func (c *mockConn) RemotePeer() peer.ID           { return c.remotePeer }
+func (c *mockConn) RemoteMultiaddr() ma.Multiaddr { return c.remoteAddr }
+
+func TestRestrictedDisclosureAddrs(t *testing.T) {
+	policy := &identify.RestrictedDisclosure{PrivateAddrsToLANOnly: true}
+	public := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	private := ma.StringCast("/ip4/192.168.0.1/tcp/1234")
+	addrs := []ma.Multiaddr{public, private}
+
+	lanConn := &mockConn{remoteAddr: ma.StringCast("/ip4/192.168.0.2/tcp/4321")}
+	require.Equal(t, addrs, policy.DiscloseAddrs(lanConn, addrs))
+	wanConn := &mockConn{remoteAddr: ma.StringCast("/ip4/5.6.7.8/tcp/4321")}
+	require.Equal(t, []ma.Multiaddr{public}, policy.DiscloseAddrs(wanConn, addrs))
+}
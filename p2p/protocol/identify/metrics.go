@@ -0,0 +1,153 @@
+package identify
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+
+	"github.com/libp2p/go-libp2p-core/network"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+)
+
+// MetricsTracer is notified about identify requests, pushes and messages.
+type MetricsTracer interface {
+	// IdentifyRequest is called when an identify request completed. For outbound
+	// requests we identified the peer, for inbound requests the peer identified us.
+	IdentifyRequest(dir network.Direction, err error)
+	// IdentifyLatency is called with the time it took to identify a connection.
+	IdentifyLatency(d time.Duration)
+	// PushSent is called after we sent an identify push (or delta) to a peer.
+	PushSent(err error)
+	// PushReceived is called after we received an identify push from a peer.
+	PushReceived(err error)
+	// MessageSent is called with the size of every identify message we sent.
+	MessageSent(size int)
+	// MessageReceived is called with the size of every identify message we received.
+	MessageReceived(size int)
+}
+
+type metricsTracer struct {
+	requests     *prometheus.CounterVec
+	latency      prometheus.Histogram
+	pushesSent   *prometheus.CounterVec
+	pushesRcvd   *prometheus.CounterVec
+	messageSizes *prometheus.HistogramVec
+}
+
+var _ MetricsTracer = &metricsTracer{}
+
+// NewMetricsTracer creates a MetricsTracer that records Prometheus metrics for identify
+// requests, pushes sent and received, message sizes and the identify latency per connection.
+// The metrics are registered with reg, see metricshelper.RegisterCollector.
+func NewMetricsTracer(reg prometheus.Registerer) (MetricsTracer, error) {
+	t := &metricsTracer{}
+
+	requests, err := metricshelper.RegisterCollector(reg, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "identify_requests_total",
+			Help: "Identify requests, per direction",
+		},
+		[]string{"direction", "outcome"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	t.requests = requests.(*prometheus.CounterVec)
+
+	latency, err := metricshelper.RegisterCollector(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "identify_latency_seconds",
+		Help:    "Time it took to identify a connection",
+		Buckets: metricshelper.LatencyBuckets(),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	t.latency = latency.(prometheus.Histogram)
+
+	pushesSent, err := metricshelper.RegisterCollector(reg, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "identify_pushes_sent_total",
+			Help: "Identify pushes sent",
+		},
+		[]string{"outcome"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	t.pushesSent = pushesSent.(*prometheus.CounterVec)
+
+	pushesRcvd, err := metricshelper.RegisterCollector(reg, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "identify_pushes_received_total",
+			Help: "Identify pushes received",
+		},
+		[]string{"outcome"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	t.pushesRcvd = pushesRcvd.(*prometheus.CounterVec)
+
+	messageSizes, err := metricshelper.RegisterCollector(reg, prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "identify_message_size_bytes",
+			Help:    "Size of identify messages",
+			Buckets: prometheus.ExponentialBuckets(64, 2, 8), // 64 bytes to 8 KB
+		},
+		[]string{"direction"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	t.messageSizes = messageSizes.(*prometheus.HistogramVec)
+
+	return t, nil
+}
+
+func getOutcome(err error) string {
+	if err != nil {
+		return outcomeFailure
+	}
+	return outcomeSuccess
+}
+
+func getDirection(dir network.Direction) string {
+	switch dir {
+	case network.DirInbound:
+		return "inbound"
+	case network.DirOutbound:
+		return "outbound"
+	default:
+		return "unknown"
+	}
+}
+
+func (t *metricsTracer) IdentifyRequest(dir network.Direction, err error) {
+	t.requests.WithLabelValues(getDirection(dir), getOutcome(err)).Inc()
+}
+
+func (t *metricsTracer) IdentifyLatency(d time.Duration) {
+	t.latency.Observe(d.Seconds())
+}
+
+func (t *metricsTracer) PushSent(err error) {
+	t.pushesSent.WithLabelValues(getOutcome(err)).Inc()
+}
+
+func (t *metricsTracer) PushReceived(err error) {
+	t.pushesRcvd.WithLabelValues(getOutcome(err)).Inc()
+}
+
+func (t *metricsTracer) MessageSent(size int) {
+	t.messageSizes.WithLabelValues("sent").Observe(float64(size))
+}
+
+func (t *metricsTracer) MessageReceived(size int) {
+	t.messageSizes.WithLabelValues("received").Observe(float64(size))
+}
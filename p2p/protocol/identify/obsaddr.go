@@ -11,8 +11,11 @@ import (
 	"github.com/libp2p/go-libp2p-core/event"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/peerstore"
 
+	"github.com/benbjohnson/clock"
+
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 )
@@ -22,12 +25,18 @@ import (
 // can be contacted on. The "seen" events expire by default after 40 minutes
 // (OwnObservedAddressTTL * ActivationThreshold). The are cleaned up during
 // the GC rounds set by GCInterval.
+//
+// This is the default, use the ActivationThreshold option to configure it per
+// ObservedAddrManager.
 var ActivationThresh = 4
 
 // GCInterval specicies how often to make a round cleaning seen events and
 // observed addresses. An address will be cleaned if it has not been seen in
 // OwnObservedAddressTTL (10 minutes). A "seen" event will be cleaned up if
 // it is older than OwnObservedAddressTTL * ActivationThresh (40 minutes).
+//
+// This is the default, use the ObservedAddrGCInterval option to configure it
+// per ObservedAddrManager.
 var GCInterval = 10 * time.Minute
 
 // observedAddrManagerWorkerChannelSize defines how many addresses can be enqueued
@@ -61,12 +70,12 @@ type observedAddr struct {
 	numInbound int
 }
 
-func (oa *observedAddr) activated() bool {
+func (oa *observedAddr) activated(thresh int) bool {
 
 	// We only activate if other peers observed the same address
-	// of ours at least 4 times. SeenBy peers are removed by GC if
-	// they say the address more than ttl*ActivationThresh
-	return len(oa.seenBy) >= ActivationThresh
+	// of ours at least thresh (by default 4) times. SeenBy peers are
+	// removed by GC if they say the address more than ttl*thresh
+	return len(oa.seenBy) >= thresh
 }
 
 // GroupKey returns the group in which this observation belongs. Currently, an
@@ -114,7 +123,13 @@ type ObservedAddrManager struct {
 	// local(internal) address -> list of observed(external) addresses
 	addrs        map[string][]*observedAddr
 	ttl          time.Duration
-	refreshTimer *time.Timer
+	refreshTimer *clock.Timer
+
+	clock            clock.Clock
+	activationThresh int
+	gcInterval       time.Duration
+	// if non-empty, only observations from these peers are recorded
+	trustedObservers map[peer.ID]struct{}
 
 	// this is the worker channel
 	wch chan newObservation
@@ -128,17 +143,42 @@ type ObservedAddrManager struct {
 }
 
 // NewObservedAddrManager returns a new address manager using
-// peerstore.OwnObservedAddressTTL as the TTL.
-func NewObservedAddrManager(host host.Host) (*ObservedAddrManager, error) {
+// peerstore.OwnObservedAddressTTL as the TTL, unless configured
+// otherwise. Options that don't apply to observed addresses are ignored.
+func NewObservedAddrManager(host host.Host, opts ...Option) (*ObservedAddrManager, error) {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return newObservedAddrManager(host, &cfg)
+}
+
+func newObservedAddrManager(host host.Host, cfg *config) (*ObservedAddrManager, error) {
 	oas := &ObservedAddrManager{
-		addrs:       make(map[string][]*observedAddr),
-		ttl:         peerstore.OwnObservedAddrTTL,
-		wch:         make(chan newObservation, observedAddrManagerWorkerChannelSize),
-		host:        host,
-		activeConns: make(map[network.Conn]ma.Multiaddr),
-		// refresh every ttl/2 so we don't forget observations from connected peers
-		refreshTimer: time.NewTimer(peerstore.OwnObservedAddrTTL / 2),
+		addrs:            make(map[string][]*observedAddr),
+		ttl:              peerstore.OwnObservedAddrTTL,
+		wch:              make(chan newObservation, observedAddrManagerWorkerChannelSize),
+		host:             host,
+		activeConns:      make(map[network.Conn]ma.Multiaddr),
+		clock:            cfg.clock,
+		activationThresh: ActivationThresh,
+		gcInterval:       GCInterval,
+		trustedObservers: cfg.trustedObservers,
+	}
+	if oas.clock == nil {
+		oas.clock = clock.New()
 	}
+	if cfg.observedAddrTTL > 0 {
+		oas.ttl = cfg.observedAddrTTL
+	}
+	if cfg.activationThresh > 0 {
+		oas.activationThresh = cfg.activationThresh
+	}
+	if cfg.gcInterval > 0 {
+		oas.gcInterval = cfg.gcInterval
+	}
+	// refresh every ttl/2 so we don't forget observations from connected peers
+	oas.refreshTimer = oas.clock.Timer(oas.ttl / 2)
 	oas.ctx, oas.ctxCancel = context.WithCancel(context.Background())
 
 	reachabilitySub, err := host.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
@@ -195,11 +235,11 @@ func (oas *ObservedAddrManager) Addrs() []ma.Multiaddr {
 
 func (oas *ObservedAddrManager) filter(observedAddrs []*observedAddr) []ma.Multiaddr {
 	pmap := make(map[string][]*observedAddr)
-	now := time.Now()
+	now := oas.clock.Now()
 
 	for i := range observedAddrs {
 		a := observedAddrs[i]
-		if now.Sub(a.lastSeen) <= oas.ttl && a.activated() {
+		if now.Sub(a.lastSeen) <= oas.ttl && a.activated(oas.activationThresh) {
 			// group addresses by their IPX/Transport Protocol(TCP or UDP) pattern.
 			pat := a.groupKey()
 			pmap[pat] = append(pmap[pat], a)
@@ -250,7 +290,7 @@ func (oas *ObservedAddrManager) Record(conn network.Conn, observed ma.Multiaddr)
 func (oas *ObservedAddrManager) worker() {
 	defer oas.refCount.Done()
 
-	ticker := time.NewTicker(GCInterval)
+	ticker := oas.clock.Ticker(oas.gcInterval)
 	defer ticker.Stop()
 
 	subChan := oas.reachabilitySub.Out()
@@ -299,13 +339,13 @@ func (oas *ObservedAddrManager) gc() {
 	oas.mu.Lock()
 	defer oas.mu.Unlock()
 
-	now := time.Now()
+	now := oas.clock.Now()
 	for local, observedAddrs := range oas.addrs {
 		filteredAddrs := observedAddrs[:0]
 		for _, a := range observedAddrs {
 			// clean up SeenBy set
 			for k, ob := range a.seenBy {
-				if now.Sub(ob.seenTime) > oas.ttl*time.Duration(ActivationThresh) {
+				if now.Sub(ob.seenTime) > oas.ttl*time.Duration(oas.activationThresh) {
 					delete(a.seenBy, k)
 					if ob.inbound {
 						a.numInbound--
@@ -375,6 +415,13 @@ func (oas *ObservedAddrManager) maybeRecordObservation(conn network.Conn, observ
 		return
 	}
 
+	if len(oas.trustedObservers) > 0 {
+		if _, ok := oas.trustedObservers[conn.RemotePeer()]; !ok {
+			log.Debugw("ignoring observation from untrusted peer", "peer", conn.RemotePeer(), "observed", observed)
+			return
+		}
+	}
+
 	local := conn.LocalMultiaddr()
 	if !addrInAddrs(local, ifaceaddrs) && !addrInAddrs(local, oas.host.Network().ListenAddresses()) {
 		// not in our list
@@ -408,7 +455,7 @@ func (oas *ObservedAddrManager) maybeRecordObservation(conn network.Conn, observ
 }
 
 func (oas *ObservedAddrManager) recordObservationUnlocked(conn network.Conn, observed ma.Multiaddr) {
-	now := time.Now()
+	now := oas.clock.Now()
 	observerString := observerGroup(conn.RemoteMultiaddr())
 	localString := string(conn.LocalMultiaddr().Bytes())
 	ob := observation{
@@ -455,7 +502,7 @@ func (oas *ObservedAddrManager) recordObservationUnlocked(conn network.Conn, obs
 // With regards to RFC 3489, this could be either a Full Cone NAT, a Restricted Cone NAT or a
 // Port Restricted Cone NAT. However, we do NOT differentiate between them here and simply classify all such NATs as a Cone NAT.
 //
-// 2. If four different peers observe a different address for us on outbound connections, we
+// 2. If four (ActivationThresh) different peers observe a different address for us on outbound connections, we
 // are MOST probably behind a Symmetric NAT.
 //
 // Please see the documentation on the enumerations for `network.NATDeviceType` for more details about these NAT Device types
@@ -481,7 +528,7 @@ func (oas *ObservedAddrManager) emitAllNATTypes() {
 // returns false otherwise.
 func (oas *ObservedAddrManager) emitSpecificNATType(addrs []*observedAddr, protoCode int, transportProto network.NATTransportProtocol,
 	currentNATType network.NATDeviceType) (bool, network.NATDeviceType) {
-	now := time.Now()
+	now := oas.clock.Now()
 	seenBy := make(map[string]struct{})
 	cnt := 0
 
@@ -492,7 +539,7 @@ func (oas *ObservedAddrManager) emitSpecificNATType(addrs []*observedAddr, proto
 		}
 
 		// if we have an activated addresses, it's a Cone NAT.
-		if now.Sub(oa.lastSeen) <= oas.ttl && oa.activated() {
+		if now.Sub(oa.lastSeen) <= oas.ttl && oa.activated(oas.activationThresh) {
 			if currentNATType != network.NATDeviceTypeCone {
 				oas.emitNATDeviceTypeChanged.Emit(event.EvtNATDeviceTypeChanged{
 					TransportProtocol: transportProto,
@@ -516,7 +563,7 @@ func (oas *ObservedAddrManager) emitSpecificNATType(addrs []*observedAddr, proto
 
 	// If four different peers observe a different address for us on each of four outbound connections, we
 	// are MOST probably behind a Symmetric NAT.
-	if cnt >= ActivationThresh && len(seenBy) >= ActivationThresh {
+	if cnt >= oas.activationThresh && len(seenBy) >= oas.activationThresh {
 		if currentNATType != network.NATDeviceTypeSymmetric {
 			oas.emitNATDeviceTypeChanged.Emit(event.EvtNATDeviceTypeChanged{
 				TransportProtocol: transportProto,
@@ -540,6 +587,7 @@ func (oas *ObservedAddrManager) Close() error {
 
 		oas.refCount.Wait()
 		oas.reachabilitySub.Close()
+		oas.emitNATDeviceTypeChanged.Close()
 		oas.host.Network().StopNotify((*obsAddrNotifiee)(oas))
 	})
 	return nil
@@ -14,6 +14,7 @@ import (
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 
+	"github.com/benbjohnson/clock"
 	"github.com/libp2p/go-eventbus"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
@@ -34,6 +35,10 @@ func (h *harness) add(observer ma.Multiaddr) peer.ID {
 	if err != nil {
 		h.t.Fatal(err)
 	}
+	return h.addWithKey(sk, observer)
+}
+
+func (h *harness) addWithKey(sk ic.PrivKey, observer ma.Multiaddr) peer.ID {
 	h2, err := h.mocknet.AddPeer(sk, observer)
 	if err != nil {
 		h.t.Fatal(err)
@@ -83,13 +88,13 @@ func (h *harness) observeInbound(observed ma.Multiaddr, observer peer.ID) networ
 	return c
 }
 
-func newHarness(t *testing.T) harness {
+func newHarness(t *testing.T, opts ...identify.Option) harness {
 	mn := mocknet.New()
 	sk, _, err := ic.GenerateECDSAKeyPair(rand.Reader)
 	require.NoError(t, err)
 	h, err := mn.AddPeer(sk, ma.StringCast("/ip4/127.0.0.1/tcp/10086"))
 	require.NoError(t, err)
-	oas, err := identify.NewObservedAddrManager(h)
+	oas, err := identify.NewObservedAddrManager(h, opts...)
 	require.NoError(t, err)
 	t.Cleanup(func() {
 		mn.Close()
@@ -332,6 +337,63 @@ func TestObservedAddrFiltering(t *testing.T) {
 	require.Contains(t, addrs, it3)
 }
 
+func TestObservedAddrActivationThreshold(t *testing.T) {
+	harness := newHarness(t, identify.ActivationThreshold(2))
+
+	observed := ma.StringCast("/ip4/1.2.3.4/tcp/1231")
+	p1 := harness.add(ma.StringCast("/ip4/1.2.3.6/tcp/1236"))
+	p2 := harness.add(ma.StringCast("/ip4/1.2.3.7/tcp/1237"))
+
+	harness.observe(observed, p1)
+	require.Empty(t, harness.oas.Addrs())
+	harness.observe(observed, p2)
+	require.Equal(t, []ma.Multiaddr{observed}, harness.oas.Addrs())
+}
+
+func TestObservedAddrTrustedObservers(t *testing.T) {
+	sk, _, err := ic.GenerateECDSAKeyPair(rand.Reader)
+	require.NoError(t, err)
+	trusted, err := peer.IDFromPrivateKey(sk)
+	require.NoError(t, err)
+	harness := newHarness(t, identify.ActivationThreshold(1), identify.TrustedObservers(trusted))
+
+	// observations from other peers are ignored
+	untrusted := harness.add(ma.StringCast("/ip4/1.2.3.6/tcp/1236"))
+	harness.observe(ma.StringCast("/ip4/1.2.3.4/tcp/1231"), untrusted)
+	require.Empty(t, harness.oas.Addrs())
+
+	observed := ma.StringCast("/ip4/1.2.3.4/tcp/1232")
+	harness.observe(observed, harness.addWithKey(sk, ma.StringCast("/ip4/1.2.3.7/tcp/1237")))
+	require.Equal(t, []ma.Multiaddr{observed}, harness.oas.Addrs())
+}
+
+func TestObservedAddrClock(t *testing.T) {
+	cl := clock.NewMock()
+	harness := newHarness(t, identify.WithClock(cl), identify.ObservedAddrTTL(time.Hour))
+	require.Equal(t, time.Hour, harness.oas.TTL())
+
+	observed := ma.StringCast("/ip4/1.2.3.4/tcp/1231")
+	peers := []peer.ID{
+		harness.add(ma.StringCast("/ip4/1.2.3.6/tcp/1236")),
+		harness.add(ma.StringCast("/ip4/1.2.3.7/tcp/1237")),
+		harness.add(ma.StringCast("/ip4/1.2.3.8/tcp/1237")),
+		harness.add(ma.StringCast("/ip4/1.2.3.9/tcp/1237")),
+	}
+	for _, p := range peers {
+		harness.observe(observed, p)
+	}
+	require.Equal(t, []ma.Multiaddr{observed}, harness.oas.Addrs())
+
+	// make sure the observations aren't refreshed
+	for _, p := range peers {
+		harness.host.Network().ClosePeer(p)
+	}
+	cl.Add(59 * time.Minute)
+	require.Equal(t, []ma.Multiaddr{observed}, harness.oas.Addrs())
+	cl.Add(2 * time.Minute)
+	require.Empty(t, harness.oas.Addrs())
+}
+
 func TestEmitNATDeviceTypeSymmetric(t *testing.T) {
 	harness := newHarness(t)
 	require.Empty(t, harness.oas.Addrs())
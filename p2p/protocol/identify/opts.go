@@ -1,8 +1,33 @@
 package identify
 
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/benbjohnson/clock"
+	"github.com/ipfs/go-datastore"
+)
+
 type config struct {
 	userAgent               string
 	disableSignedPeerRecord bool
+	metricsTracer           MetricsTracer
+	peerRecordsDatastore    datastore.Datastore
+	peerRecordsMaxAge       time.Duration
+	maxPeerRecords          int
+	disclosurePolicy        DisclosurePolicy
+
+	// push settings
+	pushCoalesceWindow time.Duration
+	maxPushConcurrency int
+
+	// observed address manager settings
+	activationThresh int
+	gcInterval       time.Duration
+	observedAddrTTL  time.Duration
+	clock            clock.Clock
+	trustedObservers map[peer.ID]struct{}
 }
 
 // Option is an option function for identify.
@@ -22,3 +47,111 @@ func DisableSignedPeerRecord() Option {
 		cfg.disableSignedPeerRecord = true
 	}
 }
+
+// WithMetricsTracer sets the tracer that is notified about identify requests,
+// pushes and messages.
+func WithMetricsTracer(t MetricsTracer) Option {
+	return func(cfg *config) {
+		cfg.metricsTracer = t
+	}
+}
+
+// WithDisclosurePolicy sets the policy deciding which protocols and listen
+// addresses are disclosed to which peers. By default, everything is disclosed
+// to every peer.
+func WithDisclosurePolicy(p DisclosurePolicy) Option {
+	return func(cfg *config) {
+		cfg.disclosurePolicy = p
+	}
+}
+
+// PersistPeerRecords persists the signed peer records received from our peers
+// in ds, and loads them into the certified address book on startup. This way,
+// reconnecting to known peers after a restart uses their certified addresses.
+// See PeerRecordsMaxAge and MaxPeerRecords for how long records are kept.
+func PersistPeerRecords(ds datastore.Datastore) Option {
+	return func(cfg *config) {
+		cfg.peerRecordsDatastore = ds
+	}
+}
+
+// PeerRecordsMaxAge sets how long persisted peer records are kept after we received
+// them. Older records are not loaded on startup, and are removed from the datastore.
+// Defaults to DefaultPeerRecordsMaxAge.
+func PeerRecordsMaxAge(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.peerRecordsMaxAge = d
+	}
+}
+
+// MaxPeerRecords limits the number of persisted peer records. When the limit is
+// exceeded, the oldest records are removed. Defaults to DefaultMaxPeerRecords.
+func MaxPeerRecords(n int) Option {
+	return func(cfg *config) {
+		cfg.maxPeerRecords = n
+	}
+}
+
+// PushCoalesceWindow sets how long we wait after our addresses or protocols
+// changed before pushing the update to our peers. All changes within the
+// window are sent in a single push. Defaults to 100ms. A negative value sends
+// pushes right away.
+func PushCoalesceWindow(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.pushCoalesceWindow = d
+	}
+}
+
+// MaxPushConcurrency limits how many identify pushes are sent concurrently.
+// Defaults to 32.
+func MaxPushConcurrency(n int) Option {
+	return func(cfg *config) {
+		cfg.maxPushConcurrency = n
+	}
+}
+
+// ActivationThreshold sets how many different observers need to report an
+// observed address before we advertise it. Defaults to ActivationThresh.
+// Small private networks with fewer observers may want to lower this.
+func ActivationThreshold(n int) Option {
+	return func(cfg *config) {
+		cfg.activationThresh = n
+	}
+}
+
+// ObservedAddrGCInterval sets how often observed addresses and observations
+// are garbage collected. Defaults to GCInterval.
+func ObservedAddrGCInterval(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.gcInterval = d
+	}
+}
+
+// ObservedAddrTTL sets how long an observed address is kept after it was last
+// observed. Defaults to peerstore.OwnObservedAddrTTL.
+func ObservedAddrTTL(ttl time.Duration) Option {
+	return func(cfg *config) {
+		cfg.observedAddrTTL = ttl
+	}
+}
+
+// WithClock sets the clock used to time out observed addresses and persisted peer records.
+// This is mostly useful for testing.
+func WithClock(cl clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = cl
+	}
+}
+
+// TrustedObservers only records address observations made by the given peers,
+// e.g. our own bootstrap nodes. Observations made by any other peer are ignored.
+func TrustedObservers(peers ...peer.ID) Option {
+	return func(cfg *config) {
+		if cfg.trustedObservers == nil {
+			cfg.trustedObservers = make(map[peer.ID]struct{}, len(peers))
+		}
+		for _, p := range peers {
+			cfg.trustedObservers[p] = struct{}{}
+		}
+	}
+}
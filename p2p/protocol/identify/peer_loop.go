@@ -86,15 +86,40 @@ func (ph *peerHandler) stop() error {
 func (ph *peerHandler) loop(ctx context.Context, onExit func()) {
 	defer onExit()
 
+	// Updates are coalesced: we wait for pushCoalesceWindow after the first
+	// update, and then send a single push (or delta) for all updates that
+	// happened in the meantime.
+	var pushTimer, deltaTimer <-chan time.Time
+	coalesce := func() <-chan time.Time {
+		if ph.ids.pushCoalesceWindow <= 0 {
+			c := make(chan time.Time, 1)
+			c <- time.Time{}
+			return c
+		}
+		return time.After(ph.ids.pushCoalesceWindow)
+	}
+
 	for {
 		select {
 		// our listen addresses have changed, send an IDPush.
 		case <-ph.pushCh:
+			if pushTimer == nil {
+				pushTimer = coalesce()
+			}
+		case <-pushTimer:
+			pushTimer = nil
+			// the push contains our protocols, no need to send a delta
+			deltaTimer = nil
 			if err := ph.sendPush(ctx); err != nil {
 				log.Warnw("failed to send Identify Push", "peer", ph.pid, "error", err)
 			}
 
 		case <-ph.deltaCh:
+			if deltaTimer == nil && pushTimer == nil {
+				deltaTimer = coalesce()
+			}
+		case <-deltaTimer:
+			deltaTimer = nil
 			if err := ph.sendDelta(ctx); err != nil {
 				log.Warnw("failed to send Identify Delta", "peer", ph.pid, "error", err)
 			}
@@ -117,22 +142,33 @@ func (ph *peerHandler) sendDelta(ctx context.Context) error {
 
 	// extract a delta message, updating the last state.
 	mes := ph.nextDelta()
+	if mes != nil && ph.ids.disclosurePolicy != nil {
+		conns := ph.ids.Host.Network().ConnsToPeer(ph.pid)
+		if len(conns) == 0 {
+			return nil
+		}
+		mes.AddedProtocols = ph.ids.disclosurePolicy.DiscloseProtocols(conns[0], mes.AddedProtocols)
+		mes.RmProtocols = ph.ids.disclosurePolicy.DiscloseProtocols(conns[0], mes.RmProtocols)
+	}
 	if mes == nil || (len(mes.AddedProtocols) == 0 && len(mes.RmProtocols) == 0) {
 		return nil
 	}
 
-	ds, err := ph.openStream(ctx, []string{IDDelta})
+	ds, release, err := ph.openStream(ctx, []string{IDDelta})
 	if err != nil {
+		ph.pushSent(err)
 		return fmt.Errorf("failed to open delta stream: %w", err)
 	}
-
+	defer release()
 	defer ds.Close()
 
 	c := ds.Conn()
-	if err := protoio.NewDelimitedWriter(ds).WriteMsg(&pb.Identify{Delta: mes}); err != nil {
+	if err := ph.ids.writeIdentifyMsg(protoio.NewDelimitedWriter(ds), &pb.Identify{Delta: mes}); err != nil {
 		_ = ds.Reset()
+		ph.pushSent(err)
 		return fmt.Errorf("failed to send delta message, %w", err)
 	}
+	ph.pushSent(nil)
 	log.Debugw("sent identify update", "protocol", ds.Protocol(), "peer", c.RemotePeer(),
 		"peer address", c.RemoteMultiaddr())
 
@@ -140,14 +176,16 @@ func (ph *peerHandler) sendDelta(ctx context.Context) error {
 }
 
 func (ph *peerHandler) sendPush(ctx context.Context) error {
-	dp, err := ph.openStream(ctx, []string{IDPush})
+	dp, release, err := ph.openStream(ctx, []string{IDPush})
 	if err == errProtocolNotSupported {
 		log.Debugw("not sending push as peer does not support protocol", "peer", ph.pid)
 		return nil
 	}
 	if err != nil {
+		ph.pushSent(err)
 		return fmt.Errorf("failed to open push stream: %w", err)
 	}
+	defer release()
 	defer dp.Close()
 
 	snapshot := ph.ids.getSnapshot()
@@ -156,13 +194,24 @@ func (ph *peerHandler) sendPush(ctx context.Context) error {
 	ph.snapshotMu.Unlock()
 	if err := ph.ids.writeChunkedIdentifyMsg(dp.Conn(), snapshot, dp); err != nil {
 		_ = dp.Reset()
+		ph.pushSent(err)
 		return fmt.Errorf("failed to send push message: %w", err)
 	}
+	ph.pushSent(nil)
 
 	return nil
 }
 
-func (ph *peerHandler) openStream(ctx context.Context, protos []string) (network.Stream, error) {
+func (ph *peerHandler) pushSent(err error) {
+	if ph.ids.metricsTracer != nil {
+		ph.ids.metricsTracer.PushSent(err)
+	}
+}
+
+// openStream opens a stream for pushing updates to the peer. The number of
+// concurrent pushes is limited, the caller must call release once it's done
+// with the stream.
+func (ph *peerHandler) openStream(ctx context.Context, protos []string) (s network.Stream, release func(), err error) {
 	// wait for the other peer to send us an Identify response on "all" connections we have with it
 	// so we can look at it's supported protocols and avoid a multistream-select roundtrip to negotiate the protocol
 	// if we know for a fact that it dosen't support the protocol.
@@ -171,18 +220,20 @@ func (ph *peerHandler) openStream(ctx context.Context, protos []string) (network
 		select {
 		case <-ph.ids.IdentifyWait(c):
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return nil, nil, ctx.Err()
 		}
 	}
 
 	if !ph.peerSupportsProtos(ctx, protos) {
-		return nil, errProtocolNotSupported
+		return nil, nil, errProtocolNotSupported
 	}
 
-	ph.ids.pushSemaphore <- struct{}{}
-	defer func() {
-		<-ph.ids.pushSemaphore
-	}()
+	select {
+	case ph.ids.pushSemaphore <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	release = func() { <-ph.ids.pushSemaphore }
 
 	// negotiate a stream without opening a new connection as we "should" already have a connection.
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -191,12 +242,13 @@ func (ph *peerHandler) openStream(ctx context.Context, protos []string) (network
 
 	// newstream will open a stream on the first protocol the remote peer supports from the among
 	// the list of protocols passed to it.
-	s, err := ph.ids.Host.NewStream(ctx, ph.pid, protocol.ConvertFromStrings(protos)...)
+	s, err = ph.ids.Host.NewStream(ctx, ph.pid, protocol.ConvertFromStrings(protos)...)
 	if err != nil {
-		return nil, err
+		release()
+		return nil, nil, err
 	}
 
-	return s, err
+	return s, release, nil
 }
 
 // returns true if the peer supports atleast one of the given protocols
@@ -0,0 +1,202 @@
+package identify
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/record"
+
+	"github.com/benbjohnson/clock"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+)
+
+const peerRecordsNs = "/libp2p/identify/peer-records"
+
+const (
+	// DefaultPeerRecordsMaxAge is the default maximum age of persisted peer records, see PeerRecordsMaxAge.
+	DefaultPeerRecordsMaxAge = 7 * 24 * time.Hour
+	// DefaultMaxPeerRecords is the default maximum number of persisted peer records, see MaxPeerRecords.
+	DefaultMaxPeerRecords = 10000
+)
+
+// peerRecordStore persists the signed peer records we received from our peers,
+// so we can load them into the certified address book after a restart.
+//
+// Every record is stored with the time we received it. Records older than maxAge
+// are neither loaded nor kept. When more than maxRecords records are stored, the
+// oldest ones are removed.
+type peerRecordStore struct {
+	ds         datastore.Datastore
+	clock      clock.Clock
+	maxAge     time.Duration
+	maxRecords int
+
+	mx    sync.Mutex
+	count int // number of stored records, updated when loading and pruning
+}
+
+func newPeerRecordStore(ds datastore.Datastore, cl clock.Clock, maxAge time.Duration, maxRecords int) *peerRecordStore {
+	if cl == nil {
+		cl = clock.New()
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultPeerRecordsMaxAge
+	}
+	if maxRecords <= 0 {
+		maxRecords = DefaultMaxPeerRecords
+	}
+	return &peerRecordStore{
+		ds:         namespace.Wrap(ds, datastore.NewKey(peerRecordsNs)),
+		clock:      cl,
+		maxAge:     maxAge,
+		maxRecords: maxRecords,
+	}
+}
+
+func peerRecordKey(p peer.ID) datastore.Key {
+	return datastore.NewKey(p.String())
+}
+
+// A stored record is the time it was received (in Unix nanoseconds, big endian),
+// followed by the raw signed envelope.
+const receivedLen = 8
+
+func encodeStoredRecord(received time.Time, raw []byte) []byte {
+	b := make([]byte, receivedLen+len(raw))
+	binary.BigEndian.PutUint64(b, uint64(received.UnixNano()))
+	copy(b[receivedLen:], raw)
+	return b
+}
+
+func decodeStoredRecord(b []byte) (time.Time, *record.Envelope, error) {
+	if len(b) < receivedLen {
+		return time.Time{}, nil, errors.New("stored peer record too short")
+	}
+	received := time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+	env, _, err := record.ConsumeEnvelope(b[receivedLen:], peer.PeerRecordEnvelopeDomain)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	return received, env, nil
+}
+
+// put stores the raw signed envelope containing the peer record of p.
+// Records of other peers are ignored.
+func (s *peerRecordStore) put(p peer.ID, env *record.Envelope, raw []byte) error {
+	rec, err := env.Record()
+	if err != nil {
+		return err
+	}
+	if pr, ok := rec.(*peer.PeerRecord); !ok || pr.PeerID != p {
+		return nil
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	ctx := context.Background()
+	key := peerRecordKey(p)
+	exists, err := s.ds.Has(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := s.ds.Put(ctx, key, encodeStoredRecord(s.clock.Now(), raw)); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	s.count++
+	if s.count > s.maxRecords {
+		// Make some room, so we don't need to prune again on the next record.
+		_, err := s.pruneLocked(s.maxRecords - s.maxRecords/10)
+		return err
+	}
+	return nil
+}
+
+type storedRecord struct {
+	key      datastore.Key
+	received time.Time
+	env      *record.Envelope
+}
+
+// pruneLocked removes records that are invalid or older than maxAge, and the
+// oldest records exceeding max. It returns the remaining records.
+// It must be called with mx held.
+func (s *peerRecordStore) pruneLocked(max int) ([]storedRecord, error) {
+	ctx := context.Background()
+	res, err := s.ds.Query(ctx, query.Query{})
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	var records []storedRecord
+	var remove []datastore.Key
+	for r := range res.Next() {
+		if r.Error != nil {
+			res.Close()
+			return nil, r.Error
+		}
+		key := datastore.NewKey(r.Key)
+		received, env, err := decodeStoredRecord(r.Value)
+		if err != nil {
+			log.Debugw("invalid signed peer record in datastore", "key", r.Key, "error", err)
+			remove = append(remove, key)
+			continue
+		}
+		if now.Sub(received) > s.maxAge {
+			remove = append(remove, key)
+			continue
+		}
+		records = append(records, storedRecord{key: key, received: received, env: env})
+	}
+	res.Close()
+
+	if len(records) > max {
+		sort.Slice(records, func(i, j int) bool { return records[i].received.After(records[j].received) })
+		for _, r := range records[max:] {
+			remove = append(remove, r.key)
+		}
+		records = records[:max]
+	}
+	for _, k := range remove {
+		if err := s.ds.Delete(ctx, k); err != nil {
+			log.Debugw("failed to remove signed peer record from datastore", "key", k, "error", err)
+		}
+	}
+	s.count = len(records)
+	return records, nil
+}
+
+// load adds the stored peer records to the certified address book, using the given TTL.
+// Records that can't be parsed anymore, that are too old, or that exceed the maximum
+// number of records are removed from the datastore.
+func (s *peerRecordStore) load(cab peerstore.CertifiedAddrBook, ttl time.Duration) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	records, err := s.pruneLocked(s.maxRecords)
+	if err != nil {
+		return err
+	}
+	var loaded int
+	for _, r := range records {
+		if _, err := cab.ConsumePeerRecord(r.env, ttl); err != nil {
+			log.Debugw("failed to add stored signed peer record to peerstore", "key", r.key, "error", err)
+			continue
+		}
+		loaded++
+	}
+	log.Debugw("loaded signed peer records", "count", loaded)
+	return nil
+}
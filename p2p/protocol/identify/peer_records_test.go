@@ -0,0 +1,105 @@
+package identify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/record"
+	"github.com/libp2p/go-libp2p-core/test"
+	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
+
+	"github.com/benbjohnson/clock"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func newSignedPeerRecord(t *testing.T) (peer.ID, *record.Envelope, []byte) {
+	t.Helper()
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	rec := peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: id, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1234")}})
+	env, err := record.Seal(rec, priv)
+	require.NoError(t, err)
+	raw, err := env.Marshal()
+	require.NoError(t, err)
+	return id, env, raw
+}
+
+// loadPeerRecords loads the records of s into a new certified address book.
+func loadPeerRecords(t *testing.T, s *peerRecordStore) peerstore.CertifiedAddrBook {
+	t.Helper()
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	t.Cleanup(func() { ps.Close() })
+	cab, ok := peerstore.GetCertifiedAddrBook(ps)
+	require.True(t, ok)
+	require.NoError(t, s.load(cab, time.Hour))
+	return cab
+}
+
+func TestPeerRecordStoreMaxAge(t *testing.T) {
+	clk := clock.NewMock()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	s := newPeerRecordStore(ds, clk, time.Hour, 0)
+
+	old, oldEnv, oldRaw := newSignedPeerRecord(t)
+	require.NoError(t, s.put(old, oldEnv, oldRaw))
+	clk.Add(30 * time.Minute)
+	recent, recentEnv, recentRaw := newSignedPeerRecord(t)
+	require.NoError(t, s.put(recent, recentEnv, recentRaw))
+	clk.Add(45 * time.Minute)
+
+	// the old record is expired, and removed from the datastore
+	cab := loadPeerRecords(t, newPeerRecordStore(ds, clk, time.Hour, 0))
+	require.Nil(t, cab.GetPeerRecord(old))
+	require.NotNil(t, cab.GetPeerRecord(recent))
+	has, err := s.ds.Has(context.Background(), peerRecordKey(old))
+	require.NoError(t, err)
+	require.False(t, has)
+
+	// receiving a record again refreshes it
+	clk.Add(20 * time.Minute)
+	require.NoError(t, s.put(recent, recentEnv, recentRaw))
+	clk.Add(50 * time.Minute)
+	require.NotNil(t, loadPeerRecords(t, newPeerRecordStore(ds, clk, time.Hour, 0)).GetPeerRecord(recent))
+}
+
+func TestPeerRecordStoreMaxRecords(t *testing.T) {
+	clk := clock.NewMock()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	s := newPeerRecordStore(ds, clk, 0, 10)
+
+	var peers []peer.ID
+	for i := 0; i < 11; i++ {
+		p, env, raw := newSignedPeerRecord(t)
+		require.NoError(t, s.put(p, env, raw))
+		peers = append(peers, p)
+		clk.Add(time.Second)
+	}
+	// exceeding the limit removes the oldest records, making room for new ones
+	require.Equal(t, 9, s.count)
+	cab := loadPeerRecords(t, newPeerRecordStore(ds, clk, 0, 10))
+	for _, p := range peers[:2] {
+		require.Nil(t, cab.GetPeerRecord(p))
+	}
+	for _, p := range peers[2:] {
+		require.NotNil(t, cab.GetPeerRecord(p))
+	}
+
+	// when loading, only the newest records are kept
+	cab = loadPeerRecords(t, newPeerRecordStore(ds, clk, 0, 5))
+	for _, p := range peers[:6] {
+		require.Nil(t, cab.GetPeerRecord(p))
+	}
+	for _, p := range peers[6:] {
+		require.NotNil(t, cab.GetPeerRecord(p))
+	}
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// P_MEMORY is the multiaddr code of the memory protocol.
+// Addresses have the form /memory/<id>, where id is an unsigned 64 bit integer.
+const P_MEMORY = 0x0309
+
+var protoMemory = ma.Protocol{
+	Name:       "memory",
+	Code:       P_MEMORY,
+	VCode:      ma.CodeToVarint(P_MEMORY),
+	Size:       64,
+	Transcoder: ma.NewTranscoderFromFunctions(memoryStB, memoryBtS, memoryValidate),
+}
+
+func init() {
+	if err := addMemoryProtocol(); err != nil {
+		panic(err)
+	}
+}
+
+// addMemoryProtocol registers the memory protocol with go-multiaddr.
+// Newer versions of go-multiaddr already define it, which is fine as long as
+// the definition matches ours.
+func addMemoryProtocol() error {
+	if p := ma.ProtocolWithCode(P_MEMORY); p.Code == P_MEMORY {
+		if p.Name != protoMemory.Name || p.Size != protoMemory.Size {
+			return fmt.Errorf("conflicting definition of multiaddr protocol %d: %s", P_MEMORY, p.Name)
+		}
+		return nil
+	}
+	return ma.AddProtocol(protoMemory)
+}
+
+func memoryStB(s string) ([]byte, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse memory addr: %s", err)
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b, nil
+}
+
+func memoryBtS(b []byte) (string, error) {
+	if err := memoryValidate(b); err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(binary.BigEndian.Uint64(b), 10), nil
+}
+
+func memoryValidate(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("invalid length for memory addr: %d", len(b))
+	}
+	return nil
+}
+
+// Addr is the net.Addr of a memory connection.
+type Addr uint64
+
+func (a Addr) Network() string { return "memory" }
+func (a Addr) String() string  { return strconv.FormatUint(uint64(a), 10) }
+
+// Multiaddr returns the /memory multiaddr of a.
+func (a Addr) Multiaddr() ma.Multiaddr {
+	return ma.StringCast("/memory/" + a.String())
+}
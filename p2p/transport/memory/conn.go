@@ -0,0 +1,262 @@
+package memory
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+type chunk struct {
+	data      []byte
+	deliverAt time.Time
+}
+
+// buffer holds the data in flight in one direction of a connection.
+// Writes never block. The amount of buffered data is bounded by the
+// flow control of the stream multiplexer running on top of the connection.
+type buffer struct {
+	mutex         sync.Mutex
+	chunks        []chunk
+	writeClosed   bool
+	readClosed    bool
+	dataAvailable chan struct{}
+}
+
+func newBuffer() *buffer {
+	return &buffer{dataAvailable: make(chan struct{}, 1)}
+}
+
+func (b *buffer) write(p []byte, deliverAt time.Time) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.writeClosed || b.readClosed {
+		return io.ErrClosedPipe
+	}
+	b.chunks = append(b.chunks, chunk{data: append([]byte(nil), p...), deliverAt: deliverAt})
+	b.signal()
+	return nil
+}
+
+// read reads data that is due for delivery.
+// If there's data that's not due yet, it returns how long to wait for it.
+func (b *buffer) read(p []byte) (n int, wait time.Duration, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if len(b.chunks) == 0 {
+		if b.writeClosed {
+			return 0, 0, io.EOF
+		}
+		return 0, 0, nil
+	}
+	c := &b.chunks[0]
+	if d := time.Until(c.deliverAt); d > 0 {
+		return 0, d, nil
+	}
+	n = copy(p, c.data)
+	c.data = c.data[n:]
+	if len(c.data) == 0 {
+		b.chunks = b.chunks[1:]
+	}
+	return n, 0, nil
+}
+
+func (b *buffer) closeWrite() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.writeClosed = true
+	b.signal()
+}
+
+func (b *buffer) closeRead() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.readClosed = true
+	b.chunks = nil
+}
+
+func (b *buffer) signal() {
+	select {
+	case b.dataAvailable <- struct{}{}:
+	default:
+	}
+}
+
+// conn is one end of an in-memory connection.
+// Data written to it is delivered to the other end after the configured latency.
+type conn struct {
+	localAddr, remoteAddr Addr
+	latency               time.Duration
+
+	readBuf, writeBuf *buffer
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	readDeadline, writeDeadline deadline
+}
+
+var _ manet.Conn = &conn{}
+
+// newConnPair creates the two ends of a connection.
+// Data written to an end is delivered to the other end after its latency.
+func newConnPair(addrA, addrB Addr, latencyA, latencyB time.Duration) (*conn, *conn) {
+	ab := newBuffer()
+	ba := newBuffer()
+	a := &conn{
+		localAddr:     addrA,
+		remoteAddr:    addrB,
+		latency:       latencyA,
+		readBuf:       ba,
+		writeBuf:      ab,
+		closed:        make(chan struct{}),
+		readDeadline:  makeDeadline(),
+		writeDeadline: makeDeadline(),
+	}
+	b := &conn{
+		localAddr:     addrB,
+		remoteAddr:    addrA,
+		latency:       latencyB,
+		readBuf:       ab,
+		writeBuf:      ba,
+		closed:        make(chan struct{}),
+		readDeadline:  makeDeadline(),
+		writeDeadline: makeDeadline(),
+	}
+	return a, b
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		select {
+		case <-c.closed:
+			return 0, io.ErrClosedPipe
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		default:
+		}
+		n, wait, err := c.readBuf.read(p)
+		if n > 0 || err != nil {
+			return n, err
+		}
+		var timer *time.Timer
+		var due <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		select {
+		case <-c.readBuf.dataAvailable:
+		case <-due:
+		case <-c.closed:
+		case <-c.readDeadline.wait():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, io.ErrClosedPipe
+	case <-c.writeDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+	if err := c.writeBuf.write(p, time.Now().Add(c.latency)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection. The other end reads the data that's in flight, followed by an EOF.
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.writeBuf.closeWrite()
+		c.readBuf.closeRead()
+	})
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr                { return c.localAddr }
+func (c *conn) RemoteAddr() net.Addr               { return c.remoteAddr }
+func (c *conn) LocalMultiaddr() ma.Multiaddr       { return c.localAddr.Multiaddr() }
+func (c *conn) RemoteMultiaddr() ma.Multiaddr      { return c.remoteAddr.Multiaddr() }
+func (c *conn) SetReadDeadline(t time.Time) error  { c.readDeadline.set(t); return nil }
+func (c *conn) SetWriteDeadline(t time.Time) error { c.writeDeadline.set(t); return nil }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// deadline is an abstraction for handling timeouts, modeled after the one used by net.Pipe.
+type deadline struct {
+	mutex  sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // closed when the deadline is exceeded
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+// set sets the point in time when the deadline will time out.
+// A zero value for t prevents timeout.
+func (d *deadline) set(t time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the timer callback to finish and close cancel
+	}
+	d.timer = nil
+
+	// time is zero, or in the future: reset the cancel channel if it was closed
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+	// time in the past: close the cancel channel
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline is exceeded.
+func (d *deadline) wait() chan struct{} {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,265 @@
+// Package memory implements a libp2p transport that connects hosts in the same process.
+//
+// Connections are in-memory pipes, but they go through the same upgrade path
+// as connections of other transports: they are secured and multiplexed by the
+// upgrader. This makes the transport suitable for integration tests that
+// exercise the full stack without using the network.
+//
+// Listen on /memory/0 to listen on an unused address.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/transport"
+
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	mafmt "github.com/multiformats/go-multiaddr-fmt"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+var log = logging.Logger("memory-tpt")
+
+// ErrAddressInUse is returned when listening on an address that another listener is using.
+var ErrAddressInUse = errors.New("address already in use")
+
+// ErrConnectionRefused is returned when dialing an address nobody is listening on.
+var ErrConnectionRefused = errors.New("connection refused")
+
+// acceptQueueLen is the number of dialed connections that can wait to be accepted.
+// Like a TCP listener with a full backlog, a listener refuses connections beyond that.
+const acceptQueueLen = 64
+
+// listeners contains all memory listeners in this process, by address.
+var listeners = struct {
+	sync.Mutex
+	m map[Addr]*listener
+}{m: make(map[Addr]*listener)}
+
+type Option func(*MemoryTransport) error
+
+// WithLatency delays the delivery of all data written on connections of this transport.
+// Since latencies are configured per transport, the round trip time between two
+// transports is the sum of their latencies.
+func WithLatency(d time.Duration) Option {
+	return func(tr *MemoryTransport) error {
+		if d < 0 {
+			return errors.New("latency must not be negative")
+		}
+		tr.latency = d
+		return nil
+	}
+}
+
+// MemoryTransport is the in-memory transport.
+type MemoryTransport struct {
+	// Connection upgrader for upgrading insecure stream connections to
+	// secure multiplex connections.
+	Upgrader transport.Upgrader
+
+	latency time.Duration
+
+	rcmgr network.ResourceManager
+}
+
+var _ transport.Transport = &MemoryTransport{}
+
+// NewMemoryTransport creates an in-memory transport.
+func NewMemoryTransport(upgrader transport.Upgrader, rcmgr network.ResourceManager, opts ...Option) (*MemoryTransport, error) {
+	if rcmgr == nil {
+		rcmgr = network.NullResourceManager
+	}
+	tr := &MemoryTransport{
+		Upgrader: upgrader,
+		rcmgr:    rcmgr,
+	}
+	for _, o := range opts {
+		if err := o(tr); err != nil {
+			return nil, err
+		}
+	}
+	return tr, nil
+}
+
+var dialMatcher = mafmt.Base(P_MEMORY)
+
+// CanDial returns true if this transport believes it can dial the given
+// multiaddr.
+func (t *MemoryTransport) CanDial(addr ma.Multiaddr) bool {
+	return dialMatcher.Matches(addr)
+}
+
+// Dial dials the peer at the remote address.
+func (t *MemoryTransport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (transport.CapableConn, error) {
+	addr, err := toAddr(raddr)
+	if err != nil {
+		return nil, err
+	}
+	connScope, err := t.rcmgr.OpenConnection(network.DirOutbound, true)
+	if err != nil {
+		log.Debugw("resource manager blocked outgoing connection", "peer", p, "addr", raddr, "error", err)
+		return nil, err
+	}
+	if err := connScope.SetPeer(p); err != nil {
+		log.Debugw("resource manager blocked outgoing connection for peer", "peer", p, "addr", raddr, "error", err)
+		connScope.Done()
+		return nil, err
+	}
+	conn, err := t.dial(ctx, addr)
+	if err != nil {
+		connScope.Done()
+		return nil, err
+	}
+	direction := network.DirOutbound
+	if ok, isClient, _ := network.GetSimultaneousConnect(ctx); ok && !isClient {
+		direction = network.DirInbound
+	}
+	return t.Upgrader.Upgrade(ctx, t, conn, direction, p, connScope)
+}
+
+func (t *MemoryTransport) dial(ctx context.Context, addr Addr) (*conn, error) {
+	listeners.Lock()
+	l, ok := listeners.m[addr]
+	listeners.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrConnectionRefused, addr.Multiaddr())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Like an ephemeral port, the local address of a dialed connection isn't used for listening.
+	local, remote := newConnPair(Addr(rand.Uint64()), addr, t.latency, l.transport.latency)
+	if !l.enqueue(remote) {
+		return nil, fmt.Errorf("%w: %s", ErrConnectionRefused, addr.Multiaddr())
+	}
+	return local, nil
+}
+
+// Listen listens on the given multiaddr.
+func (t *MemoryTransport) Listen(laddr ma.Multiaddr) (transport.Listener, error) {
+	addr, err := toAddr(laddr)
+	if err != nil {
+		return nil, err
+	}
+	l := &listener{
+		transport: t,
+		queue:     make(chan *conn, acceptQueueLen),
+		closed:    make(chan struct{}),
+	}
+
+	listeners.Lock()
+	defer listeners.Unlock()
+	if addr == 0 {
+		for addr == 0 || listeners.m[addr] != nil {
+			addr = Addr(rand.Uint64())
+		}
+	} else if _, ok := listeners.m[addr]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrAddressInUse, laddr)
+	}
+	l.addr = addr
+	listeners.m[addr] = l
+	return t.Upgrader.UpgradeListener(t, l), nil
+}
+
+func toAddr(maddr ma.Multiaddr) (Addr, error) {
+	if !dialMatcher.Matches(maddr) {
+		return 0, fmt.Errorf("not a memory address: %s", maddr)
+	}
+	s, err := maddr.ValueForProtocol(P_MEMORY)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return Addr(id), nil
+}
+
+// Protocols returns the list of terminal protocols this transport can dial.
+func (t *MemoryTransport) Protocols() []int {
+	return []int{P_MEMORY}
+}
+
+// Proxy always returns false for the memory transport.
+func (t *MemoryTransport) Proxy() bool {
+	return false
+}
+
+func (t *MemoryTransport) String() string {
+	return "Memory"
+}
+
+type listener struct {
+	transport *MemoryTransport
+	addr      Addr
+	queue     chan *conn
+
+	mutex     sync.Mutex
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ manet.Listener = &listener{}
+
+// enqueue queues a dialed connection to be accepted.
+// It returns false if the listener is closed or its queue is full.
+func (l *listener) enqueue(c *conn) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	select {
+	case <-l.closed:
+		return false
+	default:
+	}
+	select {
+	case l.queue <- c:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *listener) Accept() (manet.Conn, error) {
+	select {
+	case c := <-l.queue:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		listeners.Lock()
+		delete(listeners.m, l.addr)
+		listeners.Unlock()
+
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		close(l.closed)
+		// close connections that were dialed, but never accepted
+		for {
+			select {
+			case c := <-l.queue:
+				c.Close()
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (l *listener) Addr() net.Addr          { return l.addr }
+func (l *listener) Multiaddr() ma.Multiaddr { return l.addr.Multiaddr() }
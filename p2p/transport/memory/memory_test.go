@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+	csms "github.com/libp2p/go-libp2p/p2p/net/conn-security-multistream"
+	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	ttransport "github.com/libp2p/go-libp2p/p2p/transport/testsuite"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/sec"
+	"github.com/libp2p/go-libp2p-core/sec/insecure"
+
+	ma "github.com/multiformats/go-multiaddr"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTransport(t *testing.T, opts ...Option) (peer.ID, *MemoryTransport) {
+	t.Helper()
+	id, m := makeInsecureMuxer(t)
+	u, err := tptu.New(m, yamux.DefaultTransport)
+	require.NoError(t, err)
+	tr, err := NewMemoryTransport(u, nil, opts...)
+	require.NoError(t, err)
+	return id, tr
+}
+
+func TestMemoryTransport(t *testing.T) {
+	peerA, ta := newTransport(t)
+	_, tb := newTransport(t)
+	ttransport.SubtestTransport(t, ta, tb, "/memory/0", peerA)
+}
+
+func TestMultiaddr(t *testing.T) {
+	addr, err := ma.NewMultiaddr("/memory/1234")
+	require.NoError(t, err)
+	require.Equal(t, "/memory/1234", addr.String())
+	_, err = ma.NewMultiaddr("/memory/foo")
+	require.Error(t, err)
+
+	_, tr := newTransport(t)
+	require.True(t, tr.CanDial(addr))
+	require.False(t, tr.CanDial(ma.StringCast("/ip4/127.0.0.1/tcp/1234")))
+
+	// the protocol is already registered, e.g. by a newer go-multiaddr
+	require.NoError(t, addMemoryProtocol())
+}
+
+func TestListen(t *testing.T) {
+	peerA, ta := newTransport(t)
+	_, tb := newTransport(t)
+
+	addr := ma.StringCast("/memory/1234")
+	ln, err := ta.Listen(addr)
+	require.NoError(t, err)
+	require.Equal(t, addr, ln.Multiaddr())
+	_, err = tb.Listen(addr)
+	require.ErrorIs(t, err, ErrAddressInUse)
+
+	ln2, err := ta.Listen(ma.StringCast("/memory/0"))
+	require.NoError(t, err)
+	defer ln2.Close()
+	require.NotEqual(t, "/memory/0", ln2.Multiaddr().String())
+
+	require.NoError(t, ln.Close())
+	_, err = tb.Dial(context.Background(), addr, peerA)
+	require.ErrorIs(t, err, ErrConnectionRefused)
+}
+
+func TestLatency(t *testing.T) {
+	const latency = 50 * time.Millisecond
+	a, b := newConnPair(1, 2, latency, 0)
+	defer a.Close()
+	defer b.Close()
+
+	start := time.Now()
+	_, err := a.Write([]byte("foobar"))
+	require.NoError(t, err)
+	buf := make([]byte, 6)
+	_, err = io.ReadFull(b, buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foobar"), buf)
+	require.GreaterOrEqual(t, time.Since(start), latency)
+
+	// data in flight is delivered before the EOF
+	_, err = b.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+	data, err := io.ReadAll(a)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), data)
+	_, err = a.Write([]byte("bar"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func TestDeadline(t *testing.T) {
+	a, b := newConnPair(1, 2, 0, 0)
+	defer a.Close()
+	defer b.Close()
+
+	require.NoError(t, a.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, err := a.Read(make([]byte, 1))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.NoError(t, a.SetReadDeadline(time.Time{}))
+	_, err = b.Write([]byte("a"))
+	require.NoError(t, err)
+	_, err = a.Read(make([]byte, 1))
+	require.NoError(t, err)
+}
+
+func TestHosts(t *testing.T) {
+	const latency = 20 * time.Millisecond
+	newHost := func() host.Host {
+		h, err := libp2p.New(
+			libp2p.Transport(NewMemoryTransport, WithLatency(latency)),
+			libp2p.ListenAddrStrings("/memory/0"),
+		)
+		require.NoError(t, err)
+		return h
+	}
+	h1 := newHost()
+	defer h1.Close()
+	h2 := newHost()
+	defer h2.Close()
+
+	require.NoError(t, h2.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}))
+	res := <-ping.Ping(context.Background(), h2, h1.ID())
+	require.NoError(t, res.Error)
+	require.GreaterOrEqual(t, res.RTT, 2*latency)
+}
+
+func makeInsecureMuxer(t *testing.T) (peer.ID, sec.SecureMuxer) {
+	t.Helper()
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	var secMuxer csms.SSMuxer
+	secMuxer.AddTransport(insecure.ID, insecure.NewWithIdentity(id, priv))
+	return id, &secMuxer
+}
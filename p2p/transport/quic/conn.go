@@ -25,6 +25,8 @@ type conn struct {
 	remotePeerID    peer.ID
 	remotePubKey    ic.PubKey
 	remoteMultiaddr ma.Multiaddr
+
+	datagrams chan []byte // nil unless both peers enabled datagram support
 }
 
 var _ tpt.CapableConn = &conn{}
@@ -14,9 +14,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/p2p/net/datagram"
+	ttransport "github.com/libp2p/go-libp2p/p2p/transport/testsuite"
+
 	ic "github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
 	tpt "github.com/libp2p/go-libp2p-core/transport"
 
 	mocknetwork "github.com/libp2p/go-libp2p-testing/mocks/network"
@@ -99,6 +103,108 @@ func TestHandshake(t *testing.T) {
 	})
 }
 
+func TestDatagramsNotSupported(t *testing.T) {
+	serverID, serverKey := createPeer(t)
+	_, clientKey := createPeer(t)
+	serverTransport, err := NewTransport(serverKey, nil, nil, nil)
+	require.NoError(t, err)
+	defer serverTransport.(io.Closer).Close()
+	ln := runServer(t, serverTransport, "/ip4/127.0.0.1/udp/0/quic")
+	defer ln.Close()
+
+	clientTransport, err := NewTransport(clientKey, nil, nil, nil, EnableDatagrams())
+	require.NoError(t, err)
+	defer clientTransport.(io.Closer).Close()
+	cconn, err := clientTransport.Dial(context.Background(), ln.Multiaddr(), serverID)
+	require.NoError(t, err)
+	defer cconn.Close()
+
+	// datagrams need to be enabled on both sides
+	c := cconn.(*conn)
+	require.False(t, c.SupportsDatagrams())
+	require.ErrorIs(t, c.SendDatagram([]byte("foobar")), datagram.ErrNotSupported)
+	_, err = c.ReceiveDatagram(context.Background())
+	require.ErrorIs(t, err, datagram.ErrNotSupported)
+}
+
+func TestPrivateNetwork(t *testing.T) {
+	psk := make(pnet.PSK, 32)
+	_, err := rand.Read(psk)
+	require.NoError(t, err)
+	otherPSK := make(pnet.PSK, 32)
+	_, err = rand.Read(otherPSK)
+	require.NoError(t, err)
+
+	serverID, serverKey := createPeer(t)
+	serverTransport, err := NewTransport(serverKey, psk, nil, nil)
+	require.NoError(t, err)
+	defer serverTransport.(io.Closer).Close()
+	ln := runServer(t, serverTransport, "/ip4/127.0.0.1/udp/0/quic")
+	defer ln.Close()
+
+	t.Run("same PSK", func(t *testing.T) {
+		_, clientKey := createPeer(t)
+		clientTransport, err := NewTransport(clientKey, psk, nil, nil)
+		require.NoError(t, err)
+		defer clientTransport.(io.Closer).Close()
+
+		conn, err := clientTransport.Dial(context.Background(), ln.Multiaddr(), serverID)
+		require.NoError(t, err)
+		defer conn.Close()
+		serverConn, err := ln.Accept()
+		require.NoError(t, err)
+		defer serverConn.Close()
+
+		str, err := conn.OpenStream(context.Background())
+		require.NoError(t, err)
+		_, err = str.Write([]byte("foobar"))
+		require.NoError(t, err)
+		require.NoError(t, str.Close())
+		sstr, err := serverConn.AcceptStream()
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(sstr)
+		require.NoError(t, err)
+		require.Equal(t, []byte("foobar"), data)
+	})
+
+	for _, tc := range []struct {
+		name string
+		psk  pnet.PSK
+	}{
+		{name: "different PSK", psk: otherPSK},
+		{name: "no PSK"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, clientKey := createPeer(t)
+			clientTransport, err := NewTransport(clientKey, tc.psk, nil, nil)
+			require.NoError(t, err)
+			defer clientTransport.(io.Closer).Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+			_, err = clientTransport.Dial(ctx, ln.Multiaddr(), serverID)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPrivateNetworkTransportSuite(t *testing.T) {
+	psk := make(pnet.PSK, 32)
+	_, err := rand.Read(psk)
+	require.NoError(t, err)
+
+	peerA, keyA := createPeer(t)
+	ta, err := NewTransport(keyA, psk, nil, nil)
+	require.NoError(t, err)
+	defer ta.(io.Closer).Close()
+	_, keyB := createPeer(t)
+	tb, err := NewTransport(keyB, psk, nil, nil)
+	require.NoError(t, err)
+	defer tb.(io.Closer).Close()
+
+	ttransport.SubtestTransport(t, ta, tb, "/ip4/127.0.0.1/udp/0/quic", peerA)
+}
+
 func TestResourceManagerSuccess(t *testing.T) {
 	serverID, serverKey := createPeer(t)
 	clientID, clientKey := createPeer(t)
@@ -0,0 +1,184 @@
+package libp2pquic
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/net/datagram"
+
+	"github.com/libp2p/go-libp2p-core/network"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/logging"
+)
+
+// datagramQueueLen is the number of received datagrams we buffer per connection.
+// When the application doesn't read them quickly enough, datagrams are dropped.
+const datagramQueueLen = 128
+
+// startReceivingDatagrams starts reading datagrams if both peers enabled datagram support.
+// It must be called before the connection is returned to the application.
+func (c *conn) startReceivingDatagrams() {
+	if c.transport.datagrams == nil || !c.transport.datagrams.peerSupportsDatagrams(c.quicConn) {
+		return
+	}
+	c.datagrams = make(chan []byte, datagramQueueLen)
+	go c.receiveDatagrams()
+}
+
+func (c *conn) receiveDatagrams() {
+	for {
+		b, err := c.quicConn.ReceiveMessage()
+		if err != nil {
+			return
+		}
+		// The memory is released when the datagram is read, or when the connection is closed.
+		if err := c.scope.ReserveMemory(len(b), network.ReservationPriorityLow); err != nil {
+			log.Debugw("dropping datagram", "peer", c.remotePeerID, "error", err)
+			continue
+		}
+		select {
+		case c.datagrams <- b:
+		default:
+			log.Debugw("dropping datagram, queue full", "peer", c.remotePeerID)
+			c.scope.ReleaseMemory(len(b))
+		}
+	}
+}
+
+// SupportsDatagrams returns whether both peers enabled datagram support.
+func (c *conn) SupportsDatagrams() bool {
+	return c.datagrams != nil
+}
+
+// SendDatagram sends b as an unreliable datagram.
+// It returns datagram.ErrNotSupported if datagram support wasn't negotiated, see EnableDatagrams.
+// It blocks until the datagram is sent, or the connection is closed.
+func (c *conn) SendDatagram(b []byte) error {
+	if c.datagrams == nil {
+		return datagram.ErrNotSupported
+	}
+	if err := c.scope.ReserveMemory(len(b), network.ReservationPriorityLow); err != nil {
+		return err
+	}
+	defer c.scope.ReleaseMemory(len(b))
+	return c.quicConn.SendMessage(b)
+}
+
+// ReceiveDatagram returns the next datagram received on the connection.
+// It returns datagram.ErrNotSupported if datagram support wasn't negotiated.
+func (c *conn) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	if c.datagrams == nil {
+		return nil, datagram.ErrNotSupported
+	}
+	select {
+	case b := <-c.datagrams:
+		c.scope.ReleaseMemory(len(b))
+		return b, nil
+	case <-c.quicConn.Context().Done():
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// datagramTracer records which peers support datagrams.
+// quic-go's ConnectionState().SupportsDatagrams can't be relied upon: peers that
+// disabled datagrams send a max_datagram_frame_size of 0 instead of omitting the
+// transport parameter, and quic-go treats that as datagram support.
+type datagramTracer struct {
+	mutex sync.Mutex
+	// tracing ID of the connection -> whether the peer supports datagrams
+	peers map[uint64]bool
+}
+
+var _ logging.Tracer = &datagramTracer{}
+
+func newDatagramTracer() *datagramTracer {
+	return &datagramTracer{peers: make(map[uint64]bool)}
+}
+
+func (t *datagramTracer) TracerForConnection(ctx context.Context, _ logging.Perspective, _ logging.ConnectionID) logging.ConnectionTracer {
+	id, ok := ctx.Value(quic.ConnectionTracingKey).(uint64)
+	if !ok {
+		return nil
+	}
+	return &datagramConnTracer{tracer: t, id: id}
+}
+
+func (t *datagramTracer) SentPacket(net.Addr, *logging.Header, logging.ByteCount, []logging.Frame) {}
+func (t *datagramTracer) DroppedPacket(net.Addr, logging.PacketType, logging.ByteCount, logging.PacketDropReason) {
+}
+
+func (t *datagramTracer) peerSupportsDatagrams(qconn quic.Connection) bool {
+	id, ok := qconn.Context().Value(quic.ConnectionTracingKey).(uint64)
+	if !ok {
+		return false
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.peers[id]
+}
+
+func (t *datagramTracer) setPeerParams(id uint64, params *logging.TransportParameters) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.peers[id] = params.MaxDatagramFrameSize > 0
+}
+
+func (t *datagramTracer) removeConn(id uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.peers, id)
+}
+
+type datagramConnTracer struct {
+	tracer *datagramTracer
+	id     uint64
+}
+
+var _ logging.ConnectionTracer = &datagramConnTracer{}
+
+func (t *datagramConnTracer) ReceivedTransportParameters(params *logging.TransportParameters) {
+	t.tracer.setPeerParams(t.id, params)
+}
+
+func (t *datagramConnTracer) RestoredTransportParameters(params *logging.TransportParameters) {
+	t.tracer.setPeerParams(t.id, params)
+}
+
+func (t *datagramConnTracer) Close() { t.tracer.removeConn(t.id) }
+
+func (t *datagramConnTracer) StartedConnection(net.Addr, net.Addr, logging.ConnectionID, logging.ConnectionID) {
+}
+func (t *datagramConnTracer) NegotiatedVersion(logging.VersionNumber, []logging.VersionNumber, []logging.VersionNumber) {
+}
+func (t *datagramConnTracer) ClosedConnection(error)                               {}
+func (t *datagramConnTracer) SentTransportParameters(*logging.TransportParameters) {}
+func (t *datagramConnTracer) SentPacket(*logging.ExtendedHeader, logging.ByteCount, *logging.AckFrame, []logging.Frame) {
+}
+func (t *datagramConnTracer) ReceivedVersionNegotiationPacket(*logging.Header, []logging.VersionNumber) {
+}
+func (t *datagramConnTracer) ReceivedRetry(*logging.Header) {}
+func (t *datagramConnTracer) ReceivedPacket(*logging.ExtendedHeader, logging.ByteCount, []logging.Frame) {
+}
+func (t *datagramConnTracer) BufferedPacket(logging.PacketType) {}
+func (t *datagramConnTracer) DroppedPacket(logging.PacketType, logging.ByteCount, logging.PacketDropReason) {
+}
+func (t *datagramConnTracer) UpdatedMetrics(*logging.RTTStats, logging.ByteCount, logging.ByteCount, int) {
+}
+func (t *datagramConnTracer) AcknowledgedPacket(logging.EncryptionLevel, logging.PacketNumber) {}
+func (t *datagramConnTracer) LostPacket(logging.EncryptionLevel, logging.PacketNumber, logging.PacketLossReason) {
+}
+func (t *datagramConnTracer) UpdatedCongestionState(logging.CongestionState)                     {}
+func (t *datagramConnTracer) UpdatedPTOCount(uint32)                                             {}
+func (t *datagramConnTracer) UpdatedKeyFromTLS(logging.EncryptionLevel, logging.Perspective)     {}
+func (t *datagramConnTracer) UpdatedKey(logging.KeyPhase, bool)                                  {}
+func (t *datagramConnTracer) DroppedEncryptionLevel(logging.EncryptionLevel)                     {}
+func (t *datagramConnTracer) DroppedKey(logging.KeyPhase)                                        {}
+func (t *datagramConnTracer) SetLossTimer(logging.TimerType, logging.EncryptionLevel, time.Time) {}
+func (t *datagramConnTracer) LossTimerExpired(logging.TimerType, logging.EncryptionLevel)        {}
+func (t *datagramConnTracer) LossTimerCanceled()                                                 {}
+func (t *datagramConnTracer) Debug(string, string)                                               {}
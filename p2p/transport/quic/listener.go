@@ -41,7 +41,7 @@ func newListener(rconn *reuseConn, t *transport, localPeer peer.ID, key ic.PrivK
 		conf, _ := identity.ConfigForPeer("")
 		return conf, nil
 	}
-	ln, err := quicListen(rconn, &tlsConf, t.serverConfig)
+	ln, err := quicListen(t.wrapPacketConn(rconn), &tlsConf, t.serverConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +78,7 @@ func (l *listener) Accept() (tpt.CapableConn, error) {
 			continue
 		}
 		l.transport.addConn(qconn, c)
+		c.startReceivingDatagrams()
 
 		// return through active hole punching if any
 		key := holePunchKey{addr: qconn.RemoteAddr().String(), peer: c.remotePeerID}
@@ -0,0 +1,110 @@
+package libp2pquic
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type config struct {
+	quicConfig     *quic.Config
+	qlogDir        string
+	registerer     prometheus.Registerer
+	disableMetrics bool
+}
+
+// Option is an option that can be passed to NewTransport.
+type Option func(*config) error
+
+// WithMaxStreamReceiveWindow sets the maximum flow control window of a stream.
+func WithMaxStreamReceiveWindow(size uint64) Option {
+	return func(cfg *config) error {
+		if size == 0 {
+			return errors.New("stream receive window must be positive")
+		}
+		cfg.quicConfig.MaxStreamReceiveWindow = size
+		return nil
+	}
+}
+
+// WithMaxConnectionReceiveWindow sets the maximum flow control window of a connection.
+func WithMaxConnectionReceiveWindow(size uint64) Option {
+	return func(cfg *config) error {
+		if size == 0 {
+			return errors.New("connection receive window must be positive")
+		}
+		cfg.quicConfig.MaxConnectionReceiveWindow = size
+		return nil
+	}
+}
+
+// WithMaxIncomingStreams sets the number of streams a peer may open concurrently on a connection.
+func WithMaxIncomingStreams(n int64) Option {
+	return func(cfg *config) error {
+		if n <= 0 {
+			return errors.New("max incoming streams must be positive")
+		}
+		cfg.quicConfig.MaxIncomingStreams = n
+		return nil
+	}
+}
+
+// WithIdleTimeout sets the time after which an idle connection is closed.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(cfg *config) error {
+		if d <= 0 {
+			return errors.New("idle timeout must be positive")
+		}
+		cfg.quicConfig.MaxIdleTimeout = d
+		return nil
+	}
+}
+
+// WithKeepAlive enables or disables keep-alive packets, which prevent connections
+// from timing out when idle. Keep-alives are enabled by default.
+func WithKeepAlive(enable bool) Option {
+	return func(cfg *config) error {
+		cfg.quicConfig.KeepAlive = enable
+		return nil
+	}
+}
+
+// EnableDatagrams enables support for unreliable datagrams (RFC 9221).
+// Datagrams can only be used on connections to peers that enabled them as well.
+func EnableDatagrams() Option {
+	return func(cfg *config) error {
+		cfg.quicConfig.EnableDatagrams = true
+		return nil
+	}
+}
+
+// WithQlogDir makes the transport write a qlog for every connection to the given directory.
+// It takes precedence over the QLOGDIR environment variable.
+func WithQlogDir(dir string) Option {
+	return func(cfg *config) error {
+		cfg.qlogDir = dir
+		return nil
+	}
+}
+
+// WithMetricsRegisterer registers the transport's Prometheus metrics with reg
+// instead of the default registerer. Transports can share a registerer.
+func WithMetricsRegisterer(reg prometheus.Registerer) Option {
+	return func(cfg *config) error {
+		if reg == nil {
+			return errors.New("registerer must not be nil")
+		}
+		cfg.registerer = reg
+		return nil
+	}
+}
+
+// DisableMetrics disables the collection of Prometheus metrics.
+func DisableMetrics() Option {
+	return func(cfg *config) error {
+		cfg.disableMetrics = true
+		return nil
+	}
+}
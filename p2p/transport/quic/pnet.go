@@ -0,0 +1,114 @@
+package libp2pquic
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/libp2p/go-libp2p-core/pnet"
+
+	"github.com/minio/sha256-simd"
+)
+
+const pnetKeyInfo = "libp2p quic private network key"
+
+var errPacketTooLarge = errors.New("packet too large")
+
+// maxPacketSize is the largest UDP payload we can receive.
+const maxPacketSize = 1 << 16
+
+// pnetPacketConn protects every packet sent on a private network.
+// Packets are sealed with XChaCha20-Poly1305, using a key derived from the PSK
+// and a random nonce that's prepended to the packet. Packets from nodes that
+// don't know the PSK fail authentication and are dropped before they reach QUIC,
+// so these nodes can't even start a handshake.
+//
+// Protecting packets adds 40 bytes of overhead to every packet.
+type pnetPacketConn struct {
+	net.PacketConn
+	aead cipher.AEAD
+}
+
+var packetBufferPool = sync.Pool{New: func() interface{} {
+	b := make([]byte, maxPacketSize)
+	return &b
+}}
+
+func newPNetAEAD(psk pnet.PSK) (cipher.AEAD, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, psk, nil, []byte(pnetKeyInfo)), key); err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.NewX(key)
+}
+
+func newPNetPacketConn(c net.PacketConn, aead cipher.AEAD) net.PacketConn {
+	return &pnetPacketConn{PacketConn: c, aead: aead}
+}
+
+func (c *pnetPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	bp := packetBufferPool.Get().(*[]byte)
+	defer packetBufferPool.Put(bp)
+	buf := *bp
+
+	nonceSize := c.aead.NonceSize()
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(buf)
+		if err != nil {
+			return n, addr, err
+		}
+		if n < nonceSize+c.aead.Overhead() || n-nonceSize-c.aead.Overhead() > len(p) {
+			continue
+		}
+		plaintext, err := c.aead.Open(p[:0], buf[:nonceSize], buf[nonceSize:n], nil)
+		if err != nil {
+			// Not sent by a member of the private network.
+			log.Debugw("dropping unauthenticated packet", "addr", addr)
+			continue
+		}
+		return len(plaintext), addr, nil
+	}
+}
+
+func (c *pnetPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	bp := packetBufferPool.Get().(*[]byte)
+	defer packetBufferPool.Put(bp)
+
+	nonceSize := c.aead.NonceSize()
+	if len(p)+nonceSize+c.aead.Overhead() > maxPacketSize {
+		return 0, errPacketTooLarge
+	}
+	nonce := (*bp)[:nonceSize]
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	if _, err := c.PacketConn.WriteTo(c.aead.Seal(nonce, nonce, p, nil), addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetReadBuffer and SyscallConn allow quic-go to increase the receive buffer of the underlying UDP socket.
+
+func (c *pnetPacketConn) SetReadBuffer(bytes int) error {
+	conn, ok := c.PacketConn.(interface{ SetReadBuffer(int) error })
+	if !ok {
+		return errors.New("can't set the receive buffer size")
+	}
+	return conn.SetReadBuffer(bytes)
+}
+
+func (c *pnetPacketConn) SyscallConn() (syscall.RawConn, error) {
+	conn, ok := c.PacketConn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("not a syscall.Conn")
+	}
+	return conn.SyscallConn()
+}
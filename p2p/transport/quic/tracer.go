@@ -11,18 +11,44 @@ import (
 
 	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/lucas-clemente/quic-go/qlog"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-var tracer logging.Tracer
-
-func init() {
-	tracers := []logging.Tracer{&metricsTracer{}}
-	if qlogDir := os.Getenv("QLOGDIR"); len(qlogDir) > 0 {
-		if qlogger := initQlogger(qlogDir); qlogger != nil {
-			tracers = append(tracers, qlogger)
+// newTracer creates the tracer for a transport, collecting metrics and writing
+// qlogs as configured. If datagrams is non-nil, it is used to track datagram support.
+// It returns nil if there's nothing to trace.
+func newTracer(cfg *config, datagrams *datagramTracer) (logging.Tracer, error) {
+	var tracers []logging.Tracer
+	if datagrams != nil {
+		tracers = append(tracers, datagrams)
+	}
+	if !cfg.disableMetrics {
+		reg := cfg.registerer
+		if reg == nil {
+			reg = prometheus.DefaultRegisterer
 		}
+		m, err := newMetrics(reg)
+		if err != nil {
+			return nil, err
+		}
+		tracers = append(tracers, &metricsTracer{metrics: m})
+	}
+	qlogDir := cfg.qlogDir
+	if len(qlogDir) == 0 {
+		qlogDir = os.Getenv("QLOGDIR")
+	}
+	if len(qlogDir) > 0 {
+		tracers = append(tracers, initQlogger(qlogDir))
+	}
+
+	switch len(tracers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return tracers[0], nil
+	default:
+		return logging.NewMultiplexedTracer(tracers...), nil
 	}
-	tracer = logging.NewMultiplexedTracer(tracers...)
 }
 
 func initQlogger(qlogDir string) logging.Tracer {
@@ -8,13 +8,16 @@ import (
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/logging"
 )
 
-var (
+// metrics are the Prometheus metrics of all transports sharing a registerer.
+type metrics struct {
 	bytesTransferred *prometheus.CounterVec
 	newConns         *prometheus.CounterVec
 	closedConns      *prometheus.CounterVec
@@ -24,7 +27,8 @@ var (
 	droppedPackets   *prometheus.CounterVec
 	lostPackets      *prometheus.CounterVec
 	connErrors       *prometheus.CounterVec
-)
+	collector        *aggregatingCollector
+}
 
 type aggregatingCollector struct {
 	mutex sync.Mutex
@@ -40,7 +44,7 @@ func newAggregatingCollector() *aggregatingCollector {
 		rtts: prometheus.NewHistogram(prometheus.HistogramOpts{
 			Name:    "quic_smoothed_rtt",
 			Help:    "Smoothed RTT",
-			Buckets: prometheus.ExponentialBuckets(0.001, 1.25, 40), // 1ms to ~6000ms
+			Buckets: metricshelper.LatencyBuckets(),
 		}),
 		connDurations: prometheus.NewHistogram(prometheus.HistogramOpts{
 			Name:    "quic_connection_duration",
@@ -83,106 +87,64 @@ func (c *aggregatingCollector) RemoveConn(id string) {
 	c.mutex.Unlock()
 }
 
-var collector *aggregatingCollector
-
-func init() {
+// newMetrics registers the metrics with reg. If they're already registered,
+// for example by another transport, the existing metrics are reused.
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
 	const (
 		direction = "direction"
 		encLevel  = "encryption_level"
 	)
 
-	closedConns = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "quic_connections_closed_total",
-			Help: "closed QUIC connection",
-		},
-		[]string{direction},
-	)
-	prometheus.MustRegister(closedConns)
-	newConns = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "quic_connections_new_total",
-			Help: "new QUIC connection",
-		},
-		[]string{direction, "handshake_successful"},
-	)
-	prometheus.MustRegister(newConns)
-	bytesTransferred = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "quic_transferred_bytes",
-			Help: "QUIC bytes transferred",
-		},
-		[]string{direction}, // TODO: this is confusing. Other times, we use direction for the perspective
-	)
-	prometheus.MustRegister(bytesTransferred)
-	sentPackets = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "quic_packets_sent_total",
-			Help: "QUIC packets sent",
-		},
-		[]string{encLevel},
-	)
-	prometheus.MustRegister(sentPackets)
-	rcvdPackets = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "quic_packets_rcvd_total",
-			Help: "QUIC packets received",
-		},
-		[]string{encLevel},
-	)
-	prometheus.MustRegister(rcvdPackets)
-	bufferedPackets = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "quic_packets_buffered_total",
-			Help: "Buffered packets",
-		},
-		[]string{"packet_type"},
-	)
-	prometheus.MustRegister(bufferedPackets)
-	droppedPackets = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "quic_packets_dropped_total",
-			Help: "Dropped packets",
-		},
-		[]string{"packet_type", "reason"},
-	)
-	prometheus.MustRegister(droppedPackets)
-	connErrors = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "quic_connection_errors_total",
-			Help: "QUIC connection errors",
-		},
-		[]string{"side", "error_code"},
-	)
-	prometheus.MustRegister(connErrors)
-	lostPackets = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "quic_packets_lost_total",
-			Help: "QUIC lost received",
-		},
-		[]string{encLevel, "reason"},
-	)
-	prometheus.MustRegister(lostPackets)
-	collector = newAggregatingCollector()
-	prometheus.MustRegister(collector)
+	m := &metrics{}
+	for _, c := range []struct {
+		vec  **prometheus.CounterVec
+		opts prometheus.CounterOpts
+		lbls []string
+	}{
+		{&m.closedConns, prometheus.CounterOpts{Name: "quic_connections_closed_total", Help: "closed QUIC connection"}, []string{direction}},
+		{&m.newConns, prometheus.CounterOpts{Name: "quic_connections_new_total", Help: "new QUIC connection"}, []string{direction, "handshake_successful"}},
+		// TODO: this is confusing. Other times, we use direction for the perspective
+		{&m.bytesTransferred, prometheus.CounterOpts{Name: "quic_transferred_bytes", Help: "QUIC bytes transferred"}, []string{direction}},
+		{&m.sentPackets, prometheus.CounterOpts{Name: "quic_packets_sent_total", Help: "QUIC packets sent"}, []string{encLevel}},
+		{&m.rcvdPackets, prometheus.CounterOpts{Name: "quic_packets_rcvd_total", Help: "QUIC packets received"}, []string{encLevel}},
+		{&m.bufferedPackets, prometheus.CounterOpts{Name: "quic_packets_buffered_total", Help: "Buffered packets"}, []string{"packet_type"}},
+		{&m.droppedPackets, prometheus.CounterOpts{Name: "quic_packets_dropped_total", Help: "Dropped packets"}, []string{"packet_type", "reason"}},
+		{&m.connErrors, prometheus.CounterOpts{Name: "quic_connection_errors_total", Help: "QUIC connection errors"}, []string{"side", "error_code"}},
+		{&m.lostPackets, prometheus.CounterOpts{Name: "quic_packets_lost_total", Help: "QUIC lost received"}, []string{encLevel, "reason"}},
+	} {
+		vec, err := metricshelper.RegisterCollector(reg, prometheus.NewCounterVec(c.opts, c.lbls))
+		if err != nil {
+			return nil, err
+		}
+		*c.vec = vec.(*prometheus.CounterVec)
+	}
+	collector, err := metricshelper.RegisterCollector(reg, newAggregatingCollector())
+	if err != nil {
+		return nil, err
+	}
+	m.collector = collector.(*aggregatingCollector)
+	return m, nil
 }
 
-type metricsTracer struct{}
+type metricsTracer struct {
+	metrics *metrics
+}
 
 var _ logging.Tracer = &metricsTracer{}
 
 func (m *metricsTracer) TracerForConnection(_ context.Context, p logging.Perspective, connID logging.ConnectionID) logging.ConnectionTracer {
-	return &metricsConnTracer{perspective: p, connID: connID}
+	return &metricsConnTracer{metrics: m.metrics, perspective: p, connID: connID}
 }
 
 func (m *metricsTracer) SentPacket(_ net.Addr, _ *logging.Header, size logging.ByteCount, _ []logging.Frame) {
-	bytesTransferred.WithLabelValues("sent").Add(float64(size))
+	m.metrics.bytesTransferred.WithLabelValues("sent").Add(float64(size))
 }
 
 func (m *metricsTracer) DroppedPacket(addr net.Addr, packetType logging.PacketType, count logging.ByteCount, reason logging.PacketDropReason) {
 }
 
 type metricsConnTracer struct {
+	metrics           *metrics
 	perspective       logging.Perspective
 	startTime         time.Time
 	connID            logging.ConnectionID
@@ -221,7 +183,7 @@ func (m *metricsConnTracer) getEncLevel(packetType logging.PacketType) string {
 
 func (m *metricsConnTracer) StartedConnection(net.Addr, net.Addr, logging.ConnectionID, logging.ConnectionID) {
 	m.startTime = time.Now()
-	collector.AddConn(m.connID.String(), m)
+	m.metrics.collector.AddConn(m.connID.String(), m)
 }
 
 func (m *metricsConnTracer) NegotiatedVersion(chosen quic.VersionNumber, clientVersions []quic.VersionNumber, serverVersions []quic.VersionNumber) {
@@ -262,36 +224,36 @@ func (m *metricsConnTracer) ClosedConnection(e error) {
 	if remote {
 		side = "remote"
 	}
-	connErrors.WithLabelValues(side, desc).Inc()
+	m.metrics.connErrors.WithLabelValues(side, desc).Inc()
 }
 func (m *metricsConnTracer) SentTransportParameters(parameters *logging.TransportParameters)     {}
 func (m *metricsConnTracer) ReceivedTransportParameters(parameters *logging.TransportParameters) {}
 func (m *metricsConnTracer) RestoredTransportParameters(parameters *logging.TransportParameters) {}
 func (m *metricsConnTracer) SentPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, _ *logging.AckFrame, _ []logging.Frame) {
-	bytesTransferred.WithLabelValues("sent").Add(float64(size))
-	sentPackets.WithLabelValues(m.getEncLevel(logging.PacketTypeFromHeader(&hdr.Header))).Inc()
+	m.metrics.bytesTransferred.WithLabelValues("sent").Add(float64(size))
+	m.metrics.sentPackets.WithLabelValues(m.getEncLevel(logging.PacketTypeFromHeader(&hdr.Header))).Inc()
 }
 
 func (m *metricsConnTracer) ReceivedVersionNegotiationPacket(hdr *logging.Header, v []logging.VersionNumber) {
-	bytesTransferred.WithLabelValues("rcvd").Add(float64(hdr.ParsedLen() + logging.ByteCount(4*len(v))))
-	rcvdPackets.WithLabelValues("Version Negotiation").Inc()
+	m.metrics.bytesTransferred.WithLabelValues("rcvd").Add(float64(hdr.ParsedLen() + logging.ByteCount(4*len(v))))
+	m.metrics.rcvdPackets.WithLabelValues("Version Negotiation").Inc()
 }
 
 func (m *metricsConnTracer) ReceivedRetry(*logging.Header) {
-	rcvdPackets.WithLabelValues("Retry").Inc()
+	m.metrics.rcvdPackets.WithLabelValues("Retry").Inc()
 }
 
 func (m *metricsConnTracer) ReceivedPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, _ []logging.Frame) {
-	bytesTransferred.WithLabelValues("rcvd").Add(float64(size))
-	rcvdPackets.WithLabelValues(m.getEncLevel(logging.PacketTypeFromHeader(&hdr.Header))).Inc()
+	m.metrics.bytesTransferred.WithLabelValues("rcvd").Add(float64(size))
+	m.metrics.rcvdPackets.WithLabelValues(m.getEncLevel(logging.PacketTypeFromHeader(&hdr.Header))).Inc()
 }
 
 func (m *metricsConnTracer) BufferedPacket(packetType logging.PacketType) {
-	bufferedPackets.WithLabelValues(m.getEncLevel(packetType)).Inc()
+	m.metrics.bufferedPackets.WithLabelValues(m.getEncLevel(packetType)).Inc()
 }
 
 func (m *metricsConnTracer) DroppedPacket(packetType logging.PacketType, size logging.ByteCount, r logging.PacketDropReason) {
-	bytesTransferred.WithLabelValues("rcvd").Add(float64(size))
+	m.metrics.bytesTransferred.WithLabelValues("rcvd").Add(float64(size))
 	var reason string
 	switch r {
 	case logging.PacketDropKeyUnavailable:
@@ -319,7 +281,7 @@ func (m *metricsConnTracer) DroppedPacket(packetType logging.PacketType, size lo
 	default:
 		reason = "unknown"
 	}
-	droppedPackets.WithLabelValues(m.getEncLevel(packetType), reason).Inc()
+	m.metrics.droppedPackets.WithLabelValues(m.getEncLevel(packetType), reason).Inc()
 }
 
 func (m *metricsConnTracer) UpdatedMetrics(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) {
@@ -341,7 +303,7 @@ func (m *metricsConnTracer) LostPacket(level logging.EncryptionLevel, _ logging.
 	default:
 		reason = "unknown"
 	}
-	lostPackets.WithLabelValues(level.String(), reason).Inc()
+	m.metrics.lostPackets.WithLabelValues(level.String(), reason).Inc()
 }
 
 func (m *metricsConnTracer) UpdatedCongestionState(state logging.CongestionState) {}
@@ -364,18 +326,18 @@ func (m *metricsConnTracer) LossTimerCanceled() {}
 
 func (m *metricsConnTracer) Close() {
 	if m.handshakeComplete {
-		closedConns.WithLabelValues(m.getDirection()).Inc()
+		m.metrics.closedConns.WithLabelValues(m.getDirection()).Inc()
 	} else {
-		newConns.WithLabelValues(m.getDirection(), "false").Inc()
+		m.metrics.newConns.WithLabelValues(m.getDirection(), "false").Inc()
 	}
-	collector.RemoveConn(m.connID.String())
+	m.metrics.collector.RemoveConn(m.connID.String())
 }
 
 func (m *metricsConnTracer) Debug(name, msg string) {}
 
 func (m *metricsConnTracer) handleHandshakeComplete() {
 	m.handshakeComplete = true
-	newConns.WithLabelValues(m.getDirection(), "true").Inc()
+	m.metrics.newConns.WithLabelValues(m.getDirection(), "true").Inc()
 }
 
 func (m *metricsConnTracer) getSmoothedRTT() (rtt time.Duration, valid bool) {
@@ -2,10 +2,13 @@ package libp2pquic
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -72,3 +75,32 @@ func TestQlogCompression(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, data, []byte("foobar"))
 }
+
+func TestQlogDirOption(t *testing.T) {
+	qlogDir := createLogDir(t)
+	serverID, serverKey := createPeer(t)
+	_, clientKey := createPeer(t)
+	serverTransport, err := NewTransport(serverKey, nil, nil, nil, WithQlogDir(qlogDir), DisableMetrics())
+	require.NoError(t, err)
+	defer serverTransport.(io.Closer).Close()
+	clientTransport, err := NewTransport(clientKey, nil, nil, nil, DisableMetrics())
+	require.NoError(t, err)
+	defer clientTransport.(io.Closer).Close()
+
+	ln := runServer(t, serverTransport, "/ip4/127.0.0.1/udp/0/quic")
+	defer ln.Close()
+	conn, err := clientTransport.Dial(context.Background(), ln.Multiaddr(), serverID)
+	require.NoError(t, err)
+	serverConn, err := ln.Accept()
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	require.NoError(t, serverConn.Close())
+
+	// only the server writes a qlog
+	require.Eventually(t, func() bool {
+		files, err := ioutil.ReadDir(qlogDir)
+		require.NoError(t, err)
+		return len(files) == 1 && strings.HasSuffix(files[0].Name(), ".qlog.zst")
+	}, time.Second, 10*time.Millisecond)
+	require.Contains(t, getFile(t, qlogDir).Name(), "server")
+}
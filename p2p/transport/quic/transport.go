@@ -2,6 +2,7 @@ package libp2pquic
 
 import (
 	"context"
+	"crypto/cipher"
 	"errors"
 	"fmt"
 	"io"
@@ -113,6 +114,8 @@ type transport struct {
 	clientConfig *quic.Config
 	gater        connmgr.ConnectionGater
 	rcmgr        network.ResourceManager
+	pnetAEAD     cipher.AEAD     // nil unless we're on a private network
+	datagrams    *datagramTracer // nil unless datagrams are enabled
 
 	holePunchingMx sync.Mutex
 	holePunching   map[holePunchKey]*activeHolePunch
@@ -134,11 +137,22 @@ type activeHolePunch struct {
 }
 
 // NewTransport creates a new QUIC transport
-func NewTransport(key ic.PrivKey, psk pnet.PSK, gater connmgr.ConnectionGater, rcmgr network.ResourceManager) (tpt.Transport, error) {
-	if len(psk) > 0 {
-		log.Error("QUIC doesn't support private networks yet.")
-		return nil, errors.New("QUIC doesn't support private networks yet")
+func NewTransport(key ic.PrivKey, psk pnet.PSK, gater connmgr.ConnectionGater, rcmgr network.ResourceManager, opts ...Option) (tpt.Transport, error) {
+	cfg := &config{quicConfig: quicConfig.Clone()}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
 	}
+	var datagrams *datagramTracer
+	if cfg.quicConfig.EnableDatagrams {
+		datagrams = newDatagramTracer()
+	}
+	tracer, err := newTracer(cfg, datagrams)
+	if err != nil {
+		return nil, err
+	}
+	cfg.quicConfig.Tracer = tracer
 	localPeer, err := peer.IDFromPrivateKey(key)
 	if err != nil {
 		return nil, err
@@ -154,17 +168,23 @@ func NewTransport(key ic.PrivKey, psk pnet.PSK, gater connmgr.ConnectionGater, r
 	if rcmgr == nil {
 		rcmgr = network.NullResourceManager
 	}
-	config := quicConfig.Clone()
+	quicConf := cfg.quicConfig
 	keyBytes, err := key.Raw()
 	if err != nil {
 		return nil, err
 	}
 	keyReader := hkdf.New(sha256.New, keyBytes, nil, []byte(statelessResetKeyInfo))
-	config.StatelessResetKey = make([]byte, 32)
-	if _, err := io.ReadFull(keyReader, config.StatelessResetKey); err != nil {
+	quicConf.StatelessResetKey = make([]byte, 32)
+	if _, err := io.ReadFull(keyReader, quicConf.StatelessResetKey); err != nil {
 		return nil, err
 	}
-	config.Tracer = tracer
+
+	var pnetAEAD cipher.AEAD
+	if len(psk) > 0 {
+		if pnetAEAD, err = newPNetAEAD(psk); err != nil {
+			return nil, err
+		}
+	}
 
 	tr := &transport{
 		privKey:      key,
@@ -173,12 +193,14 @@ func NewTransport(key ic.PrivKey, psk pnet.PSK, gater connmgr.ConnectionGater, r
 		connManager:  connManager,
 		gater:        gater,
 		rcmgr:        rcmgr,
+		pnetAEAD:     pnetAEAD,
+		datagrams:    datagrams,
 		conns:        make(map[quic.Connection]*conn),
 		holePunching: make(map[holePunchKey]*activeHolePunch),
 	}
-	config.AllowConnectionWindowIncrease = tr.allowWindowIncrease
-	tr.serverConfig = config
-	tr.clientConfig = config.Clone()
+	quicConf.AllowConnectionWindowIncrease = tr.allowWindowIncrease
+	tr.serverConfig = quicConf
+	tr.clientConfig = quicConf.Clone()
 	return tr, nil
 }
 
@@ -215,7 +237,7 @@ func (t *transport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (tp
 	if err != nil {
 		return nil, err
 	}
-	qconn, err := quicDialContext(ctx, pconn, addr, host, tlsConf, t.clientConfig)
+	qconn, err := quicDialContext(ctx, t.wrapPacketConn(pconn), addr, host, tlsConf, t.clientConfig)
 	if err != nil {
 		scope.Done()
 		pconn.DecreaseCount()
@@ -255,9 +277,18 @@ func (t *transport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (tp
 		return nil, fmt.Errorf("secured connection gated")
 	}
 	t.addConn(qconn, c)
+	c.startReceivingDatagrams()
 	return c, nil
 }
 
+// wrapPacketConn protects all packets sent and received on c if we're on a private network.
+func (t *transport) wrapPacketConn(c net.PacketConn) net.PacketConn {
+	if t.pnetAEAD == nil {
+		return c
+	}
+	return newPNetPacketConn(c, t.pnetAEAD)
+}
+
 func (t *transport) addConn(conn quic.Connection, c *conn) {
 	t.connMx.Lock()
 	t.conns[conn] = c
@@ -10,7 +10,9 @@ import (
 	"io"
 	"net"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 
 	ic "github.com/libp2p/go-libp2p-core/crypto"
@@ -97,3 +99,82 @@ func TestConnectionPassedToQUIC(t *testing.T) {
 		t.Fatal("connection passed to quic-go cannot be type asserted to a *net.UDPConn")
 	}
 }
+
+func TestTransportOptions(t *testing.T) {
+	_, key := createPeer(t)
+	tr, err := NewTransport(key, nil, nil, nil,
+		WithMaxStreamReceiveWindow(1<<20),
+		WithMaxConnectionReceiveWindow(2<<20),
+		WithMaxIncomingStreams(10),
+		WithIdleTimeout(time.Minute),
+		WithKeepAlive(false),
+		DisableMetrics(),
+	)
+	require.NoError(t, err)
+	defer tr.(io.Closer).Close()
+
+	for _, conf := range []*quic.Config{tr.(*transport).serverConfig, tr.(*transport).clientConfig} {
+		require.Equal(t, uint64(1<<20), conf.MaxStreamReceiveWindow)
+		require.Equal(t, uint64(2<<20), conf.MaxConnectionReceiveWindow)
+		require.Equal(t, int64(10), conf.MaxIncomingStreams)
+		require.Equal(t, time.Minute, conf.MaxIdleTimeout)
+		require.False(t, conf.KeepAlive)
+		require.Nil(t, conf.Tracer)
+	}
+	// the defaults are not modified
+	require.Equal(t, int64(256), quicConfig.MaxIncomingStreams)
+	require.True(t, quicConfig.KeepAlive)
+
+	_, err = NewTransport(key, nil, nil, nil, WithIdleTimeout(0))
+	require.EqualError(t, err, "idle timeout must be positive")
+}
+
+func TestMetricsRegisterer(t *testing.T) {
+	serverID, serverKey := createPeer(t)
+	_, clientKey := createPeer(t)
+	serverReg := prometheus.NewRegistry()
+	clientReg := prometheus.NewRegistry()
+
+	serverTransport, err := NewTransport(serverKey, nil, nil, nil, WithMetricsRegisterer(serverReg))
+	require.NoError(t, err)
+	defer serverTransport.(io.Closer).Close()
+	// transports can share a registerer
+	otherTransport, err := NewTransport(serverKey, nil, nil, nil, WithMetricsRegisterer(serverReg))
+	require.NoError(t, err)
+	defer otherTransport.(io.Closer).Close()
+	clientTransport, err := NewTransport(clientKey, nil, nil, nil, WithMetricsRegisterer(clientReg))
+	require.NoError(t, err)
+	defer clientTransport.(io.Closer).Close()
+
+	ln := runServer(t, serverTransport, "/ip4/127.0.0.1/udp/0/quic")
+	defer ln.Close()
+	conn, err := clientTransport.Dial(context.Background(), ln.Multiaddr(), serverID)
+	require.NoError(t, err)
+	defer conn.Close()
+	serverConn, err := ln.Accept()
+	require.NoError(t, err)
+	defer serverConn.Close()
+
+	newConns := func(reg *prometheus.Registry, direction string) float64 {
+		mfs, err := reg.Gather()
+		require.NoError(t, err)
+		for _, mf := range mfs {
+			if mf.GetName() != "quic_connections_new_total" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "direction" && l.GetValue() == direction {
+						return m.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return 0
+	}
+	require.Eventually(t, func() bool {
+		return newConns(clientReg, "outgoing") == 1 && newConns(serverReg, "incoming") == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Zero(t, newConns(clientReg, "incoming"))
+	require.Zero(t, newConns(serverReg, "outgoing"))
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
 	csms "github.com/libp2p/go-libp2p/p2p/net/conn-security-multistream"
+	proxyt "github.com/libp2p/go-libp2p/p2p/net/proxy/testing"
 	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
 	ttransport "github.com/libp2p/go-libp2p/p2p/transport/testsuite"
 
@@ -97,6 +98,83 @@ func TestResourceManager(t *testing.T) {
 	})
 }
 
+func TestProxy(t *testing.T) {
+	peerA, ia := makeInsecureMuxer(t)
+	_, ib := makeInsecureMuxer(t)
+
+	ua, err := tptu.New(ia, yamux.DefaultTransport)
+	require.NoError(t, err)
+	ta, err := NewTCPTransport(ua, nil)
+	require.NoError(t, err)
+	ln, err := ta.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	ub, err := tptu.New(ib, yamux.DefaultTransport)
+	require.NoError(t, err)
+
+	t.Run("SOCKS5", func(t *testing.T) {
+		srv, err := proxyt.NewSOCKS5Server("user", "secret")
+		require.NoError(t, err)
+		defer srv.Close()
+		tb, err := NewTCPTransport(ub, nil, WithProxy(srv.URL()))
+		require.NoError(t, err)
+
+		conn, err := tb.Dial(context.Background(), ln.Multiaddr(), peerA)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.Equal(t, ln.Multiaddr(), conn.RemoteMultiaddr())
+		require.Len(t, srv.Targets(), 1)
+	})
+
+	t.Run("bypass", func(t *testing.T) {
+		srv, err := proxyt.NewSOCKS5Server("", "")
+		require.NoError(t, err)
+		defer srv.Close()
+		tb, err := NewTCPTransport(ub, nil, WithProxy(srv.URL(), "127.0.0.0/8"))
+		require.NoError(t, err)
+
+		conn, err := tb.Dial(context.Background(), ln.Multiaddr(), peerA)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.Equal(t, ln.Multiaddr(), conn.RemoteMultiaddr())
+		require.Empty(t, srv.Targets())
+	})
+
+	t.Run("host name", func(t *testing.T) {
+		srv, err := proxyt.NewSOCKS5Server("", "")
+		require.NoError(t, err)
+		defer srv.Close()
+		// the host name is resolved by the proxy, even though the bypass list contains its IP address
+		tb, err := NewTCPTransport(ub, nil, WithProxy(srv.URL(), "127.0.0.0/8"))
+		require.NoError(t, err)
+
+		port, err := ln.Multiaddr().ValueForProtocol(ma.P_TCP)
+		require.NoError(t, err)
+		raddr := ma.StringCast("/dns4/localhost/tcp/" + port)
+		require.True(t, tb.CanDial(raddr))
+		conn, err := tb.Dial(context.Background(), raddr, peerA)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.Equal(t, raddr, conn.RemoteMultiaddr())
+		require.Equal(t, []string{"localhost:" + port}, srv.Targets())
+	})
+
+	t.Run("invalid proxy", func(t *testing.T) {
+		_, err := NewTCPTransport(ub, nil, WithProxy("ftp://proxy.example.com"))
+		require.Error(t, err)
+	})
+}
+
 func TestTcpTransportCantDialDNS(t *testing.T) {
 	for i := 0; i < 2; i++ {
 		dnsa, err := ma.NewMultiaddr("/dns4/example.com/tcp/1234")
@@ -181,11 +181,11 @@ func SubtestStress(t *testing.T, ta, tb transport.Transport, maddr ma.Multiaddr,
 		fullClose(t, s)
 	}
 
-	openConnAndRW := func() {
+	openConnAndRW := func(i int) {
 		var wg sync.WaitGroup
 		defer wg.Wait()
 
-		l, err := ta.Listen(maddr)
+		l, err := ta.Listen(uniqueListenAddr(maddr, i))
 		if err != nil {
 			t.Error(err)
 			return
@@ -227,10 +227,11 @@ func SubtestStress(t *testing.T, ta, tb transport.Transport, maddr ma.Multiaddr,
 	var wg sync.WaitGroup
 	defer wg.Wait()
 	for i := 0; i < opt.ConnNum; i++ {
+		i := i
 		wg.Add(1)
 		go rateLimit(func() {
 			defer wg.Done()
-			openConnAndRW()
+			openConnAndRW(i)
 		})
 	}
 }
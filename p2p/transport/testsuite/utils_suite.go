@@ -1,6 +1,7 @@
 package ttransport
 
 import (
+	"fmt"
 	"reflect"
 	"runtime"
 	"testing"
@@ -44,3 +45,13 @@ func SubtestTransport(t *testing.T, ta, tb transport.Transport, addr string, pee
 		})
 	}
 }
+
+// uniqueListenAddr returns an address for the i-th of several listeners that are open at the same time.
+// Listening on port 0 picks a different port every time, but Unix domain sockets need a path of their own.
+func uniqueListenAddr(maddr ma.Multiaddr, i int) ma.Multiaddr {
+	path, err := maddr.ValueForProtocol(ma.P_UNIX)
+	if err != nil {
+		return maddr
+	}
+	return ma.StringCast(fmt.Sprintf("/unix%s.%d", path, i))
+}
@@ -0,0 +1,219 @@
+// Package unix implements a libp2p transport for Unix domain sockets.
+//
+// It's intended for connecting processes on the same machine, e.g. an
+// application and a libp2p daemon running as a sidecar. Addresses have the
+// form /unix/<path>, for example /unix/var/run/libp2p.sock.
+package unix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/transport"
+
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	mafmt "github.com/multiformats/go-multiaddr-fmt"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const defaultConnectTimeout = 5 * time.Second
+
+// staleCheckTimeout is the time we wait for a connection when checking if a socket file is still in use.
+const staleCheckTimeout = time.Second
+
+var log = logging.Logger("unix-tpt")
+
+// ErrSocketInUse is returned when listening on a socket file that another listener is using.
+var ErrSocketInUse = errors.New("socket is in use")
+
+type Option func(*UnixTransport) error
+
+// WithConnectionTimeout sets the timeout for dialing a socket.
+func WithConnectionTimeout(d time.Duration) Option {
+	return func(tr *UnixTransport) error {
+		tr.connectTimeout = d
+		return nil
+	}
+}
+
+// WithFileMode sets the permissions of the socket files created when listening.
+// Processes need write permission on a socket file to connect to it.
+// By default, the permissions are determined by the process' umask.
+func WithFileMode(mode os.FileMode) Option {
+	return func(tr *UnixTransport) error {
+		if mode&^os.ModePerm != 0 {
+			return fmt.Errorf("invalid file mode: %s", mode)
+		}
+		tr.fileMode = mode
+		return nil
+	}
+}
+
+// DisableStaleSocketCleanup disables the removal of stale socket files.
+// By default, the transport removes a socket file that is left over from a
+// listener that didn't shut down cleanly before listening on its path.
+func DisableStaleSocketCleanup() Option {
+	return func(tr *UnixTransport) error {
+		tr.disableStaleCleanup = true
+		return nil
+	}
+}
+
+// UnixTransport is the Unix domain socket transport.
+type UnixTransport struct {
+	// Connection upgrader for upgrading insecure stream connections to
+	// secure multiplex connections.
+	Upgrader transport.Upgrader
+
+	connectTimeout      time.Duration
+	fileMode            os.FileMode // 0 means that the mode isn't changed
+	disableStaleCleanup bool
+
+	rcmgr network.ResourceManager
+}
+
+var _ transport.Transport = &UnixTransport{}
+
+// NewUnixTransport creates a Unix domain socket transport.
+func NewUnixTransport(upgrader transport.Upgrader, rcmgr network.ResourceManager, opts ...Option) (*UnixTransport, error) {
+	if rcmgr == nil {
+		rcmgr = network.NullResourceManager
+	}
+	tr := &UnixTransport{
+		Upgrader:       upgrader,
+		connectTimeout: defaultConnectTimeout, // can be set by using the WithConnectionTimeout option
+		rcmgr:          rcmgr,
+	}
+	for _, o := range opts {
+		if err := o(tr); err != nil {
+			return nil, err
+		}
+	}
+	return tr, nil
+}
+
+var dialMatcher = mafmt.Base(ma.P_UNIX)
+
+// CanDial returns true if this transport believes it can dial the given
+// multiaddr.
+func (t *UnixTransport) CanDial(addr ma.Multiaddr) bool {
+	return dialMatcher.Matches(addr)
+}
+
+func (t *UnixTransport) maDial(ctx context.Context, raddr ma.Multiaddr) (manet.Conn, error) {
+	// Apply the deadline iff applicable
+	if t.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.connectTimeout)
+		defer cancel()
+	}
+	var d manet.Dialer
+	return d.DialContext(ctx, raddr)
+}
+
+// Dial dials the peer at the remote address.
+func (t *UnixTransport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (transport.CapableConn, error) {
+	connScope, err := t.rcmgr.OpenConnection(network.DirOutbound, true)
+	if err != nil {
+		log.Debugw("resource manager blocked outgoing connection", "peer", p, "addr", raddr, "error", err)
+		return nil, err
+	}
+	if err := connScope.SetPeer(p); err != nil {
+		log.Debugw("resource manager blocked outgoing connection for peer", "peer", p, "addr", raddr, "error", err)
+		connScope.Done()
+		return nil, err
+	}
+	conn, err := t.maDial(ctx, raddr)
+	if err != nil {
+		connScope.Done()
+		return nil, err
+	}
+	direction := network.DirOutbound
+	if ok, isClient, _ := network.GetSimultaneousConnect(ctx); ok && !isClient {
+		direction = network.DirInbound
+	}
+	return t.Upgrader.Upgrade(ctx, t, conn, direction, p, connScope)
+}
+
+// Listen listens on the given multiaddr.
+// The socket file is removed when the listener is closed.
+func (t *UnixTransport) Listen(laddr ma.Multiaddr) (transport.Listener, error) {
+	if !t.CanDial(laddr) {
+		return nil, fmt.Errorf("can't listen on %s", laddr)
+	}
+	path, err := laddr.ValueForProtocol(ma.P_UNIX)
+	if err != nil {
+		return nil, err
+	}
+	if !t.disableStaleCleanup {
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+	}
+	list, err := manet.Listen(laddr)
+	if err != nil {
+		return nil, err
+	}
+	if t.fileMode != 0 {
+		// There's a short window between creating the socket file and changing its permissions,
+		// during which the permissions are determined by the umask.
+		if err := os.Chmod(path, t.fileMode); err != nil {
+			list.Close()
+			return nil, err
+		}
+	}
+	return t.Upgrader.UpgradeListener(t, list), nil
+}
+
+// removeStaleSocket removes the socket file at path if connecting to it is refused,
+// i.e. if there's no listener anymore. This happens when a process exits without closing its listener.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		// Not a socket. Leave it alone, listening will fail.
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", path, staleCheckTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s", ErrSocketInUse, path)
+	}
+	// Only a refused connection tells us that nobody is listening anymore. On other errors
+	// (e.g. a timeout because the listener's backlog is full) the socket might still be in use.
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("failed to check whether socket %s is stale: %w", path, err)
+	}
+	log.Debugw("removing stale socket file", "path", path, "error", err)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Protocols returns the list of terminal protocols this transport can dial.
+func (t *UnixTransport) Protocols() []int {
+	return []int{ma.P_UNIX}
+}
+
+// Proxy always returns false for the Unix domain socket transport.
+func (t *UnixTransport) Proxy() bool {
+	return false
+}
+
+func (t *UnixTransport) String() string {
+	return "Unix"
+}
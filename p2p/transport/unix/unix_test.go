@@ -0,0 +1,129 @@
+package unix
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+	csms "github.com/libp2p/go-libp2p/p2p/net/conn-security-multistream"
+	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	ttransport "github.com/libp2p/go-libp2p/p2p/transport/testsuite"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/sec"
+	"github.com/libp2p/go-libp2p-core/sec/insecure"
+
+	ma "github.com/multiformats/go-multiaddr"
+
+	"github.com/stretchr/testify/require"
+)
+
+func socketAddr(t *testing.T) ma.Multiaddr {
+	t.Helper()
+	return ma.StringCast("/unix" + filepath.ToSlash(filepath.Join(t.TempDir(), "libp2p.sock")))
+}
+
+func newTransport(t *testing.T, opts ...Option) (peer.ID, *UnixTransport) {
+	t.Helper()
+	id, m := makeInsecureMuxer(t)
+	u, err := tptu.New(m, yamux.DefaultTransport)
+	require.NoError(t, err)
+	tr, err := NewUnixTransport(u, nil, opts...)
+	require.NoError(t, err)
+	return id, tr
+}
+
+func TestUnixTransport(t *testing.T) {
+	peerA, ta := newTransport(t)
+	_, tb := newTransport(t)
+	ttransport.SubtestTransport(t, ta, tb, socketAddr(t).String(), peerA)
+}
+
+func TestCanDial(t *testing.T) {
+	_, tr := newTransport(t)
+	require.True(t, tr.CanDial(ma.StringCast("/unix/tmp/libp2p.sock")))
+	require.False(t, tr.CanDial(ma.StringCast("/ip4/127.0.0.1/tcp/1234")))
+}
+
+func TestListenerRemovesSocketFile(t *testing.T) {
+	_, tr := newTransport(t)
+	addr := socketAddr(t)
+	path, err := addr.ValueForProtocol(ma.P_UNIX)
+	require.NoError(t, err)
+
+	ln, err := tr.Listen(addr)
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestStaleSocketCleanup(t *testing.T) {
+	addr := socketAddr(t)
+	path, err := addr.ValueForProtocol(ma.P_UNIX)
+	require.NoError(t, err)
+	// simulate a process that exited without removing its socket file
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	require.NoError(t, err)
+	stale.SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+
+	_, noCleanup := newTransport(t, DisableStaleSocketCleanup())
+	_, err = noCleanup.Listen(addr)
+	require.Error(t, err)
+
+	peerA, ta := newTransport(t)
+	ln, err := ta.Listen(addr)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// the socket file of a running listener is never removed
+	_, tb := newTransport(t)
+	_, err = tb.Listen(addr)
+	require.ErrorIs(t, err, ErrSocketInUse)
+
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Close()
+		}
+	}()
+	conn, err := tb.Dial(context.Background(), ln.Multiaddr(), peerA)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestFileMode(t *testing.T) {
+	_, err := NewUnixTransport(nil, nil, WithFileMode(os.ModeSocket|0600))
+	require.Error(t, err)
+
+	_, tr := newTransport(t, WithFileMode(0600))
+	addr := socketAddr(t)
+	ln, err := tr.Listen(addr)
+	require.NoError(t, err)
+	defer ln.Close()
+	path, err := addr.ValueForProtocol(ma.P_UNIX)
+	require.NoError(t, err)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+}
+
+func makeInsecureMuxer(t *testing.T) (peer.ID, sec.SecureMuxer) {
+	t.Helper()
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	var secMuxer csms.SSMuxer
+	secMuxer.AddTransport(insecure.ID, insecure.NewWithIdentity(id, priv))
+	return id, &secMuxer
+}
@@ -0,0 +1,451 @@
+package websocket
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+
+	ma "github.com/multiformats/go-multiaddr"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var log = logging.Logger("websocket-transport")
+
+const (
+	defaultAnnouncePort   = 443
+	defaultReloadInterval = time.Minute
+	// defaultACMERetryInterval is the time to wait before retrying to obtain a certificate from the ACME server.
+	defaultACMERetryInterval = time.Minute
+)
+
+// CertManagerOption configures a CertManager.
+type CertManagerOption func(*CertManager) error
+
+// WithAnnouncePort sets the port of the announced /wss addresses.
+// This is the port peers connect to, which can differ from the port the transport listens on,
+// e.g. when the host is behind a NAT. Defaults to 443.
+func WithAnnouncePort(port int) CertManagerOption {
+	return func(m *CertManager) error {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port: %d", port)
+		}
+		m.announcePort = port
+		return nil
+	}
+}
+
+// WithReloadInterval sets how often the certificate files of a CertManager created with
+// NewFileCertManager are checked for changes. Defaults to one minute.
+func WithReloadInterval(d time.Duration) CertManagerOption {
+	return func(m *CertManager) error {
+		if d <= 0 {
+			return errors.New("reload interval must be positive")
+		}
+		m.reloadInterval = d
+		return nil
+	}
+}
+
+// WithACMEEmail sets the contact email address of the ACME account.
+func WithACMEEmail(email string) CertManagerOption {
+	return func(m *CertManager) error {
+		m.acmeEmail = email
+		return nil
+	}
+}
+
+// WithACMECacheDir stores the ACME account key and the certificates in dir.
+// Without a cache directory, they are kept in memory, and certificates are obtained anew every time the node starts,
+// which quickly runs into the rate limits of public ACME servers.
+func WithACMECacheDir(dir string) CertManagerOption {
+	return func(m *CertManager) error {
+		m.acmeCacheDir = dir
+		return nil
+	}
+}
+
+// CertManager provides the certificates for /wss listeners, see WithCertManager.
+//
+// Certificates are either self-signed (only useful for testing), loaded from disk,
+// or obtained from an ACME server like Let's Encrypt. The CertManager also knows the
+// /dns4/<name>/tcp/443/wss addresses the host is reachable at: use AnnounceAddrs to
+// announce them.
+type CertManager struct {
+	announcePort   int
+	reloadInterval time.Duration
+	acmeEmail      string
+	acmeCacheDir   string
+	// can be overwritten by tests
+	acmeRetryInterval time.Duration
+
+	tlsConf *tls.Config
+	// start is called when the transport starts listening on a /wss address.
+	start     func()
+	startOnce sync.Once
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	wg        sync.WaitGroup
+
+	mutex       sync.RWMutex
+	cert        *tls.Certificate  // nil for ACME
+	acmeManager *autocert.Manager // nil unless using ACME
+	// names are the DNS names we have a valid certificate for
+	names []string
+}
+
+func newCertManager(opts []CertManagerOption) (*CertManager, error) {
+	m := &CertManager{
+		announcePort:      defaultAnnouncePort,
+		reloadInterval:    defaultReloadInterval,
+		acmeRetryInterval: defaultACMERetryInterval,
+		start:             func() {},
+	}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
+	return m, nil
+}
+
+// NewSelfSignedCertManager creates a CertManager that uses a self-signed certificate for names.
+// Browsers and other clients verifying certificates will refuse to connect, so this is only useful for testing.
+func NewSelfSignedCertManager(names []string, opts ...CertManagerOption) (*CertManager, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no names")
+	}
+	m, err := newCertManager(opts)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := generateSelfSignedCert(names)
+	if err != nil {
+		return nil, err
+	}
+	m.setCert(cert)
+	m.tlsConf = &tls.Config{GetCertificate: m.getCertificate}
+	return m, nil
+}
+
+func generateSelfSignedCert(names []string) (*tls.Certificate, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: names[0]},
+		DNSNames:              names,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, priv.Public(), priv)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{certDER}, PrivateKey: priv, Leaf: leaf}, nil
+}
+
+// NewFileCertManager creates a CertManager that loads a PEM encoded certificate (chain) and private key from disk.
+// The files are checked for changes periodically (see WithReloadInterval), such that renewed certificates
+// are used without restarting the node. The announced names are the DNS names of the certificate.
+func NewFileCertManager(certFile, keyFile string, opts ...CertManagerOption) (*CertManager, error) {
+	m, err := newCertManager(opts)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadCert(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	m.setCert(cert)
+	m.tlsConf = &tls.Config{GetCertificate: m.getCertificate}
+	m.wg.Add(1)
+	go m.watchFiles(certFile, keyFile)
+	return m, nil
+}
+
+func loadCert(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (m *CertManager) watchFiles(certFile, keyFile string) {
+	defer m.wg.Done()
+
+	modTime := func() time.Time {
+		var t time.Time
+		for _, f := range []string{certFile, keyFile} {
+			fi, err := os.Stat(f)
+			if err != nil {
+				continue
+			}
+			if fi.ModTime().After(t) {
+				t = fi.ModTime()
+			}
+		}
+		return t
+	}
+
+	lastModified := modTime()
+	ticker := time.NewTicker(m.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.ctx.Done():
+			return
+		}
+		t := modTime()
+		if !t.After(lastModified) {
+			continue
+		}
+		// The two files might not be updated at the same time.
+		// If loading fails, keep using the old certificate, and retry on the next tick.
+		cert, err := loadCert(certFile, keyFile)
+		if err != nil {
+			log.Debugw("failed to reload certificate", "error", err)
+			continue
+		}
+		lastModified = t
+		m.setCert(cert)
+		log.Infow("reloaded certificate", "names", cert.Leaf.DNSNames)
+	}
+}
+
+// NewACMECertManager creates a CertManager that obtains certificates for names from the ACME
+// server at directoryURL, e.g. acme.LetsEncryptURL. By using the ACME server, you agree to its terms of service.
+//
+// Ownership of the names is proven using the TLS-ALPN-01 challenge, so the ACME server needs to be able
+// to reach the /wss listener at port 443 of all names. Certificates are obtained once the transport listens
+// on a /wss address, and renewed automatically.
+func NewACMECertManager(directoryURL string, names []string, opts ...CertManagerOption) (*CertManager, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no names")
+	}
+	m, err := newCertManager(opts)
+	if err != nil {
+		return nil, err
+	}
+	var cache autocert.Cache = &memCache{entries: make(map[string][]byte)}
+	if m.acmeCacheDir != "" {
+		cache = autocert.DirCache(m.acmeCacheDir)
+	}
+	newManager := func() *autocert.Manager {
+		return &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(names...),
+			// Abort requests to the ACME server when the CertManager is closed.
+			Client: &acme.Client{
+				DirectoryURL: directoryURL,
+				HTTPClient:   &http.Client{Transport: &cancelTransport{ctx: m.ctx}},
+			},
+			Email: m.acmeEmail,
+			Cache: cache,
+		}
+	}
+	m.acmeManager = newManager()
+	m.tlsConf = &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName == "" {
+				// Peers dialing an IP address don't send a server name.
+				h := *hello
+				h.ServerName = names[0]
+				hello = &h
+			}
+			return m.getACMEManager().GetCertificate(hello)
+		},
+		// We need to negotiate the TLS-ALPN-01 protocol to answer challenges.
+		NextProtos: []string{"http/1.1", acme.ALPNProto},
+	}
+	m.start = func() {
+		m.wg.Add(1)
+		go m.obtainCerts(names, newManager)
+	}
+	return m, nil
+}
+
+func (m *CertManager) getACMEManager() *autocert.Manager {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.acmeManager
+}
+
+func (m *CertManager) obtainCerts(names []string, newManager func() *autocert.Manager) {
+	defer m.wg.Done()
+
+	for _, name := range names {
+		for m.ctx.Err() == nil {
+			// Make sure we get an ECDSA certificate. Clients that only support RSA are handled by the autocert.Manager.
+			hello := &tls.ClientHelloInfo{
+				ServerName:   name,
+				CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			}
+			_, err := m.getACMEManager().GetCertificate(hello)
+			if err == nil {
+				log.Infow("obtained certificate", "name", name)
+				m.mutex.Lock()
+				m.names = append(m.names, name)
+				m.mutex.Unlock()
+				break
+			}
+			log.Warnw("failed to obtain certificate", "name", name, "error", err)
+			select {
+			case <-time.After(m.acmeRetryInterval):
+			case <-m.ctx.Done():
+				return
+			}
+			// The autocert.Manager remembers the failure for a minute.
+			// Use a fresh one, so we control the retry interval.
+			// Certificates that were already obtained are loaded from the cache.
+			m.mutex.Lock()
+			m.acmeManager = newManager()
+			m.mutex.Unlock()
+		}
+	}
+}
+
+// cancelTransport is an http.RoundTripper that aborts requests when ctx is cancelled.
+type cancelTransport struct {
+	ctx context.Context
+}
+
+func (t *cancelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	go func() {
+		// Stop waiting once the request's context is done.
+		select {
+		case <-t.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return http.DefaultTransport.RoundTrip(req.WithContext(ctx))
+}
+
+// memCache is an in-memory autocert.Cache, used when no cache directory is configured.
+type memCache struct {
+	mutex   sync.Mutex
+	entries map[string][]byte
+}
+
+var _ autocert.Cache = &memCache{}
+
+func (c *memCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, ok := c.entries[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (c *memCache) Put(_ context.Context, key string, data []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[key] = data
+	return nil
+}
+
+func (c *memCache) Delete(_ context.Context, key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+func (m *CertManager) setCert(cert *tls.Certificate) {
+	var names []string
+	for _, name := range cert.Leaf.DNSNames {
+		// We can't announce wildcard names.
+		if !strings.HasPrefix(name, "*.") {
+			names = append(names, name)
+		}
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cert = cert
+	m.names = names
+}
+
+func (m *CertManager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.cert, nil
+}
+
+func (m *CertManager) listening() {
+	m.startOnce.Do(m.start)
+}
+
+// Addrs returns the /dns4/<name>/tcp/<port>/wss addresses for the names the CertManager has a certificate for.
+func (m *CertManager) Addrs() []ma.Multiaddr {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	addrs := make([]ma.Multiaddr, 0, len(m.names))
+	for _, name := range m.names {
+		addr, err := ma.NewMultiaddr("/dns4/" + name + "/tcp/" + strconv.Itoa(m.announcePort) + "/wss")
+		if err != nil {
+			log.Debugw("can't announce name", "name", name, "error", err)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// AnnounceAddrs returns the addresses returned by Addrs, if the host's addrs contain a /wss address.
+// Pass it to libp2p.AppendAnnounceAddrsFunc to announce these addresses.
+func (m *CertManager) AnnounceAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	for _, a := range addrs {
+		if _, err := a.ValueForProtocol(ma.P_WSS); err == nil {
+			return m.Addrs()
+		}
+	}
+	return nil
+}
+
+// Close stops reloading certificates from disk and obtaining certificates from the ACME server.
+func (m *CertManager) Close() error {
+	m.ctxCancel()
+	m.wg.Wait()
+	return nil
+}
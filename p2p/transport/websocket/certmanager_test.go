@@ -0,0 +1,251 @@
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wst "github.com/libp2p/go-libp2p/p2p/transport/websocket/testing"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/transport"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/stretchr/testify/require"
+)
+
+func listenWithCertManager(t *testing.T, m *CertManager) (peer.ID, transport.Listener) {
+	t.Helper()
+	id, u := newUpgrader(t)
+	tpt, err := New(u, network.NullResourceManager, WithCertManager(m))
+	require.NoError(t, err)
+	ln, err := tpt.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0/wss"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	return id, ln
+}
+
+// dialVerified dials ln, verifying the certificate for name using roots.
+func dialVerified(t *testing.T, ln transport.Listener, id peer.ID, name string, roots *x509.CertPool) {
+	t.Helper()
+	_, u := newUpgrader(t)
+	tpt, err := New(u, network.NullResourceManager, WithTLSClientConfig(&tls.Config{ServerName: name, RootCAs: roots}))
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c.Close()
+	}()
+	c, err := tpt.Dial(context.Background(), ln.Multiaddr(), id)
+	require.NoError(t, err)
+	defer c.Close()
+	// Closing the connection right away might make the server's handshake fail.
+	<-done
+}
+
+func writeCertFiles(t *testing.T, dir string, names ...string) (certFile, keyFile string) {
+	t.Helper()
+	cert, err := generateSelfSignedCert(names)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// tcpAddr returns the ip:port ln listens on.
+func tcpAddr(t *testing.T, ln transport.Listener) string {
+	t.Helper()
+	maddr, _ := ma.SplitLast(ln.Multiaddr())
+	addr, err := manet.ToNetAddr(maddr)
+	require.NoError(t, err)
+	return addr.String()
+}
+
+// peerCertificate returns the certificate presented by ln.
+func peerCertificate(t *testing.T, ln transport.Listener) *x509.Certificate {
+	t.Helper()
+	conn, err := tls.Dial("tcp", tcpAddr(t, ln), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0]
+}
+
+func TestSelfSignedCertManager(t *testing.T) {
+	_, err := NewSelfSignedCertManager(nil)
+	require.Error(t, err)
+	m, err := NewSelfSignedCertManager([]string{"libp2p.example.com"})
+	require.NoError(t, err)
+	defer m.Close()
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/dns4/libp2p.example.com/tcp/443/wss")}, m.Addrs())
+
+	id, ln := listenWithCertManager(t, m)
+	cert := peerCertificate(t, ln)
+	require.Equal(t, []string{"libp2p.example.com"}, cert.DNSNames)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	dialVerified(t, ln, id, "libp2p.example.com", roots)
+}
+
+func TestFileCertManager(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertFiles(t, dir, "foo.example.com", "*.example.com")
+	m, err := NewFileCertManager(certFile, keyFile, WithReloadInterval(10*time.Millisecond), WithAnnouncePort(8443))
+	require.NoError(t, err)
+	defer m.Close()
+	// wildcard names are not announced
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/dns4/foo.example.com/tcp/8443/wss")}, m.Addrs())
+
+	_, ln := listenWithCertManager(t, m)
+	require.Equal(t, []string{"foo.example.com", "*.example.com"}, peerCertificate(t, ln).DNSNames)
+
+	// replace the certificate
+	writeCertFiles(t, dir, "bar.example.com")
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	require.Eventually(t, func() bool {
+		addrs := m.Addrs()
+		return len(addrs) == 1 && addrs[0].Equal(ma.StringCast("/dns4/bar.example.com/tcp/8443/wss"))
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"bar.example.com"}, peerCertificate(t, ln).DNSNames)
+
+	// an invalid certificate is ignored
+	require.NoError(t, os.WriteFile(certFile, []byte("foobar"), 0o600))
+	future = future.Add(time.Hour)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, []string{"bar.example.com"}, peerCertificate(t, ln).DNSNames)
+
+	_, err = NewFileCertManager(filepath.Join(dir, "missing.pem"), keyFile)
+	require.Error(t, err)
+}
+
+func TestACMECertManager(t *testing.T) {
+	acmeServer, err := wst.NewACMEServer()
+	require.NoError(t, err)
+	defer acmeServer.Close()
+
+	const name = "libp2p.example.com"
+	m, err := NewACMECertManager(acmeServer.DirectoryURL(), []string{name}, WithACMECacheDir(t.TempDir()))
+	require.NoError(t, err)
+	defer m.Close()
+	m.acmeRetryInterval = 10 * time.Millisecond
+	// We don't have a certificate until we listen.
+	require.Empty(t, m.Addrs())
+
+	id, ln := listenWithCertManager(t, m)
+	// The ACME server can't validate the challenge until it knows the address of the listener.
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, m.Addrs())
+	require.Empty(t, acmeServer.Issued())
+
+	acmeServer.Resolve(name, tcpAddr(t, ln))
+	require.Eventually(t, func() bool { return len(m.Addrs()) > 0 }, 10*time.Second, 10*time.Millisecond)
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/dns4/libp2p.example.com/tcp/443/wss")}, m.Addrs())
+	require.Equal(t, []string{name}, acmeServer.Issued())
+
+	dialVerified(t, ln, id, name, acmeServer.Roots())
+}
+
+func TestACMECertManagerMultipleNames(t *testing.T) {
+	acmeServer, err := wst.NewACMEServer()
+	require.NoError(t, err)
+	defer acmeServer.Close()
+
+	m, err := NewACMECertManager(acmeServer.DirectoryURL(), []string{"foo.example.com", "bar.example.com"})
+	require.NoError(t, err)
+	defer m.Close()
+	m.acmeRetryInterval = 10 * time.Millisecond
+	id, ln := listenWithCertManager(t, m)
+	acmeServer.Resolve("foo.example.com", tcpAddr(t, ln))
+	require.Eventually(t, func() bool { return len(m.Addrs()) > 0 }, 10*time.Second, 10*time.Millisecond)
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/dns4/foo.example.com/tcp/443/wss")}, m.Addrs())
+
+	// Failing to obtain a certificate for bar.example.com doesn't affect the certificate for foo.example.com.
+	time.Sleep(50 * time.Millisecond)
+	dialVerified(t, ln, id, "foo.example.com", acmeServer.Roots())
+	require.Equal(t, []string{"foo.example.com"}, acmeServer.Issued())
+
+	acmeServer.Resolve("bar.example.com", tcpAddr(t, ln))
+	require.Eventually(t, func() bool { return len(m.Addrs()) == 2 }, 10*time.Second, 10*time.Millisecond)
+	dialVerified(t, ln, id, "bar.example.com", acmeServer.Roots())
+	require.Equal(t, []string{"foo.example.com", "bar.example.com"}, acmeServer.Issued())
+}
+
+func TestCertManagerAnnounceAddrs(t *testing.T) {
+	m, err := NewSelfSignedCertManager([]string{"libp2p.example.com"}, WithAnnouncePort(4443))
+	require.NoError(t, err)
+	defer m.Close()
+
+	addrs := []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1234")}
+	require.Empty(t, m.AnnounceAddrs(addrs))
+
+	addrs = append(addrs, ma.StringCast("/ip4/1.2.3.4/tcp/1235/wss"))
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/dns4/libp2p.example.com/tcp/4443/wss")}, m.AnnounceAddrs(addrs))
+}
+
+func TestACMECertManagerClose(t *testing.T) {
+	// an ACME server that never responds
+	requested := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer close(done)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	m, err := NewACMECertManager(srv.URL, []string{"libp2p.example.com"})
+	require.NoError(t, err)
+	listenWithCertManager(t, m)
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a request to the ACME server")
+	}
+
+	// Close aborts the request, and waits until we stop obtaining certificates
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close didn't return")
+	}
+}
+
+func TestCertManagerAndTLSConfig(t *testing.T) {
+	m, err := NewSelfSignedCertManager([]string{"libp2p.example.com"})
+	require.NoError(t, err)
+	defer m.Close()
+	_, u := newUpgrader(t)
+	_, err = New(u, network.NullResourceManager, WithCertManager(m), WithTLSConfig(&tls.Config{}))
+	require.Error(t, err)
+	_, err = NewSelfSignedCertManager([]string{"libp2p.example.com"}, WithAnnouncePort(0))
+	require.Error(t, err)
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
+
+	ws "github.com/gorilla/websocket"
 
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
@@ -16,24 +19,29 @@ var (
 )
 
 type listener struct {
-	nl     net.Listener
+	nl     net.Listener // nil if the listener is served on a ServeMux
 	server http.Server
 
+	upgrader       *ws.Upgrader
+	responseHeader http.Header
+	secure         bool
+
 	laddr ma.Multiaddr
 
-	closed   chan struct{}
-	incoming chan *Conn
+	closeOnce sync.Once
+	onClose   func()
+	closed    chan struct{}
+	incoming  chan *Conn
 }
 
 // newListener creates a new listener from a raw net.Listener.
 // tlsConf may be nil (for unencrypted websockets).
-func newListener(a ma.Multiaddr, tlsConf *tls.Config) (*listener, error) {
-	// Only look at the _last_ component.
-	maddr, wscomponent := ma.SplitLast(a)
-	isWSS := wscomponent.Equal(wssma)
-	if isWSS && tlsConf == nil {
-		return nil, fmt.Errorf("cannot listen on wss address %s without a tls.Config", a)
+func newListener(a ma.Multiaddr, tlsConf *tls.Config, upgrader *ws.Upgrader, responseHeader http.Header) (*listener, error) {
+	if err := checkTLSConfig(a, tlsConf); err != nil {
+		return nil, err
 	}
+	// Only look at the _last_ component.
+	maddr, _ := ma.SplitLast(a)
 	lnet, lnaddr, err := manet.DialArgs(maddr)
 	if err != nil {
 		return nil, err
@@ -42,7 +50,26 @@ func newListener(a ma.Multiaddr, tlsConf *tls.Config) (*listener, error) {
 	if err != nil {
 		return nil, err
 	}
+	l, err := newListenerOn(a, nl, tlsConf, upgrader, responseHeader)
+	if err != nil {
+		nl.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func checkTLSConfig(a ma.Multiaddr, tlsConf *tls.Config) error {
+	_, wscomponent := ma.SplitLast(a)
+	if wscomponent.Equal(wssma) && tlsConf == nil {
+		return fmt.Errorf("cannot listen on wss address %s without a tls.Config", a)
+	}
+	return nil
+}
 
+// newListenerOn creates a listener for a, serving HTTP on nl.
+func newListenerOn(a ma.Multiaddr, nl net.Listener, tlsConf *tls.Config, upgrader *ws.Upgrader, responseHeader http.Header) (*listener, error) {
+	_, wscomponent := ma.SplitLast(a)
+	isWSS := wscomponent.Equal(wssma)
 	laddr, err := manet.FromNetAddr(nl.Addr())
 	if err != nil {
 		return nil, err
@@ -56,18 +83,34 @@ func newListener(a ma.Multiaddr, tlsConf *tls.Config) (*listener, error) {
 	}
 
 	ln := &listener{
-		nl:       nl,
-		laddr:    laddr.Encapsulate(wscomponent),
-		incoming: make(chan *Conn),
-		closed:   make(chan struct{}),
+		nl:             nl,
+		upgrader:       upgrader,
+		responseHeader: responseHeader,
+		laddr:          laddr.Encapsulate(wscomponent),
+		incoming:       make(chan *Conn),
+		closed:         make(chan struct{}),
 	}
 	ln.server = http.Server{Handler: ln}
 	if isWSS {
-		ln.server.TLSConfig = tlsConf
+		// The http.Server modifies the config when it starts serving.
+		ln.server.TLSConfig = tlsConf.Clone()
 	}
 	return ln, nil
 }
 
+// newMuxListener creates a listener for connections accepted by a muxHandler.
+// The application serves the HTTP server, so laddr is used as is.
+func newMuxListener(laddr ma.Multiaddr, secure bool, upgrader *ws.Upgrader, responseHeader http.Header) *listener {
+	return &listener{
+		upgrader:       upgrader,
+		responseHeader: responseHeader,
+		secure:         secure,
+		laddr:          laddr,
+		incoming:       make(chan *Conn),
+		closed:         make(chan struct{}),
+	}
+}
+
 func (l *listener) serve() {
 	defer close(l.closed)
 	if l.server.TLSConfig == nil {
@@ -78,14 +121,14 @@ func (l *listener) serve() {
 }
 
 func (l *listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	c, err := upgrader.Upgrade(w, r, nil)
+	c, err := l.upgrader.Upgrade(w, r, l.responseHeader)
 	if err != nil {
 		// The upgrader writes a response for us.
 		return
 	}
 
 	select {
-	case l.incoming <- NewConn(c, false):
+	case l.incoming <- NewConn(c, l.secure):
 	case <-l.closed:
 		c.Close()
 	}
@@ -112,10 +155,21 @@ func (l *listener) Accept() (manet.Conn, error) {
 }
 
 func (l *listener) Addr() net.Addr {
+	if l.nl == nil {
+		addr, _ := ConvertWebsocketMultiaddrToNetAddr(l.laddr)
+		return addr
+	}
 	return l.nl.Addr()
 }
 
 func (l *listener) Close() error {
+	if l.nl == nil {
+		l.closeOnce.Do(func() {
+			l.onClose()
+			close(l.closed)
+		})
+		return nil
+	}
 	l.server.Close()
 	err := l.nl.Close()
 	<-l.closed
@@ -125,3 +179,39 @@ func (l *listener) Close() error {
 func (l *listener) Multiaddr() ma.Multiaddr {
 	return l.laddr
 }
+
+// muxHandler is the http.Handler registered on a ServeMux.
+// It passes requests to the current listener.
+type muxHandler struct {
+	mutex    sync.Mutex
+	listener *listener
+}
+
+func (h *muxHandler) setListener(l *listener) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.listener != nil {
+		return false
+	}
+	h.listener = l
+	return true
+}
+
+func (h *muxHandler) removeListener(l *listener) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.listener == l {
+		h.listener = nil
+	}
+}
+
+func (h *muxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	l := h.listener
+	h.mutex.Unlock()
+	if l == nil {
+		http.Error(w, "not accepting libp2p connections", http.StatusServiceUnavailable)
+		return
+	}
+	l.ServeHTTP(w, r)
+}
@@ -12,11 +12,15 @@ import (
 	"io/ioutil"
 	"math/big"
 	"net"
+	"net/http"
 	"testing"
 	"time"
 
 	csms "github.com/libp2p/go-libp2p/p2p/net/conn-security-multistream"
+	proxyt "github.com/libp2p/go-libp2p/p2p/net/proxy/testing"
+	"github.com/libp2p/go-libp2p/p2p/net/sharedtcp"
 	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 	ttransport "github.com/libp2p/go-libp2p/p2p/transport/testsuite"
 
 	"github.com/libp2p/go-libp2p-core/crypto"
@@ -28,7 +32,9 @@ import (
 	"github.com/libp2p/go-libp2p-core/transport"
 	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
 
+	ws "github.com/gorilla/websocket"
 	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/stretchr/testify/require"
 )
 
@@ -262,6 +268,232 @@ func TestWebsocketListenSecureAndInsecure(t *testing.T) {
 	})
 }
 
+func TestDialThroughProxy(t *testing.T) {
+	serverID, serverUpgrader := newUpgrader(t)
+	server, err := New(serverUpgrader, network.NullResourceManager, WithTLSConfig(generateTLSConfig(t)))
+	require.NoError(t, err)
+
+	for _, laddr := range []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/0/ws"), ma.StringCast("/ip4/127.0.0.1/tcp/0/wss")} {
+		t.Run(lastComponent(t, laddr).String(), func(t *testing.T) {
+			ln, err := server.Listen(laddr)
+			require.NoError(t, err)
+			defer ln.Close()
+			go func() {
+				c, err := ln.Accept()
+				if err == nil {
+					defer c.Close()
+					c.AcceptStream()
+				}
+			}()
+
+			srv, err := proxyt.NewHTTPConnectServer("user", "secret")
+			require.NoError(t, err)
+			defer srv.Close()
+
+			_, clientUpgrader := newUpgrader(t)
+			client, err := New(clientUpgrader, network.NullResourceManager,
+				WithTLSClientConfig(&tls.Config{InsecureSkipVerify: true}),
+				WithProxy(srv.URL()),
+			)
+			require.NoError(t, err)
+			conn, err := client.Dial(context.Background(), ln.Multiaddr(), serverID)
+			require.NoError(t, err)
+			defer conn.Close()
+			require.Equal(t, ln.Multiaddr(), conn.RemoteMultiaddr())
+			require.Len(t, srv.Targets(), 1)
+		})
+	}
+}
+
+func TestDialHostNameThroughProxy(t *testing.T) {
+	serverID, serverUpgrader := newUpgrader(t)
+	server, err := New(serverUpgrader, network.NullResourceManager)
+	require.NoError(t, err)
+	ln, err := server.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0/ws"))
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			defer c.Close()
+			c.AcceptStream()
+		}
+	}()
+
+	srv, err := proxyt.NewSOCKS5Server("", "")
+	require.NoError(t, err)
+	defer srv.Close()
+
+	_, clientUpgrader := newUpgrader(t)
+	// the host name is resolved by the proxy, even though the bypass list contains its IP address
+	client, err := New(clientUpgrader, network.NullResourceManager, WithProxy(srv.URL(), "127.0.0.0/8"))
+	require.NoError(t, err)
+	port, err := ln.Multiaddr().ValueForProtocol(ma.P_TCP)
+	require.NoError(t, err)
+	raddr := ma.StringCast(fmt.Sprintf("/dns4/localhost/tcp/%s/ws", port))
+	require.True(t, client.CanDial(raddr))
+	conn, err := client.Dial(context.Background(), raddr, serverID)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, []string{"localhost:" + port}, srv.Targets())
+	require.Equal(t, fmt.Sprintf("/dns/localhost/tcp/%s/ws", port), conn.RemoteMultiaddr().String())
+}
+
+func TestServeMux(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ui", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("web ui")) })
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer nl.Close()
+	go http.Serve(nl, mux)
+
+	serverID, serverUpgrader := newUpgrader(t)
+	header := http.Header{}
+	header.Set("X-Test", "foobar")
+	server, err := New(serverUpgrader, network.NullResourceManager,
+		WithServeMux(mux, "/"),
+		WithResponseHeader(header),
+		WithCheckOrigin(func(r *http.Request) bool { return r.Header.Get("Origin") != "https://evil.example.com" }),
+	)
+	require.NoError(t, err)
+
+	_, err = server.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0/ws"))
+	require.Error(t, err)
+	laddr := ma.StringCast(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d/ws", nl.Addr().(*net.TCPAddr).Port))
+	ln, err := server.Listen(laddr)
+	require.NoError(t, err)
+	require.Equal(t, laddr, ln.Multiaddr())
+	_, err = server.Listen(laddr)
+	require.Error(t, err)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	// the application's handlers are still served
+	resp, err := http.Get(fmt.Sprintf("http://%s/ui", nl.Addr()))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "web ui", string(body))
+
+	_, clientUpgrader := newUpgrader(t)
+	client, err := New(clientUpgrader, network.NullResourceManager)
+	require.NoError(t, err)
+	conn, err := client.Dial(context.Background(), laddr, serverID)
+	require.NoError(t, err)
+	conn.Close()
+
+	url := fmt.Sprintf("ws://%s/", nl.Addr())
+	wsconn, resp, err := ws.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	wsconn.Close()
+	require.Equal(t, "foobar", resp.Header.Get("X-Test"))
+	_, resp, err = ws.DefaultDialer.Dial(url, http.Header{"Origin": []string{"https://evil.example.com"}})
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// after closing the listener, requests are rejected, until we listen again
+	require.NoError(t, ln.Close())
+	_, resp, err = ws.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	ln2, err := server.Listen(laddr)
+	require.NoError(t, err)
+	defer ln2.Close()
+}
+
+func TestServeMuxPathAlreadyRegistered(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	_, u := newUpgrader(t)
+	tr, err := New(u, network.NullResourceManager, WithServeMux(mux, "/"))
+	require.NoError(t, err)
+	_, err = tr.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/1234/ws"))
+	require.Error(t, err)
+}
+
+func TestSharedListener(t *testing.T) {
+	m := sharedtcp.NewManager()
+	serverID, serverUpgrader := newUpgrader(t)
+	tcpServer, err := tcp.NewTCPTransport(serverUpgrader, nil, tcp.WithSharedListener(m))
+	require.NoError(t, err)
+	tcpLn, err := tcpServer.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer tcpLn.Close()
+
+	wsServer, err := New(serverUpgrader, network.NullResourceManager, WithTLSConfig(generateTLSConfig(t)), WithSharedListener(m))
+	require.NoError(t, err)
+	wsLn, err := wsServer.Listen(tcpLn.Multiaddr().Encapsulate(ma.StringCast("/ws")))
+	require.NoError(t, err)
+	defer wsLn.Close()
+	wssLn, err := wsServer.Listen(tcpLn.Multiaddr().Encapsulate(ma.StringCast("/wss")))
+	require.NoError(t, err)
+	defer wssLn.Close()
+	require.Equal(t, tcpLn.Multiaddr().Encapsulate(ma.StringCast("/ws")), wsLn.Multiaddr())
+	require.Equal(t, tcpLn.Multiaddr().Encapsulate(ma.StringCast("/wss")), wssLn.Multiaddr())
+
+	_, clientUpgrader := newUpgrader(t)
+	tcpClient, err := tcp.NewTCPTransport(clientUpgrader, nil)
+	require.NoError(t, err)
+	wsClient, err := New(clientUpgrader, network.NullResourceManager, WithTLSClientConfig(&tls.Config{InsecureSkipVerify: true}))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		client transport.Transport
+		ln     transport.Listener
+	}{
+		{client: tcpClient, ln: tcpLn},
+		{client: wsClient, ln: wsLn},
+		{client: wsClient, ln: wssLn},
+	} {
+		accepted := make(chan transport.CapableConn, 1)
+		go func() {
+			c, err := tc.ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}()
+		conn, err := tc.client.Dial(context.Background(), tc.ln.Multiaddr(), serverID)
+		require.NoError(t, err, tc.ln.Multiaddr())
+		select {
+		case c := <-accepted:
+			require.Equal(t, conn.LocalPeer(), c.RemotePeer())
+			c.Close()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout accepting a connection on %s", tc.ln.Multiaddr())
+		}
+		conn.Close()
+	}
+
+	// The port is in use until all listeners are closed.
+	require.NoError(t, tcpLn.Close())
+	require.NoError(t, wsLn.Close())
+	_, err = manet.Listen(tcpLn.Multiaddr())
+	require.Error(t, err)
+	require.NoError(t, wssLn.Close())
+	nl, err := manet.Listen(tcpLn.Multiaddr())
+	require.NoError(t, err)
+	nl.Close()
+}
+
+func TestSharedListenerPrivateNetwork(t *testing.T) {
+	_, m := newSecureMuxer(t)
+	u, err := tptu.New(m, yamux.DefaultTransport, tptu.WithPSK(make([]byte, 32)))
+	require.NoError(t, err)
+	_, err = tcp.NewTCPTransport(u, nil, tcp.WithSharedListener(sharedtcp.NewManager()))
+	require.ErrorIs(t, err, sharedtcp.ErrPrivateNetwork)
+	_, err = New(u, network.NullResourceManager, WithSharedListener(sharedtcp.NewManager()))
+	require.ErrorIs(t, err, sharedtcp.ErrPrivateNetwork)
+}
+
 func TestConcurrentClose(t *testing.T) {
 	_, u := newUpgrader(t)
 	tpt, err := New(u, network.NullResourceManager)